@@ -0,0 +1,55 @@
+package changedpi
+
+import "encoding/binary"
+
+// BMP 相关常量
+const (
+	bmpFileHeaderSize = 14 // BITMAPFILEHEADER长度
+	bmpInfoHeaderSize = 40 // BITMAPINFOHEADER长度，更早的BITMAPCOREHEADER没有分辨率字段
+	bmpXPelsOffset    = bmpFileHeaderSize + 24
+	bmpYPelsOffset    = bmpFileHeaderSize + 28
+)
+
+// changeDpiByBmp 修改BMP图片的DPI（biXPelsPerMeter/biYPelsPerMeter）
+func changeDpiByBmp(data []byte, xdpi, ydpi float64) ([]byte, error) {
+	if err := checkBmpHeader(data); err != nil {
+		return nil, err
+	}
+
+	// 创建副本以避免修改原始数据
+	result := make([]byte, len(data))
+	copy(result, data)
+	binary.LittleEndian.PutUint32(result[bmpXPelsOffset:], dpiToPpm(xdpi))
+	binary.LittleEndian.PutUint32(result[bmpYPelsOffset:], dpiToPpm(ydpi))
+	return result, nil
+}
+
+// readDpiByBmp 读取BMP图片的DPI
+func readDpiByBmp(data []byte) (DpiInfo, error) {
+	if err := checkBmpHeader(data); err != nil {
+		return DpiInfo{}, err
+	}
+
+	x := int32(binary.LittleEndian.Uint32(data[bmpXPelsOffset:]))
+	y := int32(binary.LittleEndian.Uint32(data[bmpYPelsOffset:]))
+	if x <= 0 && y <= 0 {
+		return DpiInfo{Source: SourceAbsent}, nil
+	}
+	return DpiInfo{
+		X:      float64(x) / dpiToPpmFactor,
+		Y:      float64(y) / dpiToPpmFactor,
+		Unit:   UnitMeter,
+		Source: SourceBMP,
+	}, nil
+}
+
+// checkBmpHeader 检查BMP文件头是否包含分辨率字段
+func checkBmpHeader(data []byte) error {
+	if len(data) < bmpFileHeaderSize+bmpInfoHeaderSize || string(data[0:2]) != bmpHeader {
+		return ErrInvalidBMP
+	}
+	if binary.LittleEndian.Uint32(data[bmpFileHeaderSize:]) < bmpInfoHeaderSize {
+		return ErrInvalidBMP
+	}
+	return nil
+}
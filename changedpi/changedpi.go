@@ -5,14 +5,18 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
-	"hash/crc32"
+	"io"
+	"math"
 	"os"
 )
 
 // 常量定义
 const (
-	pngHeader  = "\x89PNG\r\n\x1a\n"
-	jpegHeader = "\xFF\xD8\xFF"
+	pngHeader    = "\x89PNG\r\n\x1a\n"
+	jpegHeader   = "\xFF\xD8\xFF"
+	tiffHeaderLE = "II\x2A\x00"
+	tiffHeaderBE = "MM\x00\x2A"
+	bmpHeader    = "BM"
 
 	// JPEG 相关常量
 	jpegMarkerSOI  = 0xD8 // Start of Image
@@ -20,12 +24,23 @@ const (
 	jpegMarkerAPP0 = 0xE0 // JFIF 应用段
 	jpegMarkerAPP1 = 0xE1 // EXIF 应用段
 
+	// JFIF 相关常量
+	jfifIdentifier = "JFIF\x00"
+	jfifUnitsInch  = 1 // 密度单位：像素/英寸
+
+	// EXIF APP1段标识
+	exifIdentifier = "Exif\x00\x00"
+
 	// TIFF 标签
-	tiffTagXResolution = 0x011A
-	tiffTagYResolution = 0x011B
+	tiffTagXResolution    = 0x011A
+	tiffTagYResolution    = 0x011B
+	tiffTagResolutionUnit = 0x0128
 
 	// DPI 转换系数 (1 inch = 0.0254 meter)
 	dpiToPpmFactor = 39.3700787
+
+	// maxDpi 允许的最大DPI，换算为像素/米后不超过BMP的有符号32位字段，PNG和EXIF RATIONAL也不会溢出
+	maxDpi = math.MaxInt32 / dpiToPpmFactor
 )
 
 // ErrUnsupportedFormat 表示不支持的图片格式
@@ -34,46 +49,41 @@ var (
 	ErrInvalidJPEG        = errors.New("无效的JPEG文件")
 	ErrInvalidJPEGSegment = errors.New("无效的JPEG段")
 	ErrInvalidPNG         = errors.New("无效的PNG文件")
+	ErrInvalidPNGCRC      = errors.New("PNG chunk CRC校验失败")
+	ErrInvalidTIFF        = errors.New("无效的TIFF文件")
+	ErrInvalidWebP        = errors.New("无效的WebP文件")
+	ErrInvalidBMP         = errors.New("无效的BMP文件")
+	ErrInvalidDpi         = errors.New("DPI必须大于0且不超过最大值")
+	ErrTIFFOffsetOverflow = errors.New("TIFF数据块偏移超出SHORT类型范围")
 )
 
 // ChangeDpi 修改图片的DPI
 // inputPath: 输入图片路径
 // outputPath: 输出图片路径
 // dpi: 目标DPI值
+// 图片格式根据文件内容判断，与扩展名无关
 func ChangeDpi(inputPath, outputPath string, dpi int) error {
-	// 检查图片格式
-	_, err := IsImage(inputPath)
-	if err != nil {
-		return ErrUnsupportedFormat
-	}
+	return ChangeDpiXY(inputPath, outputPath, float64(dpi), float64(dpi))
+}
 
+// ChangeDpiXY 分别修改图片水平和垂直方向的DPI
+// inputPath: 输入图片路径
+// outputPath: 输出图片路径
+// xdpi: 水平方向DPI，支持小数
+// ydpi: 垂直方向DPI，支持小数
+func ChangeDpiXY(inputPath, outputPath string, xdpi, ydpi float64) error {
 	// 读取图片数据
 	imgData, err := os.ReadFile(inputPath)
 	if err != nil {
 		return fmt.Errorf("读取图片失败: %w", err)
 	}
 
-	// 验证图片内部格式
-	imgType, err := checkImageType(imgData)
+	// 修改DPI
+	newData, err := ChangeDpiBytesXY(imgData, xdpi, ydpi)
 	if err != nil {
 		return err
 	}
 
-	// 根据图片类型修改DPI
-	var newData []byte
-	switch imgType {
-	case JPEG, JPG:
-		newData, err = changeDpiByJpeg(imgData, dpi)
-	case PNG:
-		newData, err = changeDpiByPng(imgData, dpi)
-	default:
-		return ErrUnsupportedFormat
-	}
-
-	if err != nil {
-		return fmt.Errorf("修改DPI失败: %w", err)
-	}
-
 	// 写入输出文件
 	if err = SaveBytes(outputPath, newData); err != nil {
 		return fmt.Errorf("保存图片失败: %w", err)
@@ -82,74 +92,97 @@ func ChangeDpi(inputPath, outputPath string, dpi int) error {
 	return nil
 }
 
-// changeDpiByPng 修改PNG图片的DPI
-func changeDpiByPng(data []byte, dpi int) ([]byte, error) {
-	return insertOrReplacePhysChunk(data, float64(dpi))
+// ChangeDpiStream 从r读取图片，修改DPI后写入w
+// r: 输入图片数据流
+// w: 输出数据流
+// dpi: 目标DPI值
+func ChangeDpiStream(r io.Reader, w io.Writer, dpi int) error {
+	return ChangeDpiStreamXY(r, w, float64(dpi), float64(dpi))
 }
 
-// dpiToPpm 将DPI转换为像素/米
-func dpiToPpm(dpi float64) uint32 {
-	return uint32(dpi * dpiToPpmFactor)
+// ChangeDpiStreamXY 从r读取图片，分别修改水平和垂直方向的DPI后写入w
+func ChangeDpiStreamXY(r io.Reader, w io.Writer, xdpi, ydpi float64) error {
+	imgData, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("读取图片失败: %w", err)
+	}
+
+	newData, err := ChangeDpiBytesXY(imgData, xdpi, ydpi)
+	if err != nil {
+		return err
+	}
+
+	if _, err = w.Write(newData); err != nil {
+		return fmt.Errorf("写入图片失败: %w", err)
+	}
+	return nil
 }
 
-// buildPhysChunk 构造PNG的pHYs chunk
-func buildPhysChunk(dpi float64) []byte {
-	ppm := dpiToPpm(dpi)
-	data := make([]byte, 9)
-	binary.BigEndian.PutUint32(data[0:4], ppm) // X分辨率
-	binary.BigEndian.PutUint32(data[4:8], ppm) // Y分辨率
-	data[8] = 1                                // 单位为米
-
-	chunkType := []byte("pHYs")
-	crc := crc32.ChecksumIEEE(append(chunkType, data...))
-
-	var buf bytes.Buffer
-	binary.Write(&buf, binary.BigEndian, uint32(len(data))) // 长度
-	buf.Write(chunkType)                                    // 类型
-	buf.Write(data)                                         // 数据
-	binary.Write(&buf, binary.BigEndian, crc)               // CRC校验
-	return buf.Bytes()
+// ChangeDpiBytes 在内存中修改图片数据的DPI，返回修改后的数据
+// 图片格式根据数据头部的魔数判断，不会修改传入的data
+// data: 图片数据
+// dpi: 目标DPI值
+func ChangeDpiBytes(data []byte, dpi int) ([]byte, error) {
+	return ChangeDpiBytesXY(data, float64(dpi), float64(dpi))
 }
 
-// insertOrReplacePhysChunk 插入或替换PNG的pHYs chunk
-func insertOrReplacePhysChunk(data []byte, dpi float64) ([]byte, error) {
-	if !bytes.HasPrefix(data, []byte(pngHeader)) {
-		return nil, ErrInvalidPNG
+// ChangeDpiBytesXY 在内存中分别修改图片水平和垂直方向的DPI，返回修改后的数据
+func ChangeDpiBytesXY(data []byte, xdpi, ydpi float64) ([]byte, error) {
+	if !validDpi(xdpi) || !validDpi(ydpi) {
+		return nil, ErrInvalidDpi
 	}
 
-	physChunk := buildPhysChunk(dpi)
-	physMarker := []byte("pHYs")
-	var out bytes.Buffer
+	// 验证图片内部格式
+	imgType, err := checkImageType(data)
+	if err != nil {
+		return nil, err
+	}
 
-	// 查找pHYs的起始位置
-	idx := bytes.Index(data, physMarker)
-	if idx >= 0 {
-		// 替换已有pHYs
-		if idx < 4 {
-			return nil, ErrInvalidPNG
-		}
-		start := idx - 4
-		length := binary.BigEndian.Uint32(data[start:idx])
-		end := idx + 4 + int(length) + 4
-		if end > len(data) {
-			return nil, ErrInvalidPNG
-		}
-		out.Write(data[:start])
-		out.Write(physChunk)
-		out.Write(data[end:])
-	} else {
-		// 插入到第一个IDAT前
-		idatIdx := bytes.Index(data, []byte("IDAT"))
-		if idatIdx < 0 || idatIdx < 4 {
-			return nil, ErrInvalidPNG
-		}
-		insertPos := idatIdx - 4
-		out.Write(data[:insertPos])
-		out.Write(physChunk)
-		out.Write(data[insertPos:])
+	// 根据图片类型修改DPI
+	var newData []byte
+	switch imgType {
+	case JPEG, JPG:
+		newData, err = changeDpiByJpeg(data, xdpi, ydpi)
+	case PNG:
+		newData, err = changeDpiByPng(data, xdpi, ydpi)
+	case TIFF, TIF:
+		newData, err = changeDpiByTiff(data, xdpi, ydpi)
+	case WEBP:
+		newData, err = changeDpiByWebp(data, xdpi, ydpi)
+	case BMP:
+		newData, err = changeDpiByBmp(data, xdpi, ydpi)
+	default:
+		return nil, ErrUnsupportedFormat
 	}
 
-	return out.Bytes(), nil
+	if err != nil {
+		return nil, fmt.Errorf("修改DPI失败: %w", err)
+	}
+	return newData, nil
+}
+
+// validDpi 判断DPI是否大于0且不超过maxDpi，NaN和无穷大无效
+func validDpi(dpi float64) bool {
+	return dpi > 0 && dpi <= maxDpi
+}
+
+// dpiToPpm 将DPI转换为像素/米（四舍五入）
+func dpiToPpm(dpi float64) uint32 {
+	return uint32(math.Round(dpi * dpiToPpmFactor))
+}
+
+// dpiToRational 将DPI转换为EXIF RATIONAL的分子和分母
+// 整数DPI的分母为1，小数DPI按最多4位小数保存
+func dpiToRational(dpi float64) (uint32, uint32) {
+	den := uint32(1)
+	for den < 10000 && math.Abs(dpi*float64(den)-math.Round(dpi*float64(den))) > 1e-6 {
+		den *= 10
+	}
+	// 防止分子溢出
+	for den > 1 && dpi*float64(den) > math.MaxUint32 {
+		den /= 10
+	}
+	return uint32(math.Round(dpi * float64(den))), den
 }
 
 // checkImageType 检查图片二进制数据的类型
@@ -158,113 +191,266 @@ func checkImageType(data []byte) (ImageType, error) {
 		return PNG, nil
 	}
 	if bytes.HasPrefix(data, []byte(jpegHeader)) {
-		if len(data) >= 3 && data[2] == 0xFF {
-			return JPEG, nil
-		}
+		return JPEG, nil
+	}
+	if bytes.HasPrefix(data, []byte(tiffHeaderLE)) || bytes.HasPrefix(data, []byte(tiffHeaderBE)) {
+		return TIFF, nil
+	}
+	if len(data) >= 12 && string(data[0:4]) == "RIFF" && string(data[8:12]) == "WEBP" {
+		return WEBP, nil
+	}
+	if len(data) >= 26 && bytes.HasPrefix(data, []byte(bmpHeader)) {
+		return BMP, nil
 	}
 	return "", ErrUnsupportedFormat
 }
 
 // changeDpiByJpeg 修改JPEG图片的DPI（JFIF或EXIF）
-func changeDpiByJpeg(data []byte, dpi int) ([]byte, error) {
-	// 验证JPEG头
-	if len(data) < 4 || data[0] != 0xFF || data[1] != jpegMarkerSOI {
-		return nil, ErrInvalidJPEG
-	}
-
+// JFIF的密度字段为整数，小数DPI会四舍五入；EXIF使用RATIONAL保存精确值
+// 如果图片中没有JFIF APP0段（例如Go的image/jpeg编码的图片），会在SOI之后插入一个；
+// JFIF只允许1或3个分量，CMYK等其他分量数的图片改为插入只包含分辨率的EXIF APP1段
+func changeDpiByJpeg(data []byte, xdpi, ydpi float64) ([]byte, error) {
 	// 创建副本以避免修改原始数据
 	result := make([]byte, len(data))
 	copy(result, data)
 
 	// 遍历所有段
+	hasJfif, hasExif := false, false
+	var exifOffset, exifLen int
+	var exifSegment []byte
+	err := walkJpegSegments(result, func(marker byte, offset, segLen int) bool {
+		switch marker {
+		case jpegMarkerAPP0: // APP0 (JFIF)
+			if segLen >= 16 && string(result[offset+4:offset+9]) == jfifIdentifier {
+				// 修改JFIF中的单位和X、Y分辨率
+				result[offset+0x0B] = jfifUnitsInch
+				binary.BigEndian.PutUint16(result[offset+0x0C:], jfifDensity(xdpi))
+				binary.BigEndian.PutUint16(result[offset+0x0E:], jfifDensity(ydpi))
+				hasJfif = true
+			}
+		case jpegMarkerAPP1: // APP1 (EXIF)
+			if _, _, ok := exifTiffHeader(result, offset, segLen); ok {
+				hasExif = true
+			}
+			if exifSegment == nil {
+				if seg, ok := buildExifDpiSegment(result, offset, segLen, xdpi, ydpi); ok {
+					exifOffset, exifLen, exifSegment = offset, segLen, seg
+				}
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if exifSegment != nil {
+		// 替换EXIF段，长度可能发生变化
+		withExif := make([]byte, 0, len(result)-exifLen+len(exifSegment))
+		withExif = append(withExif, result[:exifOffset]...)
+		withExif = append(withExif, exifSegment...)
+		withExif = append(withExif, result[exifOffset+exifLen:]...)
+		result = withExif
+	}
+
+	if hasJfif {
+		return result, nil
+	}
+	var insert []byte
+	switch components := jpegComponents(result); {
+	case components == 1 || components == 3:
+		// 在SOI之后插入JFIF APP0段
+		insert = buildJfifSegment(xdpi, ydpi)
+	case exifSegment != nil:
+		return result, nil
+	case hasExif:
+		return nil, ErrInvalidTIFF // 已有的EXIF无法修改，也不能再插入JFIF
+	default:
+		tiff, err := buildTiffResolution(xdpi, ydpi)
+		if err != nil {
+			return nil, err
+		}
+		insert = []byte{0xFF, jpegMarkerAPP1}
+		insert = binary.BigEndian.AppendUint16(insert, uint16(2+len(exifIdentifier)+len(tiff)))
+		insert = append(insert, exifIdentifier...)
+		insert = append(insert, tiff...)
+	}
+	withSeg := make([]byte, 0, len(result)+len(insert))
+	withSeg = append(withSeg, result[:2]...)
+	withSeg = append(withSeg, insert...)
+	withSeg = append(withSeg, result[2:]...)
+	return withSeg, nil
+}
+
+// buildExifDpiSegment 根据APP1段中的EXIF生成修改了DPI的新APP1段
+// 不是EXIF、EXIF无法解析或新段超出JPEG段长度上限时返回false，原段保持不变
+func buildExifDpiSegment(data []byte, offset, segLen int, xdpi, ydpi float64) ([]byte, bool) {
+	tiffStart, _, ok := exifTiffHeader(data, offset, segLen)
+	if !ok {
+		return nil, false
+	}
+	tiff, err := setExifResolution(data[tiffStart:offset+segLen], xdpi, ydpi)
+	if err != nil {
+		return nil, false
+	}
+
+	// 段长度包含长度字段本身和EXIF标识
+	length := 2 + 6 + len(tiff)
+	if length > math.MaxUint16 {
+		return nil, false
+	}
+	seg := make([]byte, 0, 2+length)
+	seg = append(seg, 0xFF, jpegMarkerAPP1)
+	seg = binary.BigEndian.AppendUint16(seg, uint16(length))
+	seg = append(seg, exifIdentifier...)
+	return append(seg, tiff...), true
+}
+
+// jfifDensity 将DPI转换为JFIF的整数密度值
+func jfifDensity(dpi float64) uint16 {
+	density := math.Round(dpi)
+	if density < 1 {
+		density = 1
+	}
+	if density > math.MaxUint16 {
+		density = math.MaxUint16
+	}
+	return uint16(density)
+}
+
+// buildJfifSegment 构造JFIF APP0段，密度单位为英寸
+func buildJfifSegment(xdpi, ydpi float64) []byte {
+	seg := make([]byte, 18)
+	seg[0] = 0xFF
+	seg[1] = jpegMarkerAPP0
+	binary.BigEndian.PutUint16(seg[2:], 16) // 段长度（不含标记）
+	copy(seg[4:9], jfifIdentifier)          // 标识符
+	seg[9] = 1                              // 主版本号
+	seg[10] = 1                             // 次版本号
+	seg[11] = jfifUnitsInch                 // 密度单位
+	binary.BigEndian.PutUint16(seg[12:], jfifDensity(xdpi))
+	binary.BigEndian.PutUint16(seg[14:], jfifDensity(ydpi))
+	// seg[16], seg[17]: 无缩略图
+	return seg
+}
+
+// walkJpegSegments 遍历JPEG中SOS之前的所有段
+// fn的参数为段标记、段起始位置（0xFF处）和段总长度（包含标记），返回false时停止遍历
+func walkJpegSegments(data []byte, fn func(marker byte, offset, segLen int) bool) error {
+	// 验证JPEG头
+	if len(data) < 4 || data[0] != 0xFF || data[1] != jpegMarkerSOI {
+		return ErrInvalidJPEG
+	}
+
 	i := 2
-	for i < len(result) {
-		if result[i] != 0xFF {
-			return nil, ErrInvalidJPEGSegment
+	for i < len(data) {
+		if data[i] != 0xFF || i+1 >= len(data) {
+			return ErrInvalidJPEGSegment
 		}
 
-		marker := result[i+1]
+		marker := data[i+1]
 		if marker == jpegMarkerSOS { // SOS段，图像数据开始
 			break
 		}
 
 		// 段长度包含长度字段本身(2字节)
-		if i+2 >= len(result) {
-			return nil, ErrInvalidJPEGSegment
+		if i+4 > len(data) {
+			return ErrInvalidJPEGSegment
 		}
-		segLen := int(binary.BigEndian.Uint16(result[i+2:])) + 2
-		if i+segLen > len(result) {
-			return nil, ErrInvalidJPEGSegment
+		segLen := int(binary.BigEndian.Uint16(data[i+2:])) + 2
+		if i+segLen > len(data) {
+			return ErrInvalidJPEGSegment
 		}
 
-		segEnd := i + segLen
+		if !fn(marker, i, segLen) {
+			break
+		}
 
-		switch marker {
-		case jpegMarkerAPP0: // APP0 (JFIF)
-			if segLen >= 16 {
-				// 修改JFIF中的X和Y分辨率
-				binary.BigEndian.PutUint16(result[i+0x0C:], uint16(dpi))
-				binary.BigEndian.PutUint16(result[i+0x0E:], uint16(dpi))
-			}
-		case jpegMarkerAPP1: // APP1 (EXIF)
-			updateExifDpi(result, i, segLen, dpi)
+		i += segLen
+	}
+	return nil
+}
+
+// jpegComponents 返回JPEG帧头（SOF）中的颜色分量数，找不到SOF时返回0
+func jpegComponents(data []byte) int {
+	components := 0
+	walkJpegSegments(data, func(marker byte, offset, segLen int) bool {
+		switch {
+		case marker < 0xC0 || marker > 0xCF, marker == 0xC4, marker == 0xC8, marker == 0xCC:
+			return true // 不是SOF：DHT、JPG扩展和DAC与SOF共用这一范围
 		}
+		if segLen >= 10 {
+			components = int(data[offset+9])
+		}
+		return false
+	})
+	return components
+}
 
-		i = segEnd
+// rewriteJpegSegments 移除drop返回true的段，并在开头的APP0/APP1段之后插入insert
+// 插入位置保证JFIF/EXIF仍然位于文件开头
+func rewriteJpegSegments(data []byte, drop func(marker byte, offset, segLen int) bool, insert []byte) ([]byte, error) {
+	insertPos := 2
+	leading := true
+	var removed [][2]int
+	err := walkJpegSegments(data, func(marker byte, offset, segLen int) bool {
+		if drop(marker, offset, segLen) {
+			removed = append(removed, [2]int{offset, offset + segLen})
+			return true
+		}
+		if leading && (marker == jpegMarkerAPP0 || marker == jpegMarkerAPP1) {
+			insertPos = offset + segLen
+		} else {
+			leading = false
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return result, nil
+	result := make([]byte, 0, len(data)+len(insert))
+	pos := 0
+	inserted := false
+	for _, r := range removed {
+		if !inserted && insertPos <= r[0] {
+			result = append(result, data[pos:insertPos]...)
+			result = append(result, insert...)
+			pos, inserted = insertPos, true
+		}
+		result = append(result, data[pos:r[0]]...)
+		pos = r[1]
+	}
+	if !inserted {
+		result = append(result, data[pos:insertPos]...)
+		result = append(result, insert...)
+		pos = insertPos
+	}
+	return append(result, data[pos:]...), nil
 }
 
-// updateExifDpi 更新EXIF中的DPI信息
-func updateExifDpi(data []byte, offset, segLen, dpi int) {
+// exifTiffHeader 解析APP1段中的EXIF头，返回TIFF头的位置和字节序
+func exifTiffHeader(data []byte, offset, segLen int) (int, binary.ByteOrder, bool) {
 	// 检查是否为EXIF段
 	if segLen < 20 || offset+10 > len(data) {
-		return
+		return 0, nil, false
 	}
 
-	if string(data[offset+4:offset+10]) != "Exif\x00\x00" {
-		return
+	if string(data[offset+4:offset+10]) != exifIdentifier {
+		return 0, nil, false
 	}
 
 	// 找到TIFF头
 	tiffStart := offset + 10
 	if tiffStart+8 > len(data) {
-		return
+		return 0, nil, false
 	}
 
 	// 判断字节序
-	var byteOrder binary.ByteOrder
 	if data[tiffStart] == 'I' && data[tiffStart+1] == 'I' {
-		byteOrder = binary.LittleEndian
+		return tiffStart, binary.LittleEndian, true
 	} else if data[tiffStart] == 'M' && data[tiffStart+1] == 'M' {
-		byteOrder = binary.BigEndian
-	} else {
-		return // 无效的TIFF头
-	}
-
-	// 找到第一个IFD
-	ifdOffset := byteOrder.Uint32(data[tiffStart+4:])
-	ifdStart := int(tiffStart) + int(ifdOffset)
-	if ifdStart+2 > len(data) {
-		return
-	}
-
-	numEntries := byteOrder.Uint16(data[ifdStart:])
-	pos := ifdStart + 2
-
-	// 遍历IFD条目
-	for j := 0; j < int(numEntries) && pos+12 <= len(data); j++ {
-		tag := byteOrder.Uint16(data[pos:])
-		if tag == tiffTagXResolution || tag == tiffTagYResolution {
-			// 修改分辨率值
-			valOffset := byteOrder.Uint32(data[pos+8:])
-			valAddr := int(tiffStart) + int(valOffset)
-			if valAddr+8 <= len(data) {
-				byteOrder.PutUint32(data[valAddr:], uint32(dpi))
-				byteOrder.PutUint32(data[valAddr+4:], 1)
-			}
-		}
-		pos += 12
+		return tiffStart, binary.BigEndian, true
 	}
+	return 0, nil, false // 无效的TIFF头
 }
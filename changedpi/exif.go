@@ -0,0 +1,376 @@
+package changedpi
+
+import (
+	"encoding/binary"
+	"math"
+	"sort"
+)
+
+// EXIF 标签
+const (
+	exifTagStripOffsets    = 0x0111
+	exifTagStripByteCounts = 0x0117
+	exifTagTileOffsets     = 0x0144
+	exifTagTileByteCounts  = 0x0145
+	exifTagThumbnailOffset = 0x0201 // JPEGInterchangeFormat
+	exifTagThumbnailLength = 0x0202 // JPEGInterchangeFormatLength
+	exifTagExifIFD         = 0x8769
+	exifTagGPSIFD          = 0x8825
+	exifTagInteropIFD      = 0xA005
+)
+
+// tiffTypeSizes TIFF各数据类型的单个值长度，下标为类型编号
+var tiffTypeSizes = [...]int{
+	1:  1, // BYTE
+	2:  1, // ASCII
+	3:  2, // SHORT
+	4:  4, // LONG
+	5:  8, // RATIONAL
+	6:  1, // SBYTE
+	7:  1, // UNDEFINED
+	8:  2, // SSHORT
+	9:  4, // SLONG
+	10: 8, // SRATIONAL
+	11: 4, // FLOAT
+	12: 8, // DOUBLE
+	13: 4, // IFD
+}
+
+// exifBlobTags 通过偏移+长度引用数据块的标签对
+var exifBlobTags = []struct{ offset, length uint16 }{
+	{exifTagThumbnailOffset, exifTagThumbnailLength},
+	{exifTagStripOffsets, exifTagStripByteCounts},
+	{exifTagTileOffsets, exifTagTileByteCounts},
+}
+
+// exifData 解析后的EXIF（TIFF结构）数据
+// 所有值都已从原偏移处复制出来，写回时重新排列并计算偏移
+type exifData struct {
+	order tiffOrder
+	ifds  []*exifIfd // IFD0、IFD1（缩略图）……
+}
+
+// exifIfd 解析后的IFD
+type exifIfd struct {
+	Entries []*exifEntry
+}
+
+// exifEntry 解析后的IFD条目
+type exifEntry struct {
+	Tag   uint16
+	Type  uint16
+	Count uint32
+	Value []byte   // 按原字节序保存的值
+	Sub   *exifIfd // Exif/GPS/Interop标签指向的子IFD
+	Blobs [][]byte // 缩略图、条带等按偏移引用的数据块
+}
+
+// exifParser 解析EXIF时的状态
+type exifParser struct {
+	data    []byte
+	order   tiffOrder
+	visited map[int]bool // 防止IFD循环引用
+}
+
+// parseExif 解析从TIFF头开始的EXIF数据
+// 无法识别类型或值越界的条目会被丢弃，其余条目原样保留
+func parseExif(data []byte) (*exifData, error) {
+	order, err := tiffByteOrder(data)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &exifParser{data: data, order: order, visited: map[int]bool{}}
+	exif := &exifData{order: order}
+	offset := int(order.Uint32(data[4:]))
+	for offset != 0 {
+		ifd, next, err := p.parseIfd(offset)
+		if err != nil {
+			if len(exif.ifds) > 0 {
+				break // IFD1之后的链损坏时只保留已解析的IFD
+			}
+			return nil, err
+		}
+		exif.ifds = append(exif.ifds, ifd)
+		offset = int(next)
+	}
+	return exif, nil
+}
+
+// parseIfd 解析offset处的IFD及其子IFD
+func (p *exifParser) parseIfd(offset int) (*exifIfd, uint32, error) {
+	if p.visited[offset] {
+		return nil, 0, ErrInvalidTIFF
+	}
+	p.visited[offset] = true
+
+	raw, next, err := readTiffIfd(p.data, p.order, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	ifd := &exifIfd{}
+	for _, r := range raw {
+		if int(r.Type) >= len(tiffTypeSizes) || tiffTypeSizes[r.Type] == 0 {
+			continue
+		}
+		size := int64(r.Count) * int64(tiffTypeSizes[r.Type])
+		entry := &exifEntry{Tag: r.Tag, Type: r.Type, Count: r.Count}
+		if size <= 4 {
+			entry.Value = append([]byte{}, r.Value[:size]...)
+		} else {
+			valAddr := int64(p.order.Uint32(r.Value[:]))
+			if valAddr+size > int64(len(p.data)) {
+				continue
+			}
+			entry.Value = append([]byte{}, p.data[valAddr:valAddr+size]...)
+		}
+
+		switch entry.Tag {
+		case exifTagExifIFD, exifTagGPSIFD, exifTagInteropIFD:
+			if len(entry.Value) != 4 {
+				continue
+			}
+			sub, _, err := p.parseIfd(int(p.order.Uint32(entry.Value)))
+			if err != nil {
+				continue
+			}
+			entry.Sub = sub
+		}
+		ifd.Entries = append(ifd.Entries, entry)
+	}
+
+	p.parseBlobs(ifd)
+	return ifd, next, nil
+}
+
+// parseBlobs 复制IFD中按偏移+长度引用的数据块，无效的标签对会被移除
+func (p *exifParser) parseBlobs(ifd *exifIfd) {
+	for _, pair := range exifBlobTags {
+		offsetEntry, lengthEntry := ifd.entry(pair.offset), ifd.entry(pair.length)
+		if offsetEntry == nil && lengthEntry == nil {
+			continue
+		}
+
+		offsets, lengths := p.uints(offsetEntry), p.uints(lengthEntry)
+		valid := len(offsets) > 0 && len(offsets) == len(lengths)
+		var blobs [][]byte
+		for i := 0; valid && i < len(offsets); i++ {
+			if uint64(offsets[i])+uint64(lengths[i]) > uint64(len(p.data)) {
+				valid = false
+				break
+			}
+			blobs = append(blobs, append([]byte{}, p.data[offsets[i]:offsets[i]+lengths[i]]...))
+		}
+
+		if !valid {
+			ifd.remove(pair.offset)
+			ifd.remove(pair.length)
+			continue
+		}
+		offsetEntry.Blobs = blobs
+	}
+}
+
+// uints 读取SHORT/LONG类型条目的所有值
+func (p *exifParser) uints(entry *exifEntry) []uint32 {
+	if entry == nil {
+		return nil
+	}
+	var values []uint32
+	switch entry.Type {
+	case tiffTypeShort:
+		for i := 0; i+2 <= len(entry.Value); i += 2 {
+			values = append(values, uint32(p.order.Uint16(entry.Value[i:])))
+		}
+	case tiffTypeLong:
+		for i := 0; i+4 <= len(entry.Value); i += 4 {
+			values = append(values, p.order.Uint32(entry.Value[i:]))
+		}
+	}
+	return values
+}
+
+// entry 查找指定标签的条目
+func (ifd *exifIfd) entry(tag uint16) *exifEntry {
+	for _, entry := range ifd.Entries {
+		if entry.Tag == tag {
+			return entry
+		}
+	}
+	return nil
+}
+
+// set 添加或替换条目
+func (ifd *exifIfd) set(entry *exifEntry) {
+	for i, old := range ifd.Entries {
+		if old.Tag == entry.Tag {
+			ifd.Entries[i] = entry
+			return
+		}
+	}
+	ifd.Entries = append(ifd.Entries, entry)
+}
+
+// remove 移除指定标签的条目
+func (ifd *exifIfd) remove(tag uint16) {
+	kept := ifd.Entries[:0]
+	for _, entry := range ifd.Entries {
+		if entry.Tag != tag {
+			kept = append(kept, entry)
+		}
+	}
+	ifd.Entries = kept
+}
+
+// setResolution 设置IFD0中的XResolution/YResolution，单位统一改为英寸
+// 缺少IFD0时会新建一个
+func (e *exifData) setResolution(xdpi, ydpi float64) {
+	if len(e.ifds) == 0 {
+		e.ifds = append(e.ifds, &exifIfd{})
+	}
+	ifd0 := e.ifds[0]
+
+	for _, tag := range []uint16{tiffTagXResolution, tiffTagYResolution} {
+		dpi := xdpi
+		if tag == tiffTagYResolution {
+			dpi = ydpi
+		}
+		num, den := dpiToRational(dpi)
+		value := e.order.AppendUint32(nil, num)
+		value = e.order.AppendUint32(value, den)
+		ifd0.set(&exifEntry{Tag: tag, Type: tiffTypeRational, Count: 1, Value: value})
+	}
+	ifd0.set(&exifEntry{
+		Tag:   tiffTagResolutionUnit,
+		Type:  tiffTypeShort,
+		Count: 1,
+		Value: e.order.AppendUint16(nil, tiffUnitInch),
+	})
+}
+
+// bytes 将EXIF数据重新序列化，所有偏移按新的布局重新计算
+func (e *exifData) bytes() ([]byte, error) {
+	w := &exifWriter{order: e.order}
+	if e.order == tiffOrder(binary.BigEndian) {
+		w.buf = append(w.buf, tiffHeaderBE...)
+	} else {
+		w.buf = append(w.buf, tiffHeaderLE...)
+	}
+	w.buf = append(w.buf, 0, 0, 0, 0)
+
+	// 依次回填IFD链中的偏移
+	nextPos := 4
+	for _, ifd := range e.ifds {
+		offset, pos, err := w.writeIfd(ifd)
+		if err != nil {
+			return nil, err
+		}
+		e.order.PutUint32(w.buf[nextPos:], uint32(offset))
+		nextPos = pos
+	}
+	return w.buf, nil
+}
+
+// exifWriter 序列化EXIF时的状态
+type exifWriter struct {
+	order tiffOrder
+	buf   []byte
+}
+
+// align TIFF要求偏移为偶数
+func (w *exifWriter) align() {
+	if len(w.buf)%2 == 1 {
+		w.buf = append(w.buf, 0)
+	}
+}
+
+// writeIfd 写入IFD及其值、子IFD和数据块，返回IFD的偏移和下一个IFD偏移字段的位置
+// SHORT类型的偏移不能改为LONG，数据块移到64KiB之后时返回ErrTIFFOffsetOverflow
+func (w *exifWriter) writeIfd(ifd *exifIfd) (offset, nextPos int, err error) {
+	sort.SliceStable(ifd.Entries, func(i, j int) bool {
+		return ifd.Entries[i].Tag < ifd.Entries[j].Tag
+	})
+
+	w.align()
+	offset = len(w.buf)
+	w.buf = w.order.AppendUint16(w.buf, uint16(len(ifd.Entries)))
+	entriesPos := len(w.buf)
+	for _, entry := range ifd.Entries {
+		w.buf = w.order.AppendUint16(w.buf, entry.Tag)
+		w.buf = w.order.AppendUint16(w.buf, entry.Type)
+		w.buf = w.order.AppendUint32(w.buf, entry.Count)
+		w.buf = append(w.buf, 0, 0, 0, 0)
+	}
+	nextPos = len(w.buf)
+	w.buf = append(w.buf, 0, 0, 0, 0)
+
+	// 写入值，记录每个条目的值所在位置
+	valuePos := make([]int, len(ifd.Entries))
+	for i, entry := range ifd.Entries {
+		fieldPos := entriesPos + i*12 + 8
+		switch {
+		case entry.Sub != nil:
+			subOffset, _, err := w.writeIfd(entry.Sub)
+			if err != nil {
+				return 0, 0, err
+			}
+			w.order.PutUint32(w.buf[fieldPos:], uint32(subOffset))
+			valuePos[i] = fieldPos
+		case len(entry.Value) <= 4:
+			copy(w.buf[fieldPos:fieldPos+4], entry.Value)
+			valuePos[i] = fieldPos
+		default:
+			w.align()
+			w.order.PutUint32(w.buf[fieldPos:], uint32(len(w.buf)))
+			valuePos[i] = len(w.buf)
+			w.buf = append(w.buf, entry.Value...)
+		}
+	}
+
+	// 写入数据块，并回填偏移条目中的值
+	for i, entry := range ifd.Entries {
+		for j, blob := range entry.Blobs {
+			blobOffset := uint32(len(w.buf))
+			w.buf = append(w.buf, blob...)
+			if entry.Type == tiffTypeShort {
+				if blobOffset > math.MaxUint16 {
+					return 0, 0, ErrTIFFOffsetOverflow
+				}
+				w.order.PutUint16(w.buf[valuePos[i]+j*2:], uint16(blobOffset))
+			} else {
+				w.order.PutUint32(w.buf[valuePos[i]+j*4:], blobOffset)
+			}
+		}
+	}
+	return offset, nextPos, nil
+}
+
+// setExifResolution 设置EXIF数据中的分辨率，返回新的EXIF数据
+// 分辨率标签齐全时原地修改，保证其他数据逐字节不变；否则重建整个EXIF，
+// Orientation、Software、子IFD和IFD1缩略图等内容都会保留
+func setExifResolution(data []byte, xdpi, ydpi float64) ([]byte, error) {
+	result := make([]byte, len(data))
+	copy(result, data)
+	patched, err := patchTiffResolution(result, xdpi, ydpi)
+	if err != nil {
+		return nil, err
+	}
+	if patched {
+		return result, nil
+	}
+
+	exif, err := parseExif(data)
+	if err != nil {
+		return nil, err
+	}
+	exif.setResolution(xdpi, ydpi)
+	return exif.bytes()
+}
+
+// buildTiffResolution 构造只包含分辨率标签的TIFF数据，用于新建EXIF
+func buildTiffResolution(xdpi, ydpi float64) ([]byte, error) {
+	exif := &exifData{order: binary.LittleEndian}
+	exif.setResolution(xdpi, ydpi)
+	return exif.bytes()
+}
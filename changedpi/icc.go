@@ -0,0 +1,270 @@
+package changedpi
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// ICC 相关常量
+const (
+	iccSignature      = "acsp" // ICC配置文件头中的签名，位于偏移36处
+	iccColorSpaceRGB  = "RGB"  // ICC配置文件头偏移16处的色彩空间，去掉末尾空格
+	iccColorSpaceCMYK = "CMYK"
+	iccColorSpaceGray = "GRAY"
+	iccHeaderSize     = 128
+	iccJpegIdentifier = "ICC_PROFILE\x00"
+	iccJpegChunkSize  = 65535 - 2 - len(iccJpegIdentifier) - 2 // 每个APP2段最多容纳的配置文件数据
+	iccPngName        = "ICC profile"
+
+	jpegMarkerAPP2     = 0xE2 // ICC 应用段
+	tiffTagICCProfile  = 0x8773
+	tiffTagPhotometric = 0x0106
+	tiffTypeUndefined  = 7
+	pngCompressionZlib = 0
+)
+
+var (
+	ErrInvalidICCProfile = errors.New("无效的ICC配置文件")
+	ErrICCProfileTooBig  = errors.New("ICC配置文件过大")
+	ErrICCColorSpace     = errors.New("ICC配置文件的色彩空间与图片不匹配")
+)
+
+// EmbedICCProfile 将ICC色彩配置文件嵌入图片，返回修改后的数据
+// PNG写入iCCP chunk（同时移除sRGB），JPEG写入APP2段，TIFF写入标签34675；
+// 图片中已有的配置文件会被替换，不会修改传入的data
+// 配置文件的色彩空间（RGB、CMYK或GRAY）必须与图片一致，否则返回ErrICCColorSpace
+func EmbedICCProfile(data, profile []byte) ([]byte, error) {
+	if len(profile) < iccHeaderSize || string(profile[36:40]) != iccSignature {
+		return nil, ErrInvalidICCProfile
+	}
+
+	imgType, err := checkImageType(data)
+	if err != nil {
+		return nil, err
+	}
+	if space := imageColorSpace(data, imgType); space != "" && space != ICCColorSpace(profile) {
+		return nil, fmt.Errorf("%w: 配置文件为%s，图片为%s", ErrICCColorSpace, ICCColorSpace(profile), space)
+	}
+	switch imgType {
+	case PNG:
+		return embedPngICCProfile(data, profile)
+	case JPEG, JPG:
+		return embedJpegICCProfile(data, profile)
+	case TIFF, TIF:
+		return embedTiffICCProfile(data, profile)
+	}
+	return nil, ErrUnsupportedFormat
+}
+
+// ICCColorSpace 返回ICC配置文件头中的色彩空间，例如"RGB"、"CMYK"、"GRAY"
+// 配置文件过短时返回空字符串
+func ICCColorSpace(profile []byte) string {
+	if len(profile) < iccHeaderSize {
+		return ""
+	}
+	return strings.TrimRight(string(profile[16:20]), " ")
+}
+
+// imageColorSpace 返回图片数据的色彩空间，与ICC配置文件头中的写法相同，无法判断时返回空字符串
+// PNG按IHDR的颜色类型，JPEG按SOF的分量数，TIFF按PhotometricInterpretation判断
+func imageColorSpace(data []byte, imgType ImageType) string {
+	switch imgType {
+	case PNG:
+		chunks, err := ReadChunks(data)
+		if err != nil || len(chunks[0].Data) < 13 {
+			return ""
+		}
+		switch chunks[0].Data[9] {
+		case 0, 4: // 灰度、灰度+透明
+			return iccColorSpaceGray
+		}
+		return iccColorSpaceRGB
+	case JPEG, JPG:
+		switch jpegComponents(data) {
+		case 1:
+			return iccColorSpaceGray
+		case 3:
+			return iccColorSpaceRGB
+		case 4:
+			return iccColorSpaceCMYK
+		}
+	case TIFF, TIF:
+		exif, err := parseExif(data)
+		if err != nil || len(exif.ifds) == 0 {
+			return ""
+		}
+		entry := exif.ifds[0].entry(tiffTagPhotometric)
+		if entry == nil || entry.Type != tiffTypeShort || len(entry.Value) < 2 {
+			return ""
+		}
+		switch exif.order.Uint16(entry.Value) {
+		case 0, 1: // WhiteIsZero、BlackIsZero
+			return iccColorSpaceGray
+		case 2, 3, 6: // RGB、调色板、YCbCr
+			return iccColorSpaceRGB
+		case 5: // Separated
+			return iccColorSpaceCMYK
+		}
+	}
+	return ""
+}
+
+// ReadICCProfile 读取图片中嵌入的ICC配置文件，没有配置文件时返回nil
+func ReadICCProfile(data []byte) ([]byte, error) {
+	imgType, err := checkImageType(data)
+	if err != nil {
+		return nil, err
+	}
+	switch imgType {
+	case PNG:
+		return readPngICCProfile(data)
+	case JPEG, JPG:
+		return readJpegICCProfile(data)
+	case TIFF, TIF:
+		exif, err := parseExif(data)
+		if err != nil || len(exif.ifds) == 0 {
+			return nil, err
+		}
+		if entry := exif.ifds[0].entry(tiffTagICCProfile); entry != nil {
+			return entry.Value, nil
+		}
+		return nil, nil
+	}
+	return nil, ErrUnsupportedFormat
+}
+
+// embedPngICCProfile 在IHDR之后写入iCCP chunk
+func embedPngICCProfile(data, profile []byte) ([]byte, error) {
+	chunks, err := ReadChunks(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// 名称 + 分隔符 + 压缩方式 + zlib压缩的配置文件
+	var buf bytes.Buffer
+	buf.WriteString(iccPngName)
+	buf.WriteByte(0)
+	buf.WriteByte(pngCompressionZlib)
+	zw := zlib.NewWriter(&buf)
+	zw.Write(profile)
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	out := make([]Chunk, 0, len(chunks)+1)
+	for _, chunk := range chunks {
+		switch chunk.Type {
+		case "iCCP", "sRGB": // 规范要求iCCP和sRGB不能同时存在
+			continue
+		}
+		out = append(out, chunk)
+		if chunk.Type == "IHDR" {
+			out = append(out, Chunk{Type: "iCCP", Data: buf.Bytes()})
+		}
+	}
+	return WriteChunks(out), nil
+}
+
+// readPngICCProfile 读取并解压iCCP chunk
+func readPngICCProfile(data []byte) ([]byte, error) {
+	chunks, err := ReadChunks(data)
+	if err != nil {
+		return nil, err
+	}
+	for _, chunk := range chunks {
+		if chunk.Type != "iCCP" {
+			continue
+		}
+		sep := bytes.IndexByte(chunk.Data, 0)
+		if sep < 0 || sep+2 > len(chunk.Data) || chunk.Data[sep+1] != pngCompressionZlib {
+			return nil, ErrInvalidPNG
+		}
+		zr, err := zlib.NewReader(bytes.NewReader(chunk.Data[sep+2:]))
+		if err != nil {
+			return nil, ErrInvalidPNG
+		}
+		defer zr.Close()
+		return io.ReadAll(zr)
+	}
+	return nil, nil
+}
+
+// embedJpegICCProfile 移除已有的ICC APP2段，在APP0/APP1段之后写入新的配置文件
+// 超过单个段上限的配置文件按规范拆分为多个带序号的APP2段
+func embedJpegICCProfile(data, profile []byte) ([]byte, error) {
+	count := (len(profile) + iccJpegChunkSize - 1) / iccJpegChunkSize
+	if count > 255 {
+		return nil, ErrICCProfileTooBig
+	}
+
+	var segments []byte
+	for i := 0; i < count; i++ {
+		part := profile[i*iccJpegChunkSize : min((i+1)*iccJpegChunkSize, len(profile))]
+		segments = append(segments, 0xFF, jpegMarkerAPP2)
+		segments = binary.BigEndian.AppendUint16(segments, uint16(2+len(iccJpegIdentifier)+2+len(part)))
+		segments = append(segments, iccJpegIdentifier...)
+		segments = append(segments, byte(i+1), byte(count))
+		segments = append(segments, part...)
+	}
+
+	return rewriteJpegSegments(data, func(marker byte, offset, segLen int) bool {
+		return isJpegICCSegment(data, marker, offset, segLen)
+	}, segments)
+}
+
+// readJpegICCProfile 按序号拼接APP2段中的ICC配置文件
+func readJpegICCProfile(data []byte) ([]byte, error) {
+	type part struct {
+		seq  byte
+		data []byte
+	}
+	var parts []part
+	err := walkJpegSegments(data, func(marker byte, offset, segLen int) bool {
+		if isJpegICCSegment(data, marker, offset, segLen) {
+			start := offset + 4 + len(iccJpegIdentifier)
+			parts = append(parts, part{seq: data[start], data: data[start+2 : offset+segLen]})
+		}
+		return true
+	})
+	if err != nil || len(parts) == 0 {
+		return nil, err
+	}
+
+	sort.Slice(parts, func(i, j int) bool { return parts[i].seq < parts[j].seq })
+	var profile []byte
+	for _, p := range parts {
+		profile = append(profile, p.data...)
+	}
+	return profile, nil
+}
+
+// isJpegICCSegment 判断是否为ICC配置文件的APP2段
+func isJpegICCSegment(data []byte, marker byte, offset, segLen int) bool {
+	start := offset + 4
+	return marker == jpegMarkerAPP2 && segLen >= 4+len(iccJpegIdentifier)+2 &&
+		string(data[start:start+len(iccJpegIdentifier)]) == iccJpegIdentifier
+}
+
+// embedTiffICCProfile 在IFD0中写入ICC配置文件标签，并重建TIFF结构
+func embedTiffICCProfile(data, profile []byte) ([]byte, error) {
+	exif, err := parseExif(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(exif.ifds) == 0 {
+		return nil, ErrInvalidTIFF
+	}
+	exif.ifds[0].set(&exifEntry{
+		Tag:   tiffTagICCProfile,
+		Type:  tiffTypeUndefined,
+		Count: uint32(len(profile)),
+		Value: append([]byte{}, profile...),
+	})
+	return exif.bytes()
+}
@@ -17,6 +17,10 @@ const (
 	JPEG ImageType = ".jpeg"
 	JPG  ImageType = ".jpg"
 	PNG  ImageType = ".png"
+	TIFF ImageType = ".tiff"
+	TIF  ImageType = ".tif"
+	WEBP ImageType = ".webp"
+	BMP  ImageType = ".bmp"
 )
 
 func LoadImage(path string) (image.Image, error) {
@@ -76,7 +80,8 @@ func SaveBytes(path string, data []byte) error {
 // 判断图片格式
 func IsImage(path string) (ImageType, error) {
 	ext := strings.ToLower(filepath.Ext(path))
-	if ext == string(JPEG) || ext == string(JPG) || ext == string(PNG) {
+	switch ImageType(ext) {
+	case JPEG, JPG, PNG, TIFF, TIF, WEBP, BMP:
 		return ImageType(ext), nil
 	}
 	return "", errors.New("图片格式不支持")
@@ -0,0 +1,544 @@
+package changedpi
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// 元数据相关常量
+const (
+	jpegMarkerCOM  = 0xFE // 注释段
+	jpegMarkerAPP3 = 0xE3
+	jpegMarkerAPPF = 0xEF
+	jpegMarkerAPPE = 0xEE // Adobe 应用段，CMYK图片解码需要
+
+	xmpJpegIdentifier = "http://ns.adobe.com/xap/1.0/\x00"
+	xmpMaxSize        = 65535 - 2 - len(xmpJpegIdentifier) // 标准XMP在单个APP1段中的上限
+	xmpNamespace      = "https://github.com/ibryang/go-utils/ns/metadata/1.0/"
+
+	// MetadataComment 同时写入JPEG COM段和TIFF ImageDescription标签的元数据键
+	MetadataComment = "Comment"
+
+	tiffTagImageDescription = 0x010E
+	tiffTagXMP              = 0x02BC
+	tiffTypeByte            = 1
+	tiffTypeASCII           = 2
+)
+
+var (
+	ErrInvalidMetadataKey = errors.New("元数据键必须为1-79个Latin-1字符")
+	ErrMetadataTooLarge   = errors.New("元数据过大")
+)
+
+// tiffPrivacyTags StripMetadata从TIFF中移除的标签
+var tiffPrivacyTags = []uint16{
+	0x010E, // ImageDescription
+	0x010F, // Make
+	0x0110, // Model
+	0x0131, // Software
+	0x0132, // DateTime
+	0x013B, // Artist
+	0x013C, // HostComputer
+	0x02BC, // XMP
+	0x8298, // Copyright
+	0x83BB, // IPTC
+	0x8649, // Photoshop
+	exifTagExifIFD,
+	exifTagGPSIFD,
+}
+
+// xmpStandardFields 常用的元数据键在XMP标准字段中的对应关系
+var xmpStandardFields = []struct {
+	key, element, container string
+}{
+	{"Title", "dc:title", "rdf:Alt"},
+	{"Author", "dc:creator", "rdf:Seq"},
+	{"Description", "dc:description", "rdf:Alt"},
+	{"Software", "xmp:CreatorTool", ""},
+}
+
+// WriteMetadata 将文本元数据写入图片，返回修改后的数据
+// PNG每个键写入一个tEXt chunk（值不是Latin-1时使用iTXt），键必须是合法的PNG关键字；
+// JPEG写入XMP APP1段，其中"Comment"同时写入COM段；TIFF写入XMP标签700，
+// 其中"Comment"同时写入ImageDescription标签。同名的已有条目会被替换，不会修改传入的data
+func WriteMetadata(data []byte, metadata map[string]string) ([]byte, error) {
+	imgType, err := checkImageType(data)
+	if err != nil {
+		return nil, err
+	}
+	switch imgType {
+	case PNG:
+		return writePngMetadata(data, metadata)
+	case JPEG, JPG:
+		return writeJpegMetadata(data, metadata)
+	case TIFF, TIF:
+		return writeTiffMetadata(data, metadata)
+	}
+	return nil, ErrUnsupportedFormat
+}
+
+// ReadMetadata 读取PNG文本chunk、JPEG XMP/COM段或TIFF XMP/ImageDescription标签中的文本元数据
+func ReadMetadata(data []byte) (map[string]string, error) {
+	imgType, err := checkImageType(data)
+	if err != nil {
+		return nil, err
+	}
+	switch imgType {
+	case PNG:
+		return readPngMetadata(data)
+	case JPEG, JPG:
+		return readJpegMetadata(data)
+	case TIFF, TIF:
+		exif, err := parseExif(data)
+		if err != nil {
+			return nil, err
+		}
+		return readTiffMetadata(exif), nil
+	}
+	return nil, ErrUnsupportedFormat
+}
+
+// StripMetadata 移除图片中的文本、EXIF、XMP、IPTC等元数据，返回修改后的数据
+// DPI（pHYs/JFIF/TIFF分辨率标签）和ICC配置文件等影响显示和打印的信息会保留；
+// JPEG的EXIF被整体移除，Orientation也会随之丢失
+func StripMetadata(data []byte) ([]byte, error) {
+	imgType, err := checkImageType(data)
+	if err != nil {
+		return nil, err
+	}
+	switch imgType {
+	case PNG:
+		chunks, err := ReadChunks(data)
+		if err != nil {
+			return nil, err
+		}
+		kept := make([]Chunk, 0, len(chunks))
+		for _, chunk := range chunks {
+			switch chunk.Type {
+			case "tEXt", "zTXt", "iTXt", "eXIf", "tIME":
+				continue
+			}
+			kept = append(kept, chunk)
+		}
+		return WriteChunks(kept), nil
+	case JPEG, JPG:
+		return rewriteJpegSegments(data, func(marker byte, offset, segLen int) bool {
+			switch {
+			case marker == jpegMarkerCOM, marker == jpegMarkerAPP1:
+				return true
+			case marker == jpegMarkerAPP2:
+				return !isJpegICCSegment(data, marker, offset, segLen)
+			case marker >= jpegMarkerAPP3 && marker <= jpegMarkerAPPF:
+				return marker != jpegMarkerAPPE
+			}
+			return false
+		}, nil)
+	case TIFF, TIF:
+		exif, err := parseExif(data)
+		if err != nil {
+			return nil, err
+		}
+		for _, ifd := range exif.ifds {
+			for _, tag := range tiffPrivacyTags {
+				ifd.remove(tag)
+			}
+		}
+		return exif.bytes()
+	case WEBP:
+		return stripWebpMetadata(data)
+	case BMP:
+		return append([]byte{}, data...), nil
+	}
+	return nil, ErrUnsupportedFormat
+}
+
+// BuildXMP 生成包含元数据的XMP数据包
+// Title/Author/Description/Software同时写入对应的标准字段，便于其他软件显示；
+// 所有键值都完整保存在自定义命名空间中，可嵌入SVG的<metadata>等位置
+func BuildXMP(metadata map[string]string) string {
+	escape := func(s string) string {
+		var buf strings.Builder
+		xml.EscapeText(&buf, []byte(s))
+		return buf.String()
+	}
+
+	var b strings.Builder
+	b.WriteString("<?xpacket begin=\"\uFEFF\" id=\"W5M0MpCehiHzreSzNTczkc9d\"?>\n")
+	b.WriteString("<x:xmpmeta xmlns:x=\"adobe:ns:meta/\">\n")
+	b.WriteString("<rdf:RDF xmlns:rdf=\"http://www.w3.org/1999/02/22-rdf-syntax-ns#\">\n")
+	b.WriteString("<rdf:Description rdf:about=\"\" xmlns:dc=\"http://purl.org/dc/elements/1.1/\"")
+	b.WriteString(" xmlns:xmp=\"http://ns.adobe.com/xap/1.0/\" xmlns:meta=\"" + xmpNamespace + "\">\n")
+
+	for _, field := range xmpStandardFields {
+		value, ok := metadata[field.key]
+		if !ok {
+			continue
+		}
+		b.WriteString("<" + field.element + ">")
+		switch field.container {
+		case "rdf:Alt":
+			b.WriteString("<rdf:Alt><rdf:li xml:lang=\"x-default\">" + escape(value) + "</rdf:li></rdf:Alt>")
+		case "rdf:Seq":
+			b.WriteString("<rdf:Seq><rdf:li>" + escape(value) + "</rdf:li></rdf:Seq>")
+		default:
+			b.WriteString(escape(value))
+		}
+		b.WriteString("</" + field.element + ">\n")
+	}
+
+	b.WriteString("<meta:entries><rdf:Bag>\n")
+	for _, key := range sortedKeys(metadata) {
+		b.WriteString("<rdf:li rdf:parseType=\"Resource\"><meta:key>" + escape(key) + "</meta:key>")
+		b.WriteString("<meta:value>" + escape(metadata[key]) + "</meta:value></rdf:li>\n")
+	}
+	b.WriteString("</rdf:Bag></meta:entries>\n")
+
+	b.WriteString("</rdf:Description>\n</rdf:RDF>\n</x:xmpmeta>\n")
+	b.WriteString("<?xpacket end=\"w\"?>")
+	return b.String()
+}
+
+// parseXMP 读取BuildXMP写入的自定义命名空间中的键值
+func parseXMP(packet []byte) map[string]string {
+	metadata := map[string]string{}
+	decoder := xml.NewDecoder(bytes.NewReader(packet))
+	var key, current string
+	var text strings.Builder
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return metadata
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			if t.Name.Space == xmpNamespace {
+				current = t.Name.Local
+				text.Reset()
+			}
+		case xml.CharData:
+			if current != "" {
+				text.Write(t)
+			}
+		case xml.EndElement:
+			if t.Name.Space != xmpNamespace || current == "" {
+				continue
+			}
+			switch current {
+			case "key":
+				key = text.String()
+			case "value":
+				metadata[key] = text.String()
+			}
+			current = ""
+		}
+	}
+}
+
+// sortedKeys 按字典序返回map的键，保证输出稳定
+func sortedKeys(metadata map[string]string) []string {
+	keys := make([]string, 0, len(metadata))
+	for key := range metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// isPngKeyword 判断是否为合法的PNG关键字：1-79个可打印Latin-1字符，首尾不能是空格
+func isPngKeyword(key string) bool {
+	if !utf8.ValidString(key) || strings.TrimSpace(key) != key {
+		return false
+	}
+	n := 0
+	for _, r := range key {
+		if r < 0x20 || (r > 0x7E && r < 0xA1) || r > 0xFF {
+			return false
+		}
+		n++
+	}
+	return n >= 1 && n <= 79
+}
+
+// toLatin1 将字符串转换为Latin-1编码，包含无法表示的字符时返回false
+func toLatin1(s string) ([]byte, bool) {
+	out := make([]byte, 0, len(s))
+	for _, r := range s {
+		if r > 0xFF || r == 0 || r == utf8.RuneError {
+			return nil, false
+		}
+		out = append(out, byte(r))
+	}
+	return out, true
+}
+
+// fromLatin1 将Latin-1编码的数据转换为字符串
+func fromLatin1(b []byte) string {
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+	return string(runes)
+}
+
+// writePngMetadata 移除同名的文本chunk，在第一个IDAT之前写入新的文本chunk
+func writePngMetadata(data []byte, metadata map[string]string) ([]byte, error) {
+	for key := range metadata {
+		if !isPngKeyword(key) {
+			return nil, ErrInvalidMetadataKey
+		}
+	}
+
+	chunks, err := ReadChunks(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var textChunks []Chunk
+	for _, key := range sortedKeys(metadata) {
+		keyword, _ := toLatin1(key)
+		chunk := Chunk{Type: "tEXt", Data: append(keyword, 0)}
+		if text, ok := toLatin1(metadata[key]); ok {
+			chunk.Data = append(chunk.Data, text...)
+		} else {
+			// iTXt: 关键字\0 压缩标志 压缩方式 语言\0 翻译后的关键字\0 UTF-8文本
+			chunk.Type = "iTXt"
+			chunk.Data = append(chunk.Data, 0, 0, 0, 0)
+			chunk.Data = append(chunk.Data, metadata[key]...)
+		}
+		textChunks = append(textChunks, chunk)
+	}
+
+	out := make([]Chunk, 0, len(chunks)+len(textChunks))
+	inserted := false
+	for _, chunk := range chunks {
+		switch chunk.Type {
+		case "tEXt", "zTXt", "iTXt":
+			if keyword, _, err := parsePngText(chunk); err == nil {
+				if _, ok := metadata[keyword]; ok {
+					continue
+				}
+			}
+		case "IDAT":
+			if !inserted {
+				out = append(out, textChunks...)
+				inserted = true
+			}
+		}
+		out = append(out, chunk)
+	}
+	if !inserted {
+		return nil, ErrInvalidPNG
+	}
+	return WriteChunks(out), nil
+}
+
+// readPngMetadata 读取PNG中的tEXt/zTXt/iTXt chunk
+func readPngMetadata(data []byte) (map[string]string, error) {
+	chunks, err := ReadChunks(data)
+	if err != nil {
+		return nil, err
+	}
+	metadata := map[string]string{}
+	for _, chunk := range chunks {
+		switch chunk.Type {
+		case "tEXt", "zTXt", "iTXt":
+			keyword, text, err := parsePngText(chunk)
+			if err != nil {
+				return nil, err
+			}
+			metadata[keyword] = text
+		}
+	}
+	return metadata, nil
+}
+
+// parsePngText 解析文本chunk，返回关键字和UTF-8文本
+func parsePngText(chunk Chunk) (string, string, error) {
+	sep := bytes.IndexByte(chunk.Data, 0)
+	if sep < 0 {
+		return "", "", ErrInvalidPNG
+	}
+	keyword, rest := fromLatin1(chunk.Data[:sep]), chunk.Data[sep+1:]
+
+	switch chunk.Type {
+	case "tEXt":
+		return keyword, fromLatin1(rest), nil
+	case "zTXt":
+		if len(rest) < 1 {
+			return "", "", ErrInvalidPNG
+		}
+		text, err := inflate(rest[1:])
+		return keyword, fromLatin1(text), err
+	}
+
+	// iTXt
+	if len(rest) < 2 {
+		return "", "", ErrInvalidPNG
+	}
+	compressed := rest[0] == 1
+	rest = rest[2:]
+	for i := 0; i < 2; i++ { // 跳过语言标记和翻译后的关键字
+		sep := bytes.IndexByte(rest, 0)
+		if sep < 0 {
+			return "", "", ErrInvalidPNG
+		}
+		rest = rest[sep+1:]
+	}
+	if compressed {
+		text, err := inflate(rest)
+		return keyword, string(text), err
+	}
+	return keyword, string(rest), nil
+}
+
+// inflate 解压zlib数据
+func inflate(data []byte) ([]byte, error) {
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrInvalidPNG
+	}
+	defer zr.Close()
+	return io.ReadAll(zr)
+}
+
+// writeJpegMetadata 合并已有的XMP元数据后重写XMP段，"Comment"同时重写COM段
+func writeJpegMetadata(data []byte, metadata map[string]string) ([]byte, error) {
+	merged, err := readJpegMetadata(data)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range metadata {
+		merged[key] = value
+	}
+
+	packet := BuildXMP(merged)
+	if len(packet) > xmpMaxSize {
+		return nil, ErrMetadataTooLarge
+	}
+	segments := []byte{0xFF, jpegMarkerAPP1}
+	segments = binary.BigEndian.AppendUint16(segments, uint16(2+len(xmpJpegIdentifier)+len(packet)))
+	segments = append(segments, xmpJpegIdentifier...)
+	segments = append(segments, packet...)
+
+	comment, hasComment := metadata[MetadataComment]
+	if hasComment {
+		if len(comment) > 65535-2 {
+			return nil, ErrMetadataTooLarge
+		}
+		segments = append(segments, 0xFF, jpegMarkerCOM)
+		segments = binary.BigEndian.AppendUint16(segments, uint16(2+len(comment)))
+		segments = append(segments, comment...)
+	}
+
+	return rewriteJpegSegments(data, func(marker byte, offset, segLen int) bool {
+		return isJpegXMPSegment(data, marker, offset, segLen) || (hasComment && marker == jpegMarkerCOM)
+	}, segments)
+}
+
+// readJpegMetadata 读取JPEG XMP段中的键值和COM段中的注释
+func readJpegMetadata(data []byte) (map[string]string, error) {
+	metadata := map[string]string{}
+	err := walkJpegSegments(data, func(marker byte, offset, segLen int) bool {
+		switch {
+		case isJpegXMPSegment(data, marker, offset, segLen):
+			for key, value := range parseXMP(data[offset+4+len(xmpJpegIdentifier) : offset+segLen]) {
+				metadata[key] = value
+			}
+		case marker == jpegMarkerCOM:
+			if _, ok := metadata[MetadataComment]; !ok {
+				metadata[MetadataComment] = string(data[offset+4 : offset+segLen])
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return metadata, nil
+}
+
+// writeTiffMetadata 与已有的XMP合并后写入第一个IFD的XMP标签，"Comment"同时写入ImageDescription
+func writeTiffMetadata(data []byte, metadata map[string]string) ([]byte, error) {
+	exif, err := parseExif(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(exif.ifds) == 0 {
+		return nil, ErrInvalidTIFF
+	}
+
+	merged := readTiffMetadata(exif)
+	for key, value := range metadata {
+		merged[key] = value
+	}
+	packet := BuildXMP(merged)
+	exif.ifds[0].set(&exifEntry{
+		Tag:   tiffTagXMP,
+		Type:  tiffTypeByte,
+		Count: uint32(len(packet)),
+		Value: []byte(packet),
+	})
+
+	if comment, ok := metadata[MetadataComment]; ok {
+		value := append([]byte(comment), 0)
+		exif.ifds[0].set(&exifEntry{
+			Tag:   tiffTagImageDescription,
+			Type:  tiffTypeASCII,
+			Count: uint32(len(value)),
+			Value: value,
+		})
+	}
+	return exif.bytes()
+}
+
+// readTiffMetadata 读取第一个IFD中XMP标签的键值，XMP中没有"Comment"时使用ImageDescription
+func readTiffMetadata(exif *exifData) map[string]string {
+	metadata := map[string]string{}
+	if len(exif.ifds) == 0 {
+		return metadata
+	}
+	if entry := exif.ifds[0].entry(tiffTagXMP); entry != nil {
+		metadata = parseXMP(entry.Value)
+	}
+	if entry := exif.ifds[0].entry(tiffTagImageDescription); entry != nil && metadata[MetadataComment] == "" {
+		metadata[MetadataComment] = strings.TrimRight(string(entry.Value), "\x00")
+	}
+	return metadata
+}
+
+// isJpegXMPSegment 判断是否为XMP的APP1段
+func isJpegXMPSegment(data []byte, marker byte, offset, segLen int) bool {
+	start := offset + 4
+	return marker == jpegMarkerAPP1 && segLen >= 4+len(xmpJpegIdentifier) &&
+		string(data[start:start+len(xmpJpegIdentifier)]) == xmpJpegIdentifier
+}
+
+// stripWebpMetadata 移除WebP中的EXIF和XMP chunk，并清除VP8X中对应的标志
+func stripWebpMetadata(data []byte) ([]byte, error) {
+	chunks, err := readRiffChunks(data)
+	if err != nil {
+		return nil, err
+	}
+	kept := make([]riffChunk, 0, len(chunks))
+	for _, chunk := range chunks {
+		switch chunk.FourCC {
+		case "EXIF", "XMP ":
+			continue
+		case "VP8X":
+			if len(chunk.Data) < 10 {
+				return nil, ErrInvalidWebP
+			}
+			chunk.Data = append([]byte{}, chunk.Data...)
+			chunk.Data[0] &^= webpFlagEXIF | webpFlagXMP
+		}
+		kept = append(kept, chunk)
+	}
+	return writeRiffChunks(kept), nil
+}
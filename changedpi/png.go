@@ -0,0 +1,154 @@
+package changedpi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"math"
+)
+
+// PNG 相关常量
+const (
+	pngChunkHeaderSize = 8 // 长度 + 类型
+	pngChunkCRCSize    = 4
+	pngPhysSize        = 9 // X分辨率 + Y分辨率 + 单位
+	pngUnitMeter       = 1 // pHYs单位：像素/米
+)
+
+// Chunk PNG文件中的一个chunk
+// 读取时已校验CRC，写入时会重新计算CRC
+type Chunk struct {
+	Type string // chunk类型，例如"IHDR"、"pHYs"
+	Data []byte // chunk数据，不包含长度、类型和CRC
+}
+
+// ReadChunks 按顺序读取PNG数据中的所有chunk
+// 会校验文件头和每个chunk的CRC，读到IEND后停止，IEND之后的数据会被忽略
+// 返回的Data直接引用data中的内容
+func ReadChunks(data []byte) ([]Chunk, error) {
+	if !bytes.HasPrefix(data, []byte(pngHeader)) {
+		return nil, ErrInvalidPNG
+	}
+
+	var chunks []Chunk
+	pos := len(pngHeader)
+	for pos < len(data) {
+		if pos+pngChunkHeaderSize > len(data) {
+			return nil, ErrInvalidPNG
+		}
+		length := binary.BigEndian.Uint32(data[pos:])
+		if length > math.MaxInt32 {
+			return nil, ErrInvalidPNG
+		}
+		typeStart := pos + 4
+		dataEnd := typeStart + 4 + int(length)
+		if dataEnd+pngChunkCRCSize > len(data) {
+			return nil, ErrInvalidPNG
+		}
+
+		// CRC覆盖类型和数据
+		crc := binary.BigEndian.Uint32(data[dataEnd:])
+		if crc32.ChecksumIEEE(data[typeStart:dataEnd]) != crc {
+			return nil, ErrInvalidPNGCRC
+		}
+
+		chunk := Chunk{Type: string(data[typeStart : typeStart+4]), Data: data[typeStart+4 : dataEnd]}
+		chunks = append(chunks, chunk)
+		pos = dataEnd + pngChunkCRCSize
+		if chunk.Type == "IEND" {
+			break
+		}
+	}
+
+	if len(chunks) == 0 || chunks[0].Type != "IHDR" {
+		return nil, ErrInvalidPNG
+	}
+	return chunks, nil
+}
+
+// WriteChunks 将chunk写为完整的PNG数据，自动添加文件头、长度和CRC
+func WriteChunks(chunks []Chunk) []byte {
+	size := len(pngHeader)
+	for _, chunk := range chunks {
+		size += pngChunkHeaderSize + len(chunk.Data) + pngChunkCRCSize
+	}
+
+	out := make([]byte, 0, size)
+	out = append(out, pngHeader...)
+	for _, chunk := range chunks {
+		out = binary.BigEndian.AppendUint32(out, uint32(len(chunk.Data)))
+		typeStart := len(out)
+		out = append(out, chunk.Type...)
+		out = append(out, chunk.Data...)
+		out = binary.BigEndian.AppendUint32(out, crc32.ChecksumIEEE(out[typeStart:]))
+	}
+	return out
+}
+
+// changeDpiByPng 修改PNG图片的DPI
+// 已有的pHYs会被移除，新的pHYs按规范放在第一个IDAT之前
+func changeDpiByPng(data []byte, xdpi, ydpi float64) ([]byte, error) {
+	chunks, err := ReadChunks(data)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]Chunk, 0, len(chunks)+1)
+	inserted := false
+	for _, chunk := range chunks {
+		switch chunk.Type {
+		case "pHYs":
+			continue
+		case "IDAT":
+			if !inserted {
+				out = append(out, buildPhysChunk(xdpi, ydpi))
+				inserted = true
+			}
+		}
+		out = append(out, chunk)
+	}
+	if !inserted {
+		return nil, ErrInvalidPNG
+	}
+
+	return WriteChunks(out), nil
+}
+
+// buildPhysChunk 构造PNG的pHYs chunk
+func buildPhysChunk(xdpi, ydpi float64) Chunk {
+	data := make([]byte, pngPhysSize)
+	binary.BigEndian.PutUint32(data[0:4], dpiToPpm(xdpi)) // X分辨率
+	binary.BigEndian.PutUint32(data[4:8], dpiToPpm(ydpi)) // Y分辨率
+	data[8] = pngUnitMeter                                // 单位为米
+	return Chunk{Type: "pHYs", Data: data}
+}
+
+// readDpiByPng 读取PNG pHYs chunk中的DPI
+func readDpiByPng(data []byte) (DpiInfo, error) {
+	chunks, err := ReadChunks(data)
+	if err != nil {
+		return DpiInfo{}, err
+	}
+
+	for _, chunk := range chunks {
+		if chunk.Type != "pHYs" {
+			continue
+		}
+		if len(chunk.Data) != pngPhysSize {
+			return DpiInfo{}, ErrInvalidPNG
+		}
+
+		x := float64(binary.BigEndian.Uint32(chunk.Data[0:4]))
+		y := float64(binary.BigEndian.Uint32(chunk.Data[4:8]))
+		if chunk.Data[8] != pngUnitMeter {
+			return DpiInfo{X: x, Y: y, Unit: UnitNone, Source: SourcePHYs}, nil
+		}
+		return DpiInfo{
+			X:      x / dpiToPpmFactor,
+			Y:      y / dpiToPpmFactor,
+			Unit:   UnitMeter,
+			Source: SourcePHYs,
+		}, nil
+	}
+	return DpiInfo{Source: SourceAbsent}, nil
+}
@@ -0,0 +1,144 @@
+package changedpi
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+)
+
+// DpiUnit 表示图片中分辨率的原始单位
+type DpiUnit string
+
+const (
+	UnitNone       DpiUnit = "none"  // 无单位，仅表示像素宽高比
+	UnitInch       DpiUnit = "inch"  // 像素/英寸
+	UnitCentimeter DpiUnit = "cm"    // 像素/厘米
+	UnitMeter      DpiUnit = "meter" // 像素/米
+)
+
+// DpiSource 表示DPI信息的来源
+type DpiSource string
+
+const (
+	SourcePHYs   DpiSource = "pHYs"      // PNG pHYs chunk
+	SourceJFIF   DpiSource = "JFIF APP0" // JPEG JFIF APP0段
+	SourceEXIF   DpiSource = "EXIF IFD0" // EXIF IFD0中的XResolution/YResolution
+	SourceTIFF   DpiSource = "TIFF IFD0" // TIFF文件IFD0中的XResolution/YResolution
+	SourceBMP    DpiSource = "BMP"       // BMP信息头中的biXPelsPerMeter/biYPelsPerMeter
+	SourceAbsent DpiSource = "absent"    // 图片中没有DPI信息
+)
+
+// DpiInfo 图片的分辨率信息
+// 单位已知时X/Y已换算为DPI；单位为UnitNone时X/Y为原始的宽高比数值
+type DpiInfo struct {
+	X      float64   // 水平方向DPI
+	Y      float64   // 垂直方向DPI
+	Unit   DpiUnit   // 图片中保存的原始单位
+	Source DpiSource // DPI信息的来源
+}
+
+// ReadDpi 读取图片文件的DPI
+func ReadDpi(path string) (DpiInfo, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return DpiInfo{}, fmt.Errorf("读取图片失败: %w", err)
+	}
+	return ReadDpiBytes(data)
+}
+
+// ReadDpiBytes 读取图片数据的DPI
+func ReadDpiBytes(data []byte) (DpiInfo, error) {
+	imgType, err := checkImageType(data)
+	if err != nil {
+		return DpiInfo{}, err
+	}
+
+	switch imgType {
+	case JPEG, JPG:
+		return readDpiByJpeg(data)
+	case PNG:
+		return readDpiByPng(data)
+	case TIFF, TIF:
+		info, ok := readTiffResolution(data)
+		if !ok {
+			return DpiInfo{Source: SourceAbsent}, nil
+		}
+		info.Source = SourceTIFF
+		return info, nil
+	case WEBP:
+		return readDpiByWebp(data)
+	case BMP:
+		return readDpiByBmp(data)
+	}
+	return DpiInfo{}, ErrUnsupportedFormat
+}
+
+// readDpiByJpeg 读取JPEG的DPI
+// 优先使用带单位的JFIF密度，其次使用EXIF，JFIF仅有宽高比时最后使用
+func readDpiByJpeg(data []byte) (DpiInfo, error) {
+	var jfif, exif *DpiInfo
+	err := walkJpegSegments(data, func(marker byte, offset, segLen int) bool {
+		switch marker {
+		case jpegMarkerAPP0:
+			if jfif == nil {
+				jfif = readJfifDpi(data, offset, segLen)
+			}
+		case jpegMarkerAPP1:
+			if exif == nil {
+				exif = readExifDpi(data, offset, segLen)
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return DpiInfo{}, err
+	}
+
+	if jfif != nil && jfif.Unit != UnitNone {
+		return *jfif, nil
+	}
+	if exif != nil {
+		return *exif, nil
+	}
+	if jfif != nil {
+		return *jfif, nil
+	}
+	return DpiInfo{Source: SourceAbsent}, nil
+}
+
+// readJfifDpi 读取JFIF APP0段中的密度
+func readJfifDpi(data []byte, offset, segLen int) *DpiInfo {
+	if segLen < 16 || string(data[offset+4:offset+9]) != jfifIdentifier {
+		return nil
+	}
+
+	x := float64(binary.BigEndian.Uint16(data[offset+0x0C:]))
+	y := float64(binary.BigEndian.Uint16(data[offset+0x0E:]))
+	info := &DpiInfo{X: x, Y: y, Source: SourceJFIF}
+	switch data[offset+0x0B] {
+	case 1:
+		info.Unit = UnitInch
+	case 2:
+		info.Unit = UnitCentimeter
+		info.X *= 2.54
+		info.Y *= 2.54
+	default:
+		info.Unit = UnitNone
+	}
+	return info
+}
+
+// readExifDpi 读取EXIF IFD0中的XResolution/YResolution/ResolutionUnit
+func readExifDpi(data []byte, offset, segLen int) *DpiInfo {
+	tiffStart, _, ok := exifTiffHeader(data, offset, segLen)
+	if !ok {
+		return nil
+	}
+
+	info, ok := readTiffResolution(data[tiffStart : offset+segLen])
+	if !ok {
+		return nil
+	}
+	info.Source = SourceEXIF
+	return &info
+}
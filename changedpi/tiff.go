@@ -0,0 +1,261 @@
+package changedpi
+
+import (
+	"encoding/binary"
+	"sort"
+)
+
+// TIFF 数据类型和取值
+const (
+	tiffTypeShort    = 3
+	tiffTypeLong     = 4
+	tiffTypeRational = 5
+
+	tiffUnitNone       = 1
+	tiffUnitInch       = 2
+	tiffUnitCentimeter = 3
+)
+
+// tiffOrder TIFF数据的字节序，同时支持读取和追加
+type tiffOrder interface {
+	binary.ByteOrder
+	binary.AppendByteOrder
+}
+
+// tiffEntry TIFF IFD条目
+type tiffEntry struct {
+	Tag   uint16
+	Type  uint16
+	Count uint32
+	Value [4]byte // 值本身（不超过4字节时）或值的偏移
+}
+
+// changeDpiByTiff 修改TIFF图片的DPI
+func changeDpiByTiff(data []byte, xdpi, ydpi float64) ([]byte, error) {
+	// 创建副本以避免修改原始数据
+	result := make([]byte, len(data))
+	copy(result, data)
+	return setTiffResolution(result, xdpi, ydpi)
+}
+
+// tiffByteOrder 判断TIFF数据的字节序
+func tiffByteOrder(data []byte) (tiffOrder, error) {
+	if len(data) < 8 {
+		return nil, ErrInvalidTIFF
+	}
+	switch string(data[0:4]) {
+	case tiffHeaderLE:
+		return binary.LittleEndian, nil
+	case tiffHeaderBE:
+		return binary.BigEndian, nil
+	}
+	return nil, ErrInvalidTIFF
+}
+
+// readTiffIfd 读取offset处的IFD，返回所有条目和下一个IFD的偏移
+func readTiffIfd(data []byte, order tiffOrder, offset int) ([]tiffEntry, uint32, error) {
+	if offset < 8 || offset+2 > len(data) {
+		return nil, 0, ErrInvalidTIFF
+	}
+	numEntries := int(order.Uint16(data[offset:]))
+	if offset+2+numEntries*12+4 > len(data) {
+		return nil, 0, ErrInvalidTIFF
+	}
+
+	entries := make([]tiffEntry, numEntries)
+	pos := offset + 2
+	for i := range entries {
+		entries[i].Tag = order.Uint16(data[pos:])
+		entries[i].Type = order.Uint16(data[pos+2:])
+		entries[i].Count = order.Uint32(data[pos+4:])
+		copy(entries[i].Value[:], data[pos+8:pos+12])
+		pos += 12
+	}
+	return entries, order.Uint32(data[pos:]), nil
+}
+
+// setTiffResolution 设置TIFF数据IFD0中的XResolution/YResolution/ResolutionUnit
+// data从TIFF头开始，已有的标签会被原地修改；缺少标签时会在数据末尾追加一个新的IFD0，
+// 原IFD0中的其他条目原样保留，图像条带等数据不需要移动
+func setTiffResolution(data []byte, xdpi, ydpi float64) ([]byte, error) {
+	patched, err := patchTiffResolution(data, xdpi, ydpi)
+	if err != nil || patched {
+		return data, err
+	}
+
+	order, _ := tiffByteOrder(data)
+	ifdStart := int(order.Uint32(data[4:]))
+	entries, next, err := readTiffIfd(data, order, ifdStart)
+	if err != nil {
+		return nil, err
+	}
+	found := findTiffResolution(data, order, entries)
+
+	// 移除无法原地修改的条目，在末尾追加分辨率值和新的IFD0
+	kept := entries[:0]
+	for _, entry := range entries {
+		switch entry.Tag {
+		case tiffTagXResolution, tiffTagYResolution, tiffTagResolutionUnit:
+			if !found[entry.Tag] {
+				continue
+			}
+		}
+		kept = append(kept, entry)
+	}
+	entries = kept
+
+	if len(data)%2 == 1 {
+		data = append(data, 0) // TIFF要求偏移为偶数
+	}
+	for _, tag := range []uint16{tiffTagXResolution, tiffTagYResolution} {
+		if found[tag] {
+			continue
+		}
+		dpi := xdpi
+		if tag == tiffTagYResolution {
+			dpi = ydpi
+		}
+		num, den := dpiToRational(dpi)
+		entry := tiffEntry{Tag: tag, Type: tiffTypeRational, Count: 1}
+		order.PutUint32(entry.Value[:], uint32(len(data)))
+		data = order.AppendUint32(data, num)
+		data = order.AppendUint32(data, den)
+		entries = append(entries, entry)
+	}
+	if !found[tiffTagResolutionUnit] {
+		entry := tiffEntry{Tag: tiffTagResolutionUnit, Type: tiffTypeShort, Count: 1}
+		order.PutUint16(entry.Value[:], tiffUnitInch)
+		entries = append(entries, entry)
+	}
+
+	newIfd := len(data)
+	data = appendTiffIfd(data, order, entries, next)
+	order.PutUint32(data[4:], uint32(newIfd))
+	return data, nil
+}
+
+// patchTiffResolution 原地修改IFD0中已有的分辨率标签
+// 三个标签都存在且类型正确时返回true，否则data中已找到的标签可能已被修改
+func patchTiffResolution(data []byte, xdpi, ydpi float64) (bool, error) {
+	order, err := tiffByteOrder(data)
+	if err != nil {
+		return false, err
+	}
+	ifdStart := int(order.Uint32(data[4:]))
+	entries, _, err := readTiffIfd(data, order, ifdStart)
+	if err != nil {
+		return false, err
+	}
+
+	found := findTiffResolution(data, order, entries)
+	for i, entry := range entries {
+		if !found[entry.Tag] {
+			continue
+		}
+		switch entry.Tag {
+		case tiffTagXResolution, tiffTagYResolution:
+			dpi := xdpi
+			if entry.Tag == tiffTagYResolution {
+				dpi = ydpi
+			}
+			valAddr := int(order.Uint32(entry.Value[:]))
+			num, den := dpiToRational(dpi)
+			order.PutUint32(data[valAddr:], num)
+			order.PutUint32(data[valAddr+4:], den)
+		case tiffTagResolutionUnit:
+			order.PutUint16(data[ifdStart+2+i*12+8:], tiffUnitInch)
+		}
+	}
+	return found[tiffTagXResolution] && found[tiffTagYResolution] && found[tiffTagResolutionUnit], nil
+}
+
+// findTiffResolution 找出可以原地修改的分辨率标签
+// RATIONAL值的偏移超出data时视为缺少该标签，由调用方重建
+func findTiffResolution(data []byte, order tiffOrder, entries []tiffEntry) map[uint16]bool {
+	found := map[uint16]bool{}
+	for _, entry := range entries {
+		switch entry.Tag {
+		case tiffTagXResolution, tiffTagYResolution:
+			valAddr := int64(order.Uint32(entry.Value[:]))
+			if entry.Type == tiffTypeRational && entry.Count == 1 && valAddr+8 <= int64(len(data)) {
+				found[entry.Tag] = true
+			}
+		case tiffTagResolutionUnit:
+			if entry.Type == tiffTypeShort && entry.Count == 1 {
+				found[entry.Tag] = true
+			}
+		}
+	}
+	return found
+}
+
+// appendTiffIfd 将IFD按标签顺序追加到data末尾
+func appendTiffIfd(data []byte, order tiffOrder, entries []tiffEntry, next uint32) []byte {
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Tag < entries[j].Tag
+	})
+	data = order.AppendUint16(data, uint16(len(entries)))
+	for _, entry := range entries {
+		data = order.AppendUint16(data, entry.Tag)
+		data = order.AppendUint16(data, entry.Type)
+		data = order.AppendUint32(data, entry.Count)
+		data = append(data, entry.Value[:]...)
+	}
+	return order.AppendUint32(data, next)
+}
+
+// readTiffResolution 读取TIFF数据IFD0中的分辨率
+// 返回的X/Y已按ResolutionUnit换算为DPI，没有分辨率标签时ok为false
+func readTiffResolution(data []byte) (info DpiInfo, ok bool) {
+	order, err := tiffByteOrder(data)
+	if err != nil {
+		return DpiInfo{}, false
+	}
+	entries, _, err := readTiffIfd(data, order, int(order.Uint32(data[4:])))
+	if err != nil {
+		return DpiInfo{}, false
+	}
+
+	// rational 读取RATIONAL类型的值
+	rational := func(entry tiffEntry) (float64, bool) {
+		valAddr := int(order.Uint32(entry.Value[:]))
+		if entry.Type != tiffTypeRational || valAddr+8 > len(data) {
+			return 0, false
+		}
+		num := order.Uint32(data[valAddr:])
+		den := order.Uint32(data[valAddr+4:])
+		if den == 0 {
+			return 0, false
+		}
+		return float64(num) / float64(den), true
+	}
+
+	info.Unit = UnitInch
+	for _, entry := range entries {
+		switch entry.Tag {
+		case tiffTagXResolution:
+			if v, found := rational(entry); found {
+				info.X = v
+				ok = true
+			}
+		case tiffTagYResolution:
+			if v, found := rational(entry); found {
+				info.Y = v
+				ok = true
+			}
+		case tiffTagResolutionUnit:
+			switch order.Uint16(entry.Value[:]) {
+			case tiffUnitNone:
+				info.Unit = UnitNone
+			case tiffUnitCentimeter:
+				info.Unit = UnitCentimeter
+			}
+		}
+	}
+
+	if info.Unit == UnitCentimeter {
+		info.X *= 2.54
+		info.Y *= 2.54
+	}
+	return info, ok
+}
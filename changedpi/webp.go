@@ -0,0 +1,196 @@
+package changedpi
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// WebP 相关常量
+const (
+	webpHeaderSize = 12 // "RIFF" + 文件长度 + "WEBP"
+
+	// VP8X 标志位
+	webpFlagXMP   = 0x04
+	webpFlagEXIF  = 0x08
+	webpFlagAlpha = 0x10
+)
+
+// riffChunk WebP文件中的一个RIFF chunk
+type riffChunk struct {
+	FourCC string
+	Data   []byte
+}
+
+// readRiffChunks 读取WebP文件中的所有chunk
+func readRiffChunks(data []byte) ([]riffChunk, error) {
+	if len(data) < webpHeaderSize || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, ErrInvalidWebP
+	}
+
+	var chunks []riffChunk
+	pos := webpHeaderSize
+	for pos+8 <= len(data) {
+		size := int(binary.LittleEndian.Uint32(data[pos+4:]))
+		end := pos + 8 + size
+		if size < 0 || end > len(data) {
+			return nil, ErrInvalidWebP
+		}
+		chunks = append(chunks, riffChunk{FourCC: string(data[pos : pos+4]), Data: data[pos+8 : end]})
+		pos = end + size%2 // chunk长度为奇数时有1字节填充
+	}
+	if len(chunks) == 0 {
+		return nil, ErrInvalidWebP
+	}
+	return chunks, nil
+}
+
+// writeRiffChunks 将chunk写回WebP文件
+func writeRiffChunks(chunks []riffChunk) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("RIFF")
+	buf.Write([]byte{0, 0, 0, 0}) // 文件长度，最后回填
+	buf.WriteString("WEBP")
+	for _, chunk := range chunks {
+		buf.WriteString(chunk.FourCC)
+		binary.Write(&buf, binary.LittleEndian, uint32(len(chunk.Data)))
+		buf.Write(chunk.Data)
+		if len(chunk.Data)%2 == 1 {
+			buf.WriteByte(0)
+		}
+	}
+	out := buf.Bytes()
+	binary.LittleEndian.PutUint32(out[4:], uint32(len(out)-8))
+	return out
+}
+
+// webpCanvasSize 从VP8/VP8L图像数据中读取画布尺寸，以及是否带ALPH透明通道chunk
+// VP8L自带透明通道，不设置alpha标志，以兼容golang.org/x/image/webp等严格的解码器
+func webpCanvasSize(chunks []riffChunk) (width, height int, alpha bool, err error) {
+	for _, chunk := range chunks {
+		switch chunk.FourCC {
+		case "ALPH":
+			alpha = true
+		case "VP8 ":
+			// 3字节帧标记 + 起始码 9D 01 2A + 14位宽高
+			if len(chunk.Data) < 10 || !bytes.Equal(chunk.Data[3:6], []byte{0x9D, 0x01, 0x2A}) {
+				return 0, 0, false, ErrInvalidWebP
+			}
+			width = int(binary.LittleEndian.Uint16(chunk.Data[6:]) & 0x3FFF)
+			height = int(binary.LittleEndian.Uint16(chunk.Data[8:]) & 0x3FFF)
+			return width, height, alpha, nil
+		case "VP8L":
+			// 签名0x2F + 14位(宽-1) + 14位(高-1)
+			if len(chunk.Data) < 5 || chunk.Data[0] != 0x2F {
+				return 0, 0, false, ErrInvalidWebP
+			}
+			bits := binary.LittleEndian.Uint32(chunk.Data[1:])
+			width = int(bits&0x3FFF) + 1
+			height = int(bits>>14&0x3FFF) + 1
+			return width, height, false, nil
+		}
+	}
+	return 0, 0, false, ErrInvalidWebP
+}
+
+// buildVP8XChunk 构造VP8X扩展头
+func buildVP8XChunk(flags byte, width, height int) riffChunk {
+	data := make([]byte, 10)
+	data[0] = flags
+	w, h := uint32(width-1), uint32(height-1)
+	data[4], data[5], data[6] = byte(w), byte(w>>8), byte(w>>16)
+	data[7], data[8], data[9] = byte(h), byte(h>>8), byte(h>>16)
+	return riffChunk{FourCC: "VP8X", Data: data}
+}
+
+// splitWebpExif 分离EXIF chunk中可选的"Exif\0\0"前缀和TIFF数据
+func splitWebpExif(data []byte) (prefix, tiff []byte) {
+	if bytes.HasPrefix(data, []byte(exifIdentifier)) {
+		return data[:len(exifIdentifier)], data[len(exifIdentifier):]
+	}
+	return nil, data
+}
+
+// changeDpiByWebp 修改WebP图片EXIF chunk中的DPI
+// 没有EXIF时会新建EXIF chunk，并在需要时补充VP8X扩展头
+func changeDpiByWebp(data []byte, xdpi, ydpi float64) ([]byte, error) {
+	chunks, err := readRiffChunks(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// 生成新的EXIF数据
+	var exifData []byte
+	for _, chunk := range chunks {
+		if chunk.FourCC != "EXIF" {
+			continue
+		}
+		prefix, tiff := splitWebpExif(chunk.Data)
+		newTiff, err := setExifResolution(tiff, xdpi, ydpi)
+		if err != nil {
+			return nil, err
+		}
+		exifData = append(append([]byte{}, prefix...), newTiff...)
+		break
+	}
+	if exifData == nil {
+		var err error
+		if exifData, err = buildTiffResolution(xdpi, ydpi); err != nil {
+			return nil, err
+		}
+	}
+
+	// 按规范顺序重新排列：VP8X在最前，EXIF在图像数据之后、XMP之前
+	var out []riffChunk
+	var xmp []riffChunk
+	if chunks[0].FourCC == "VP8X" {
+		if len(chunks[0].Data) < 10 {
+			return nil, ErrInvalidWebP
+		}
+		vp8x := riffChunk{FourCC: "VP8X", Data: append([]byte{}, chunks[0].Data...)}
+		vp8x.Data[0] |= webpFlagEXIF
+		out = append(out, vp8x)
+	} else {
+		width, height, alpha, err := webpCanvasSize(chunks)
+		if err != nil {
+			return nil, err
+		}
+		var flags byte = webpFlagEXIF
+		if alpha {
+			flags |= webpFlagAlpha
+		}
+		out = append(out, buildVP8XChunk(flags, width, height))
+	}
+	for _, chunk := range chunks {
+		switch chunk.FourCC {
+		case "VP8X", "EXIF":
+			continue
+		case "XMP ":
+			xmp = append(xmp, chunk)
+			continue
+		}
+		out = append(out, chunk)
+	}
+	out = append(out, riffChunk{FourCC: "EXIF", Data: exifData})
+	out = append(out, xmp...)
+
+	return writeRiffChunks(out), nil
+}
+
+// readDpiByWebp 读取WebP图片EXIF chunk中的DPI
+func readDpiByWebp(data []byte) (DpiInfo, error) {
+	chunks, err := readRiffChunks(data)
+	if err != nil {
+		return DpiInfo{}, err
+	}
+	for _, chunk := range chunks {
+		if chunk.FourCC != "EXIF" {
+			continue
+		}
+		_, tiff := splitWebpExif(chunk.Data)
+		if info, ok := readTiffResolution(tiff); ok {
+			info.Source = SourceEXIF
+			return info, nil
+		}
+	}
+	return DpiInfo{Source: SourceAbsent}, nil
+}
@@ -1,11 +1,540 @@
 package example_test
 
 import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"math"
 	"testing"
 
 	"github.com/ibryang/go-utils/changedpi"
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/tiff"
+	"golang.org/x/image/webp"
 )
 
 func TestChangeDpi(t *testing.T) {
 	changedpi.ChangeDpi("./text2svg_colors.png", "./text2svg_colors.png", 300)
 }
+
+// encodeTestImage 生成用于测试的PNG/JPEG数据
+func encodeTestImage(t *testing.T, format string) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case "png":
+		err = png.Encode(&buf, img)
+	case "tiff":
+		err = tiff.Encode(&buf, img, nil)
+	default:
+		err = jpeg.Encode(&buf, img, nil)
+	}
+	if err != nil {
+		t.Fatalf("生成测试图片失败: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestChangeDpiBytes(t *testing.T) {
+	data := encodeTestImage(t, "png")
+	out, err := changedpi.ChangeDpiBytes(data, 300)
+	if err != nil {
+		t.Fatalf("修改DPI失败: %v", err)
+	}
+
+	idx := bytes.Index(out, []byte("pHYs"))
+	if idx < 0 {
+		t.Fatalf("未找到pHYs chunk")
+	}
+	ppm := binary.BigEndian.Uint32(out[idx+4:])
+	if ppm != 11811 {
+		t.Fatalf("pHYs分辨率错误: %d", ppm)
+	}
+	if _, err := png.Decode(bytes.NewReader(out)); err != nil {
+		t.Fatalf("修改后的PNG无法解码: %v", err)
+	}
+
+	if _, err := changedpi.ChangeDpiBytes([]byte("not an image"), 300); err == nil {
+		t.Fatalf("未识别的数据应返回错误")
+	}
+}
+
+func TestChangeDpiStream(t *testing.T) {
+	data := encodeTestImage(t, "jpeg")
+	var out bytes.Buffer
+	if err := changedpi.ChangeDpiStream(bytes.NewReader(data), &out, 300); err != nil {
+		t.Fatalf("修改DPI失败: %v", err)
+	}
+	if _, err := jpeg.Decode(&out); err != nil {
+		t.Fatalf("修改后的JPEG无法解码: %v", err)
+	}
+}
+
+func TestChangeDpiXY(t *testing.T) {
+	data := encodeTestImage(t, "png")
+	out, err := changedpi.ChangeDpiBytesXY(data, 720, 360)
+	if err != nil {
+		t.Fatalf("修改DPI失败: %v", err)
+	}
+	idx := bytes.Index(out, []byte("pHYs"))
+	if idx < 0 {
+		t.Fatalf("未找到pHYs chunk")
+	}
+	xppm := binary.BigEndian.Uint32(out[idx+4:])
+	yppm := binary.BigEndian.Uint32(out[idx+8:])
+	if xppm != 28346 || yppm != 14173 {
+		t.Fatalf("pHYs分辨率错误: %d x %d", xppm, yppm)
+	}
+
+	if _, err := changedpi.ChangeDpiBytesXY(data, 0, 300); err == nil {
+		t.Fatalf("DPI为0时应返回错误")
+	}
+	for _, dpi := range []float64{math.NaN(), math.Inf(1), math.Inf(-1), 1e9, math.MaxUint32} {
+		if _, err := changedpi.ChangeDpiBytesXY(data, 300, dpi); !errors.Is(err, changedpi.ErrInvalidDpi) {
+			t.Errorf("DPI为%v时应返回ErrInvalidDpi，实际: %v", dpi, err)
+		}
+	}
+	if _, err := changedpi.ChangeDpiBytesXY(data, 5e7, 5e7); err != nil {
+		t.Errorf("DPI不超过最大值时不应返回错误: %v", err)
+	}
+}
+
+func TestReadDpi(t *testing.T) {
+	data := encodeTestImage(t, "png")
+	info, err := changedpi.ReadDpiBytes(data)
+	if err != nil {
+		t.Fatalf("读取DPI失败: %v", err)
+	}
+	if info.Source != changedpi.SourceAbsent {
+		t.Fatalf("未写入DPI的图片来源应为absent: %s", info.Source)
+	}
+
+	out, err := changedpi.ChangeDpiBytesXY(data, 720, 360)
+	if err != nil {
+		t.Fatalf("修改DPI失败: %v", err)
+	}
+	info, err = changedpi.ReadDpiBytes(out)
+	if err != nil {
+		t.Fatalf("读取DPI失败: %v", err)
+	}
+	if info.Source != changedpi.SourcePHYs || info.Unit != changedpi.UnitMeter {
+		t.Fatalf("DPI来源错误: %+v", info)
+	}
+	if math.Abs(info.X-720) > 0.05 || math.Abs(info.Y-360) > 0.05 {
+		t.Fatalf("DPI读取错误: %+v", info)
+	}
+}
+
+func TestChangeDpiInsertJfif(t *testing.T) {
+	// Go的image/jpeg不会写入JFIF APP0段
+	data := encodeTestImage(t, "jpeg")
+	out, err := changedpi.ChangeDpiBytes(data, 300)
+	if err != nil {
+		t.Fatalf("修改DPI失败: %v", err)
+	}
+	info, err := changedpi.ReadDpiBytes(out)
+	if err != nil {
+		t.Fatalf("读取DPI失败: %v", err)
+	}
+	if info.Source != changedpi.SourceJFIF || info.Unit != changedpi.UnitInch || info.X != 300 || info.Y != 300 {
+		t.Fatalf("JFIF DPI错误: %+v", info)
+	}
+	if _, err := jpeg.Decode(bytes.NewReader(out)); err != nil {
+		t.Fatalf("修改后的JPEG无法解码: %v", err)
+	}
+
+	// 再次修改时应替换已有的JFIF段，而不是重复插入
+	out2, err := changedpi.ChangeDpiBytesXY(out, 600, 200)
+	if err != nil {
+		t.Fatalf("修改DPI失败: %v", err)
+	}
+	if len(out2) != len(out) {
+		t.Fatalf("重复插入了JFIF段")
+	}
+	info, _ = changedpi.ReadDpiBytes(out2)
+	if info.X != 600 || info.Y != 200 {
+		t.Fatalf("JFIF DPI错误: %+v", info)
+	}
+}
+
+func TestChangeDpiTiffBmpWebp(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+
+	var tiffBuf bytes.Buffer
+	if err := tiff.Encode(&tiffBuf, img, nil); err != nil {
+		t.Fatalf("生成TIFF失败: %v", err)
+	}
+	var bmpBuf bytes.Buffer
+	if err := bmp.Encode(&bmpBuf, img); err != nil {
+		t.Fatalf("生成BMP失败: %v", err)
+	}
+	// 1x1无损WebP
+	webpData, _ := base64.StdEncoding.DecodeString("UklGRhoAAABXRUJQVlA4TA0AAAAvAAAAEAcQERGIiP4HAA==")
+
+	cases := []struct {
+		name   string
+		data   []byte
+		source changedpi.DpiSource
+		decode func([]byte) error
+	}{
+		{"tiff", tiffBuf.Bytes(), changedpi.SourceTIFF, func(b []byte) error { _, err := tiff.Decode(bytes.NewReader(b)); return err }},
+		{"bmp", bmpBuf.Bytes(), changedpi.SourceBMP, func(b []byte) error { _, err := bmp.Decode(bytes.NewReader(b)); return err }},
+		{"webp", webpData, changedpi.SourceEXIF, func(b []byte) error { _, err := webp.Decode(bytes.NewReader(b)); return err }},
+	}
+	for _, c := range cases {
+		out, err := changedpi.ChangeDpiBytesXY(c.data, 720, 360)
+		if err != nil {
+			t.Fatalf("%s: 修改DPI失败: %v", c.name, err)
+		}
+		info, err := changedpi.ReadDpiBytes(out)
+		if err != nil {
+			t.Fatalf("%s: 读取DPI失败: %v", c.name, err)
+		}
+		if info.Source != c.source || math.Abs(info.X-720) > 0.05 || math.Abs(info.Y-360) > 0.05 {
+			t.Fatalf("%s: DPI错误: %+v", c.name, info)
+		}
+		if err := c.decode(out); err != nil {
+			t.Fatalf("%s: 修改后的图片无法解码: %v", c.name, err)
+		}
+	}
+}
+
+func TestPngChunks(t *testing.T) {
+	chunks, err := changedpi.ReadChunks(encodeTestImage(t, "png"))
+	if err != nil {
+		t.Fatalf("读取chunk失败: %v", err)
+	}
+
+	// 在IHDR之后插入内容包含"pHYs"和"IDAT"的tEXt chunk
+	text := changedpi.Chunk{Type: "tEXt", Data: []byte("Comment\x00pHYs IDAT")}
+	chunks = append(chunks[:1], append([]changedpi.Chunk{text}, chunks[1:]...)...)
+	data := changedpi.WriteChunks(chunks)
+
+	out, err := changedpi.ChangeDpiBytes(data, 300)
+	if err != nil {
+		t.Fatalf("修改DPI失败: %v", err)
+	}
+	if _, err := png.Decode(bytes.NewReader(out)); err != nil {
+		t.Fatalf("修改后的PNG无法解码: %v", err)
+	}
+
+	newChunks, err := changedpi.ReadChunks(out)
+	if err != nil {
+		t.Fatalf("读取chunk失败: %v", err)
+	}
+	var types []string
+	for _, chunk := range newChunks {
+		types = append(types, chunk.Type)
+	}
+	if len(types) < 4 || types[1] != "tEXt" || types[2] != "pHYs" || types[3] != "IDAT" {
+		t.Fatalf("pHYs位置错误: %v", types)
+	}
+	if string(newChunks[1].Data) != string(text.Data) {
+		t.Fatalf("tEXt内容被修改: %q", newChunks[1].Data)
+	}
+
+	// 破坏IDAT数据后应校验失败
+	out[len(out)-20] ^= 0xFF
+	if _, err := changedpi.ReadChunks(out); !errors.Is(err, changedpi.ErrInvalidPNGCRC) {
+		t.Fatalf("期望CRC错误, 实际: %v", err)
+	}
+}
+
+// buildTestExif 构造大端EXIF：IFD0包含Orientation、厘米单位和Software，没有分辨率标签；IFD1包含缩略图
+func buildTestExif(thumb []byte) []byte {
+	be := binary.BigEndian
+	const ifd0, software, ifd1 = 8, 50, 58
+	const thumbStart = ifd1 + 2 + 2*12 + 4
+
+	tiff := []byte("MM\x00\x2A")
+	tiff = be.AppendUint32(tiff, ifd0)
+	tiff = be.AppendUint16(tiff, 3)
+	tiff = append(tiff, 0x01, 0x12, 0, 3, 0, 0, 0, 1, 0, 6, 0, 0) // Orientation = 6
+	tiff = append(tiff, 0x01, 0x28, 0, 3, 0, 0, 0, 1, 0, 3, 0, 0) // ResolutionUnit = 厘米
+	tiff = append(tiff, 0x01, 0x31, 0, 2, 0, 0, 0, 8)             // Software
+	tiff = be.AppendUint32(tiff, software)
+	tiff = be.AppendUint32(tiff, ifd1)
+	tiff = append(tiff, "go-test\x00"...)
+	tiff = be.AppendUint16(tiff, 2)
+	tiff = append(tiff, 0x02, 0x01, 0, 4, 0, 0, 0, 1) // JPEGInterchangeFormat
+	tiff = be.AppendUint32(tiff, thumbStart)
+	tiff = append(tiff, 0x02, 0x02, 0, 4, 0, 0, 0, 1) // JPEGInterchangeFormatLength
+	tiff = be.AppendUint32(tiff, uint32(len(thumb)))
+	tiff = be.AppendUint32(tiff, 0)
+	return append(tiff, thumb...)
+}
+
+// readTestIfd 读取大端TIFF中的IFD，返回标签到值字段的映射和下一个IFD的偏移
+func readTestIfd(tiff []byte, offset uint32) (map[uint16][]byte, uint32) {
+	be := binary.BigEndian
+	n := int(be.Uint16(tiff[offset:]))
+	entries := map[uint16][]byte{}
+	for i := 0; i < n; i++ {
+		pos := int(offset) + 2 + i*12
+		entries[be.Uint16(tiff[pos:])] = tiff[pos+8 : pos+12]
+	}
+	return entries, be.Uint32(tiff[int(offset)+2+n*12:])
+}
+
+func TestChangeDpiExifRebuild(t *testing.T) {
+	thumb := []byte("\xFF\xD8thumbnail\xFF\xD9")
+	exif := append([]byte("Exif\x00\x00"), buildTestExif(thumb)...)
+	app1 := []byte{0xFF, 0xE1}
+	app1 = binary.BigEndian.AppendUint16(app1, uint16(len(exif)+2))
+	app1 = append(app1, exif...)
+
+	img := encodeTestImage(t, "jpeg")
+	data := append(append(append([]byte{}, img[:2]...), app1...), img[2:]...)
+
+	out, err := changedpi.ChangeDpiBytesXY(data, 300, 150)
+	if err != nil {
+		t.Fatalf("修改DPI失败: %v", err)
+	}
+	if _, err := jpeg.Decode(bytes.NewReader(out)); err != nil {
+		t.Fatalf("修改后的JPEG无法解码: %v", err)
+	}
+
+	// 插入的JFIF段(18字节)之后是EXIF段
+	if out[20] != 0xFF || out[21] != 0xE1 {
+		t.Fatalf("未找到EXIF段")
+	}
+	segLen := int(binary.BigEndian.Uint16(out[22:]))
+	tiff := out[30 : 22+segLen]
+	be := binary.BigEndian
+
+	ifd0, next := readTestIfd(tiff, be.Uint32(tiff[4:]))
+	rational := func(field []byte) float64 {
+		off := be.Uint32(field)
+		return float64(be.Uint32(tiff[off:])) / float64(be.Uint32(tiff[off+4:]))
+	}
+	if x, y := rational(ifd0[0x011A]), rational(ifd0[0x011B]); x != 300 || y != 150 {
+		t.Fatalf("分辨率错误: %v x %v", x, y)
+	}
+	if unit := be.Uint16(ifd0[0x0128]); unit != 2 {
+		t.Fatalf("分辨率单位错误: %d", unit)
+	}
+	if orientation := be.Uint16(ifd0[0x0112]); orientation != 6 {
+		t.Fatalf("Orientation被修改: %d", orientation)
+	}
+	if off := be.Uint32(ifd0[0x0131]); string(tiff[off:off+8]) != "go-test\x00" {
+		t.Fatalf("Software被修改")
+	}
+
+	if next == 0 {
+		t.Fatalf("IFD1丢失")
+	}
+	ifd1, _ := readTestIfd(tiff, next)
+	thumbOff, thumbLen := be.Uint32(ifd1[0x0201]), be.Uint32(ifd1[0x0202])
+	if !bytes.Equal(tiff[thumbOff:thumbOff+thumbLen], thumb) {
+		t.Fatalf("缩略图被修改")
+	}
+}
+
+// pointResolutionPastEnd 将小端TIFF中IFD0的XResolution/YResolution值偏移改为超出数据末尾
+func pointResolutionPastEnd(tiff []byte) {
+	le := binary.LittleEndian
+	ifd := int(le.Uint32(tiff[4:]))
+	n := int(le.Uint16(tiff[ifd:]))
+	for i := 0; i < n; i++ {
+		pos := ifd + 2 + i*12
+		if tag := le.Uint16(tiff[pos:]); tag == 0x011A || tag == 0x011B {
+			le.PutUint32(tiff[pos+8:], 0xFFFF)
+		}
+	}
+}
+
+func TestChangeDpiResolutionOffsetOutOfRange(t *testing.T) {
+	// TIFF：分辨率值偏移超出数据时应重建IFD0，而不是越界写入
+	data := encodeTestImage(t, "tiff")
+	pointResolutionPastEnd(data)
+	out, err := changedpi.ChangeDpiBytesXY(data, 300, 150)
+	if err != nil {
+		t.Fatalf("tiff: 修改DPI失败: %v", err)
+	}
+	if _, err := tiff.Decode(bytes.NewReader(out)); err != nil {
+		t.Fatalf("tiff: 修改后的TIFF无法解码: %v", err)
+	}
+	if info, _ := changedpi.ReadDpiBytes(out); info.X != 300 || info.Y != 150 {
+		t.Fatalf("tiff: DPI错误: %+v", info)
+	}
+
+	// JPEG EXIF：IFD0只有分辨率标签，值偏移都超出EXIF数据
+	exif := []byte("Exif\x00\x00II\x2A\x00\x08\x00\x00\x00")
+	le := binary.LittleEndian
+	exif = le.AppendUint16(exif, 3)
+	for _, entry := range [][3]uint32{{0x011A, 5, 0xFFFF}, {0x011B, 5, 0xFFFF}, {0x0128, 3, 2}} {
+		exif = le.AppendUint16(exif, uint16(entry[0]))
+		exif = le.AppendUint16(exif, uint16(entry[1]))
+		exif = le.AppendUint32(exif, 1)
+		exif = le.AppendUint32(exif, entry[2])
+	}
+	exif = le.AppendUint32(exif, 0)
+	app1 := binary.BigEndian.AppendUint16([]byte{0xFF, 0xE1}, uint16(len(exif)+2))
+	app1 = append(app1, exif...)
+	img := encodeTestImage(t, "jpeg")
+	data = append(append(append([]byte{}, img[:2]...), app1...), img[2:]...)
+
+	out, err = changedpi.ChangeDpiBytesXY(data, 300, 150)
+	if err != nil {
+		t.Fatalf("jpeg: 修改DPI失败: %v", err)
+	}
+	if _, err := jpeg.Decode(bytes.NewReader(out)); err != nil {
+		t.Fatalf("jpeg: 修改后的JPEG无法解码: %v", err)
+	}
+	if info, _ := changedpi.ReadDpiBytes(out); info.X != 300 || info.Y != 150 {
+		t.Fatalf("jpeg: DPI错误: %+v", info)
+	}
+}
+
+func TestEmbedICCProfile(t *testing.T) {
+	// 构造一个带有效文件头签名的配置文件，JPEG需要拆分为两个APP2段
+	profile := make([]byte, 70000)
+	copy(profile[16:], "RGB ")
+	copy(profile[36:], "acsp")
+	for i := 128; i < len(profile); i++ {
+		profile[i] = byte(i)
+	}
+	// withColorSpace 返回色彩空间改为space的配置文件副本
+	withColorSpace := func(space string) []byte {
+		p := append([]byte{}, profile...)
+		copy(p[16:20], space)
+		return p
+	}
+
+	var tiffBuf bytes.Buffer
+	if err := tiff.Encode(&tiffBuf, image.NewRGBA(image.Rect(0, 0, 4, 4)), nil); err != nil {
+		t.Fatalf("生成TIFF失败: %v", err)
+	}
+
+	images := map[string][]byte{
+		"png":  encodeTestImage(t, "png"),
+		"jpeg": encodeTestImage(t, "jpeg"),
+		"tiff": tiffBuf.Bytes(),
+	}
+	for name, data := range images {
+		out, err := changedpi.EmbedICCProfile(data, profile)
+		if err != nil {
+			t.Fatalf("%s: 嵌入ICC配置文件失败: %v", name, err)
+		}
+		// 再次嵌入应替换而不是追加
+		out, err = changedpi.EmbedICCProfile(out, profile)
+		if err != nil {
+			t.Fatalf("%s: 替换ICC配置文件失败: %v", name, err)
+		}
+
+		got, err := changedpi.ReadICCProfile(out)
+		if err != nil {
+			t.Fatalf("%s: 读取ICC配置文件失败: %v", name, err)
+		}
+		if !bytes.Equal(got, profile) {
+			t.Fatalf("%s: ICC配置文件不一致, 长度%d", name, len(got))
+		}
+		if _, _, err := image.Decode(bytes.NewReader(out)); err != nil {
+			t.Fatalf("%s: 嵌入后的图片无法解码: %v", name, err)
+		}
+	}
+
+	if _, err := changedpi.EmbedICCProfile(images["png"], []byte("not a profile")); !errors.Is(err, changedpi.ErrInvalidICCProfile) {
+		t.Fatalf("期望无效配置文件错误, 实际: %v", err)
+	}
+
+	// RGB图片不能嵌入CMYK配置文件，反之亦然
+	cmykProfile := withColorSpace("CMYK")
+	if space := changedpi.ICCColorSpace(cmykProfile); space != "CMYK" {
+		t.Fatalf("色彩空间错误: %q", space)
+	}
+	for name, data := range images {
+		if _, err := changedpi.EmbedICCProfile(data, cmykProfile); !errors.Is(err, changedpi.ErrICCColorSpace) {
+			t.Errorf("%s: RGB图片嵌入CMYK配置文件应返回ErrICCColorSpace, 实际: %v", name, err)
+		}
+	}
+
+	// StripOffsets为SHORT类型的1x1灰度TIFF，配置文件会把条带推到64KiB之后
+	le := binary.LittleEndian
+	shortTiff := []byte("II*\x00\x08\x00\x00\x00")
+	shortTiff = le.AppendUint16(shortTiff, 8)
+	stripOffset := uint16(8 + 2 + 8*12 + 4)
+	for _, tag := range [][2]uint16{{256, 1}, {257, 1}, {258, 8}, {259, 1}, {262, 1}, {273, stripOffset}, {277, 1}, {279, 1}} {
+		shortTiff = le.AppendUint16(shortTiff, tag[0])
+		shortTiff = le.AppendUint16(shortTiff, 3)
+		shortTiff = le.AppendUint32(shortTiff, 1)
+		shortTiff = le.AppendUint16(shortTiff, tag[1])
+		shortTiff = append(shortTiff, 0, 0)
+	}
+	shortTiff = append(shortTiff, 0, 0, 0, 0, 0xFF)
+	grayProfile := withColorSpace("GRAY")
+	if _, err := changedpi.EmbedICCProfile(shortTiff, profile[:1000]); !errors.Is(err, changedpi.ErrICCColorSpace) {
+		t.Fatalf("灰度TIFF嵌入RGB配置文件应返回ErrICCColorSpace, 实际: %v", err)
+	}
+	if _, err := changedpi.EmbedICCProfile(shortTiff, grayProfile[:1000]); err != nil {
+		t.Fatalf("SHORT偏移TIFF嵌入失败: %v", err)
+	}
+	if _, err := changedpi.EmbedICCProfile(shortTiff, grayProfile); !errors.Is(err, changedpi.ErrTIFFOffsetOverflow) {
+		t.Fatalf("期望偏移溢出错误, 实际: %v", err)
+	}
+}
+
+func TestMetadata(t *testing.T) {
+	metadata := map[string]string{
+		"Title":   "订单 #1024",
+		"OrderNo": "1024",
+		"Font":    "Arial",
+		"Comment": "a < b & c",
+	}
+
+	for _, name := range []string{"png", "jpeg", "tiff"} {
+		out, err := changedpi.WriteMetadata(encodeTestImage(t, name), metadata)
+		if err != nil {
+			t.Fatalf("%s: 写入元数据失败: %v", name, err)
+		}
+		// 同名键应被替换
+		out, err = changedpi.WriteMetadata(out, map[string]string{"OrderNo": "2048"})
+		if err != nil {
+			t.Fatalf("%s: 更新元数据失败: %v", name, err)
+		}
+
+		got, err := changedpi.ReadMetadata(out)
+		if err != nil {
+			t.Fatalf("%s: 读取元数据失败: %v", name, err)
+		}
+		for key, want := range metadata {
+			if key == "OrderNo" {
+				want = "2048"
+			}
+			if got[key] != want {
+				t.Fatalf("%s: 元数据%s错误: %q", name, key, got[key])
+			}
+		}
+		if _, _, err := image.Decode(bytes.NewReader(out)); err != nil {
+			t.Fatalf("%s: 写入元数据后的图片无法解码: %v", name, err)
+		}
+
+		stripped, err := changedpi.StripMetadata(out)
+		if err != nil {
+			t.Fatalf("%s: 移除元数据失败: %v", name, err)
+		}
+		if got, _ := changedpi.ReadMetadata(stripped); len(got) != 0 {
+			t.Fatalf("%s: 元数据未被移除: %v", name, got)
+		}
+		if _, _, err := image.Decode(bytes.NewReader(stripped)); err != nil {
+			t.Fatalf("%s: 移除元数据后的图片无法解码: %v", name, err)
+		}
+	}
+
+	if _, err := changedpi.WriteMetadata(encodeTestImage(t, "png"), map[string]string{"": "x"}); !errors.Is(err, changedpi.ErrInvalidMetadataKey) {
+		t.Fatalf("期望无效键错误, 实际: %v", err)
+	}
+	// XMP可以保存任意UTF-8键
+	out, err := changedpi.WriteMetadata(encodeTestImage(t, "jpeg"), map[string]string{"订单号": "1024"})
+	if err != nil {
+		t.Fatalf("JPEG写入UTF-8键失败: %v", err)
+	}
+	if got, _ := changedpi.ReadMetadata(out); got["订单号"] != "1024" {
+		t.Fatalf("UTF-8键读取错误: %v", got)
+	}
+}
@@ -0,0 +1,559 @@
+package example_test
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/ibryang/go-utils/fontcache"
+	"github.com/tdewolff/canvas"
+	"github.com/tdewolff/canvas/renderers"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+func TestFontCache(t *testing.T) {
+	registry := fontcache.New(2)
+	if err := registry.Register("GoRegular", goregular.TTF); err != nil {
+		t.Fatalf("注册字体失败: %v", err)
+	}
+	if err := registry.Register("GoBold", gobold.TTF); err != nil {
+		t.Fatalf("注册字体失败: %v", err)
+	}
+	if err := registry.Register("Empty", nil); err != fontcache.ErrEmptyFontData {
+		t.Errorf("空字体数据应返回ErrEmptyFontData，实际: %v", err)
+	}
+
+	// 并发加载同一字体应得到同一个实例
+	fonts := make([]*canvas.Font, 8)
+	var wg sync.WaitGroup
+	for i := range fonts {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			font, err := registry.Load("GoRegular", canvas.FontRegular)
+			if err != nil {
+				t.Errorf("加载字体失败: %v", err)
+				return
+			}
+			fonts[i] = font
+		}(i)
+	}
+	wg.Wait()
+	for _, font := range fonts[1:] {
+		if font != fonts[0] {
+			t.Fatal("并发加载应复用同一个字体实例")
+		}
+	}
+
+	// 超出容量时淘汰最近最少使用的字体
+	if err := registry.Preload(canvas.FontRegular, "GoBold"); err != nil {
+		t.Fatalf("预加载字体失败: %v", err)
+	}
+	if _, err := registry.Load("GoBold", canvas.FontBold); err != nil {
+		t.Fatalf("加载字体失败: %v", err)
+	}
+	if registry.Len() != 2 {
+		t.Errorf("缓存数量应为2，实际: %d", registry.Len())
+	}
+	font, _ := registry.Load("GoRegular", canvas.FontRegular)
+	if font == fonts[0] {
+		t.Error("超出容量的字体应被淘汰")
+	}
+
+	registry.Evict("GoRegular")
+	if registry.Len() != 1 {
+		t.Errorf("淘汰后缓存数量应为1，实际: %d", registry.Len())
+	}
+	registry.Unregister("GoBold")
+	if registry.Len() != 0 {
+		t.Errorf("移除注册后缓存数量应为0，实际: %d", registry.Len())
+	}
+}
+
+// countingFS 记录Open调用次数的文件系统
+type countingFS struct {
+	fsys  fs.FS
+	opens int
+}
+
+func (c *countingFS) Open(name string) (fs.File, error) {
+	c.opens++
+	return c.fsys.Open(name)
+}
+
+func TestFontCacheData(t *testing.T) {
+	registry := fontcache.New(0)
+	fsys := fstest.MapFS{"fonts/Go-Regular.ttf": {Data: goregular.TTF}}
+
+	font, err := registry.LoadBytes(goregular.TTF, canvas.FontRegular)
+	if err != nil {
+		t.Fatalf("从内存加载字体失败: %v", err)
+	}
+	fsFont, err := registry.LoadFS(fsys, "fonts/Go-Regular.ttf", canvas.FontRegular)
+	if err != nil {
+		t.Fatalf("从fs.FS加载字体失败: %v", err)
+	}
+	readerFont, err := registry.LoadReader(bytes.NewReader(goregular.TTF), canvas.FontRegular)
+	if err != nil {
+		t.Fatalf("从io.Reader加载字体失败: %v", err)
+	}
+	if fsFont != font || readerFont != font {
+		t.Error("相同内容的字体数据应共用同一个缓存项")
+	}
+	if registry.Len() != 1 {
+		t.Errorf("缓存数量应为1，实际: %d", registry.Len())
+	}
+
+	// 可比较的文件系统按文件系统和路径缓存，命中缓存时不读取文件
+	counting := &countingFS{fsys: fsys}
+	for i := 0; i < 3; i++ {
+		if _, err := registry.LoadFS(counting, "fonts/Go-Regular.ttf", canvas.FontRegular); err != nil {
+			t.Fatalf("从fs.FS加载字体失败: %v", err)
+		}
+	}
+	if counting.opens != 1 {
+		t.Errorf("命中缓存时不应读取文件，实际读取%d次", counting.opens)
+	}
+	if _, err := registry.LoadFS(counting, "fonts/Go-Regular.ttf", canvas.FontBold); err != nil || counting.opens != 2 {
+		t.Errorf("不同样式应分别缓存: %v, 读取%d次", err, counting.opens)
+	}
+
+	if _, err := registry.LoadFS(fsys, "fonts/missing.ttf", canvas.FontRegular); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("读取不存在的字体应返回fs.ErrNotExist，实际: %v", err)
+	}
+	if _, err := registry.LoadBytes(nil, canvas.FontRegular); err != fontcache.ErrEmptyFontData {
+		t.Errorf("空字体数据应返回ErrEmptyFontData，实际: %v", err)
+	}
+}
+
+func TestScanFonts(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "Go-Regular.ttf"), goregular.TTF, 0644)
+	os.WriteFile(filepath.Join(dir, "Go-Bold.ttf"), gobold.TTF, 0644)
+	os.WriteFile(filepath.Join(dir, "broken.ttf"), []byte("not a font"), 0644)
+
+	index := fontcache.ScanFonts(dir, filepath.Join(dir, "missing"))
+	if len(index.Fonts()) != 2 {
+		t.Fatalf("应索引2个字体，实际: %d", len(index.Fonts()))
+	}
+
+	bold, ok := index.Match(700, false, "Arial", "go")
+	if !ok || bold.Family != "Go" || bold.Weight <= 400 {
+		t.Errorf("应按字重匹配到Go Bold，实际: %+v", bold)
+	}
+	if !bold.Covers('A') || bold.Covers('中') {
+		t.Error("字符覆盖范围不正确")
+	}
+
+	fallbacks := index.Fallbacks("Go 中文")
+	if len(fallbacks) != 1 || fallbacks[0].Weight != 400 {
+		t.Errorf("应只选择常规字重的Go字体作为回退，实际: %+v", fallbacks)
+	}
+	if font, err := fontcache.New(0).LoadInfo(fallbacks[0], canvas.FontRegular); err != nil || font.GlyphIndex('G') == 0 {
+		t.Errorf("加载索引中的字体失败: %v", err)
+	}
+}
+
+func TestFontStyle(t *testing.T) {
+	if style := fontcache.Style(700, true); style != canvas.FontBold|canvas.FontItalic {
+		t.Errorf("字重700斜体应为FontBold|FontItalic，实际: %v", style)
+	}
+	if style := fontcache.Style(0, false); style != canvas.FontRegular {
+		t.Errorf("未指定字重应为FontRegular，实际: %v", style)
+	}
+	if s := (fontcache.Variations{"wght": 700, "wdth": 75.5}).String(); s != "wdth=75.5,wght=700" {
+		t.Errorf("可变字体轴格式化不正确: %s", s)
+	}
+
+	// 按字体名称查找时选择字重最接近的字体
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "Go-Regular.ttf"), goregular.TTF, 0644)
+	os.WriteFile(filepath.Join(dir, "Go-Bold.ttf"), gobold.TTF, 0644)
+	fontcache.RescanSystemFonts(dir)
+	t.Cleanup(func() { fontcache.RescanSystemFonts() })
+
+	registry := fontcache.New(0)
+	bold, err := registry.LoadSource(fontcache.Source{Path: "Go"}, fontcache.Style(700, false), nil, nil)
+	if err != nil {
+		t.Fatalf("按名称加载粗体失败: %v", err)
+	}
+	if bold.OS2 == nil || bold.OS2.UsWeightClass <= 400 {
+		t.Fatal("应加载Go Bold")
+	}
+	face := fontcache.Face(bold, 12, int(bold.OS2.UsWeightClass), true)
+	if face.FauxBold != 0 || face.FauxItalic == 0 {
+		t.Errorf("粗体字体不应使用伪粗体，非斜体字体应使用伪斜体: %v %v", face.FauxBold, face.FauxItalic)
+	}
+
+	// 字体缺少对应字重时使用伪粗体
+	regular, err := registry.LoadBytes(goregular.TTF, canvas.FontRegular)
+	if err != nil {
+		t.Fatalf("加载字体失败: %v", err)
+	}
+	if face := fontcache.Face(regular, 12, 700, false); face.FauxBold <= 0 || face.FauxItalic != 0 {
+		t.Errorf("常规字体要求粗体时应使用伪粗体: %v %v", face.FauxBold, face.FauxItalic)
+	}
+	if face := fontcache.Face(regular, 12, 0, false); face.FauxBold != 0 {
+		t.Error("未指定字重时不应使用伪粗体")
+	}
+}
+
+func TestShapeClusters(t *testing.T) {
+	if s := (fontcache.Features{"liga": 0, "smcp": 1, "kern": 1}).String(); s != "kern=1,liga=0,smcp=1" {
+		t.Errorf("OpenType特性格式化不正确: %s", s)
+	}
+
+	font, err := fontcache.New(0).LoadBytes(goregular.TTF, canvas.FontRegular)
+	if err != nil {
+		t.Fatalf("加载字体失败: %v", err)
+	}
+	text := "AV fi"
+	clusters, err := fontcache.ShapeClusters(font.Face(12), text)
+	if err != nil {
+		t.Fatalf("排版失败: %v", err)
+	}
+
+	// 字形簇按顺序覆盖整段文本，位置由整体排版的前进宽度累加得到
+	var joined string
+	var x float64
+	for _, cluster := range clusters {
+		joined += cluster.Text
+		if math.Abs(cluster.X-x) > 1e-9 {
+			t.Errorf("字形簇%q的位置应为%v，实际: %v", cluster.Text, x, cluster.X)
+		}
+		if cluster.Text == " " && !cluster.Path.Empty() {
+			t.Error("空格不应有轮廓")
+		}
+		x += cluster.Advance
+	}
+	if joined != text {
+		t.Errorf("字形簇应覆盖整段文本，实际: %q", joined)
+	}
+
+	runs := fontcache.SplitRuns([]*canvas.Font{font}, "Go 中文")
+	if len(runs) != 1 || runs[0].Font != 0 || runs[0].Text != "Go 中文" {
+		t.Errorf("缺少字形的字符应使用第一个字体，实际: %+v", runs)
+	}
+}
+
+func TestBidi(t *testing.T) {
+	tests := []struct {
+		name, text string
+		levels     []int
+	}{
+		{"数字", "abc אבג 123", []int{0, 0, 0, 0, 1, 1, 1, 1, 2, 2, 2}},
+		{"嵌套隔离", "x\u2067א\u2066bc\u2069ב\u2069y", []int{0, 0, 1, 1, 2, 2, 1, 1, 0, 0}},
+		{"覆盖", "\u202Eabc\u202C", []int{0, 1, 1, 1, 0}},
+		{"嵌套嵌入", "a\u202Bb \u202Aג\u202C\u202C", []int{0, 0, 2, 2, 2, 3, 0, 0}},
+		{"括号", "א a (b ב) ג", []int{1, 1, 2, 1, 1, 2, 1, 1, 1, 1, 1}},
+		{"多个段落", "א a\u2029b א", []int{1, 1, 2, 1, 0, 0, 1}},
+	}
+	for _, tt := range tests {
+		if levels := fontcache.BidiLevels(tt.text); !reflect.DeepEqual(levels, tt.levels) {
+			t.Errorf("%s: 嵌入层级应为%v，实际: %v", tt.name, tt.levels, levels)
+		}
+	}
+
+	// 按视觉顺序拼接，从右到左的文本段反转，忽略格式控制字符
+	visual := func(s string) string {
+		runes := []rune(s)
+		var out []rune
+		for _, run := range fontcache.BidiRuns(s) {
+			part := append([]rune{}, runes[run.Start:run.End]...)
+			if run.RTL() {
+				slices.Reverse(part)
+			}
+			for _, r := range part {
+				if !unicode.Is(unicode.Cf, r) {
+					out = append(out, r)
+				}
+			}
+		}
+		return string(out)
+	}
+	if got := visual("x\u2067א\u2066bc\u2069ב\u2069y"); got != "xבbcאy" {
+		t.Errorf("嵌套隔离的视觉顺序不正确: %q", got)
+	}
+	if got := visual("א a (b ב) ג"); got != "ג )ב b( a א" {
+		t.Errorf("括号的视觉顺序不正确: %q", got)
+	}
+}
+
+func TestVerticalClusters(t *testing.T) {
+	font, err := fontcache.New(0).LoadBytes(goregular.TTF, canvas.FontRegular)
+	if err != nil {
+		t.Fatalf("加载字体失败: %v", err)
+	}
+	faces := []*canvas.FontFace{font.Face(12)}
+
+	// 拉丁字母整段旋转，两位数字按纵中横排在一格中，字形簇从上到下依次排列
+	clusters, err := fontcache.VerticalClusters(faces, "Go12", fontcache.VerticalOptions{})
+	if err != nil {
+		t.Fatalf("竖排失败: %v", err)
+	}
+	if len(clusters) != 3 || clusters[2].Text != "12" || clusters[2].Start != 2 {
+		t.Fatalf("竖排字形簇不正确: %+v", clusters)
+	}
+	var y float64
+	for _, cluster := range clusters {
+		if math.Abs(cluster.X-y) > 1e-9 {
+			t.Errorf("字形簇%q的位置应为%v，实际: %v", cluster.Text, y, cluster.X)
+		}
+		y += cluster.Advance
+	}
+	// 路径以列中线为x=0，旋转的字母位于自己的前进高度之内
+	if bounds := clusters[0].Path.Bounds(); bounds.Y1 > 1e-9 || bounds.Y0 < -clusters[0].Advance-1e-9 || bounds.X0 >= 0 || bounds.X1 <= 0 {
+		t.Errorf("旋转后的字母应在列中居中，实际: %v", bounds)
+	}
+
+	// 直立排列时每个字母占一格，超过纵中横个数的数字逐个排列
+	clusters, err = fontcache.VerticalClusters(faces, "Go123", fontcache.VerticalOptions{Upright: true})
+	if err != nil {
+		t.Fatalf("竖排失败: %v", err)
+	}
+	if len(clusters) != 5 {
+		t.Errorf("直立排列时每个字符应为一个字形簇，实际: %d", len(clusters))
+	}
+}
+
+func TestSpacing(t *testing.T) {
+	if s := fontcache.Spacing("a", 2, 5); s != 2 {
+		t.Errorf("字符间距应为2，实际: %v", s)
+	}
+	if s := fontcache.Spacing(" ", -1, 5); s != 4 {
+		t.Errorf("空格应额外增加单词间距，实际: %v", s)
+	}
+
+	path := &canvas.Path{}
+	path.MoveTo(0, 0)
+	path.LineTo(2, 0)
+	path.LineTo(2, 1)
+	path.Close()
+	moved := fontcache.CharOffset{X: 1, Y: -1}.Apply(path)
+	if bounds := moved.Bounds(); bounds.X0 != 1 || bounds.Y0 != -1 {
+		t.Errorf("偏移后的路径位置不正确: %v", bounds)
+	}
+	rotated := fontcache.CharOffset{Rotate: 90}.Apply(path).Bounds()
+	if math.Abs(rotated.W()-1) > 1e-9 || math.Abs(rotated.H()-2) > 1e-9 || math.Abs(rotated.X0+rotated.X1-2) > 1e-9 {
+		t.Errorf("应以字形中心旋转，实际: %v", rotated)
+	}
+}
+
+func TestAlongPath(t *testing.T) {
+	font, err := fontcache.New(0).LoadBytes(goregular.TTF, canvas.FontRegular)
+	if err != nil {
+		t.Fatalf("加载字体失败: %v", err)
+	}
+	clusters, err := fontcache.ShapeClusters(font.Face(12), "SEAL")
+	if err != nil {
+		t.Fatalf("排版失败: %v", err)
+	}
+	bounds := func(clusters []fontcache.Cluster) canvas.Rect {
+		p := &canvas.Path{}
+		for _, cluster := range clusters {
+			p = p.Append(cluster.Path.Translate(cluster.X, 0))
+		}
+		return p.Bounds()
+	}
+
+	// 沿水平直线排列时与横排一致，只是整体移动到路径起点
+	flat, err := fontcache.AlongPath(clusters, fontcache.TextPath{Path: "M10 -5 L200 -5"})
+	if err != nil {
+		t.Fatalf("沿路径排列失败: %v", err)
+	}
+	want, got := bounds(clusters), bounds(flat)
+	if math.Abs(got.X0-want.X0-10) > 1e-6 || math.Abs(got.Y0-want.Y0-5) > 1e-6 {
+		t.Errorf("沿直线排列的位置不正确: %v，横排: %v", got, want)
+	}
+
+	// 圆弧顶部居中的文字左右对称，字形位于圆外；底部逆时针排列在内侧时字形位于圆内
+	top, err := fontcache.AlongPath(clusters, fontcache.TextPath{Radius: 50, Align: fontcache.PathAlignCenter})
+	if err != nil {
+		t.Fatalf("沿圆弧排列失败: %v", err)
+	}
+	if b := bounds(top); math.Abs(b.X0+b.X1) > 1 || b.Y0 < 45 {
+		t.Errorf("圆弧顶部的文字应居中且位于圆外: %v", b)
+	}
+	bottom, err := fontcache.AlongPath(clusters, fontcache.TextPath{Radius: 50, StartAngle: 180, CounterClockwise: true, Inside: true, Align: fontcache.PathAlignCenter})
+	if err != nil {
+		t.Fatalf("沿圆弧排列失败: %v", err)
+	}
+	if b := bounds(bottom); b.Y0 < -50.5 || b.Y1 > -35 {
+		t.Errorf("圆弧底部的文字应位于圆内: %v", b)
+	}
+
+	if _, err := fontcache.AlongPath(clusters, fontcache.TextPath{}); err != fontcache.ErrInvalidTextPath {
+		t.Errorf("未设置路径时应返回ErrInvalidTextPath，实际: %v", err)
+	}
+}
+
+func TestWrap(t *testing.T) {
+	// 每个字符宽度为1
+	measure := func(s string) float64 { return float64(utf8.RuneCountInString(s)) }
+	texts := func(lines []fontcache.Line) []string {
+		var result []string
+		for _, line := range lines {
+			result = append(result, line.Text)
+		}
+		return result
+	}
+	tests := []struct {
+		text string
+		opts fontcache.WrapOptions
+		want []string
+	}{
+		{"hello world foo", fontcache.WrapOptions{Width: 11}, []string{"hello world", "foo"}},
+		{"line one\nline two", fontcache.WrapOptions{}, []string{"line one", "line two"}},
+		{"汉字可以在任意位置断行", fontcache.WrapOptions{Width: 4}, []string{"汉字可以", "在任意位", "置断行"}},
+		// 避头尾：句号不能位于行首，开始引号不能位于行尾
+		{"你好世界。再见", fontcache.WrapOptions{Width: 4}, []string{"你好世", "界。再见"}},
+		{"一二三「四五」", fontcache.WrapOptions{Width: 4}, []string{"一二三", "「四五」"}},
+		{"abcdefghij", fontcache.WrapOptions{Width: 4}, []string{"abcd", "efgh", "ij"}},
+		{"one two three four", fontcache.WrapOptions{Width: 9, MaxLines: 1, Ellipsis: "…"}, []string{"one two…"}},
+	}
+	for _, tt := range tests {
+		got := texts(fontcache.Wrap(tt.text, tt.opts, measure))
+		if len(got) != len(tt.want) {
+			t.Errorf("%q换行结果不正确: %q，期望: %q", tt.text, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%q换行结果不正确: %q，期望: %q", tt.text, got, tt.want)
+				break
+			}
+		}
+	}
+
+	lines := fontcache.Wrap("ab cd", fontcache.WrapOptions{Width: 2}, measure)
+	if len(lines) != 2 || lines[1].Start != 3 {
+		t.Errorf("行的起始位置不正确: %+v", lines)
+	}
+}
+
+func TestParsePaint(t *testing.T) {
+	colors := map[string]color.RGBA{"red": {255, 0, 0, 255}, "green": {0, 255, 0, 255}, "blue": {0, 0, 255, 255}}
+	parseColor := func(s string) color.RGBA { return colors[s] }
+
+	paint, err := fontcache.ParsePaint("red", parseColor)
+	if err != nil || paint.Kind != fontcache.PaintSolid || paint.Color != colors["red"] {
+		t.Errorf("纯色解析不正确: %+v, %v", paint, err)
+	}
+
+	// 未指定位置的节点均匀分布
+	paint, err = fontcache.ParsePaint("linear-gradient(to right, red, green, blue 80%)", parseColor)
+	if err != nil {
+		t.Fatalf("解析线性渐变失败: %v", err)
+	}
+	want := []fontcache.ColorStop{{Offset: 0, Color: colors["red"]}, {Offset: 0.4, Color: colors["green"]}, {Offset: 0.8, Color: colors["blue"]}}
+	if paint.Kind != fontcache.PaintLinear || paint.Angle != 90 || len(paint.Stops) != len(want) {
+		t.Fatalf("线性渐变解析不正确: %+v", paint)
+	}
+	for i, stop := range paint.Stops {
+		if math.Abs(stop.Offset-want[i].Offset) > 1e-9 || stop.Color != want[i].Color {
+			t.Errorf("第%d个节点应为%v，实际: %v", i, want[i], stop)
+		}
+	}
+
+	paint, err = fontcache.ParsePaint("radial-gradient(at 25% 75%, red, blue)", parseColor)
+	if err != nil || paint.Kind != fontcache.PaintRadial || paint.CX != -0.25 || paint.CY != -0.25 {
+		t.Errorf("径向渐变解析不正确: %+v, %v", paint, err)
+	}
+
+	// 图片图案
+	path := filepath.Join(t.TempDir(), "wood.png")
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 4, 2))); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	paint, err = fontcache.ParsePaint("url("+path+") 5", parseColor)
+	if err != nil || paint.Kind != fontcache.PaintPattern || paint.TileWidth != 5 || paint.Image.Bounds().Dx() != 4 {
+		t.Errorf("图案解析不正确: %+v, %v", paint, err)
+	}
+	if err := fontcache.CheckStroke(paint); !errors.Is(err, fontcache.ErrPatternStroke) {
+		t.Errorf("图案用于描边应返回ErrPatternStroke，实际: %v", err)
+	}
+	if _, err := fontcache.ParsePaint("url(missing.png)", parseColor); err == nil {
+		t.Error("图案图片不存在时应返回错误")
+	}
+	if _, err := fontcache.ParsePaint("conic-gradient(red, blue)", parseColor); !errors.Is(err, fontcache.ErrInvalidPaint) {
+		t.Errorf("不支持的格式应返回ErrInvalidPaint，实际: %v", err)
+	}
+}
+
+func TestPatternWriters(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	img.Set(0, 0, color.RGBA{255, 0, 0, 255})
+	c := canvas.New(50, 50)
+	ctx := canvas.NewContext(c)
+	path := &canvas.Path{}
+	path.MoveTo(10, 20)
+	path.LineTo(30, 20)
+	path.LineTo(30, 40)
+	path.LineTo(10, 40)
+	path.Close()
+	fontcache.DrawPath(ctx, path, path.Bounds(), fontcache.Paint{Kind: fontcache.PaintPattern, Image: img, TileWidth: 5}, fontcache.Paint{}, 0)
+
+	// 图案按宽度5平铺，从边界框的左上角(10, 40)开始，SVG中y轴向下，左上角为(10, 10)
+	var buf bytes.Buffer
+	if err := c.Write(&buf, fontcache.SVG()); err != nil {
+		t.Fatalf("写出SVG失败: %v", err)
+	}
+	svg := buf.String()
+	for _, want := range []string{
+		`<pattern id="fontcache-pattern-0" patternUnits="userSpaceOnUse" width="4" height="2" patternTransform="matrix(1.25 0 0 1.25 10 10)">`,
+		`fill="url(#fontcache-pattern-0)"`,
+		`<image id="fontcache-pattern-image-0" width="4" height="2"`,
+	} {
+		if !strings.Contains(svg, want) {
+			t.Errorf("SVG中没有%s: %s", want, svg)
+		}
+	}
+	if strings.Count(svg, "<image") != 1 {
+		t.Errorf("SVG中只应有图案定义中的图片: %s", svg)
+	}
+
+	buf.Reset()
+	if err := c.Write(&buf, fontcache.PDF()); err != nil {
+		t.Fatalf("写出PDF失败: %v", err)
+	}
+	pdf := buf.String()
+	for _, want := range []string{"/PatternType 1", "/XStep 4 /YStep 2", "/Pattern << /FontcachePattern0 ", "/Subtype /Image /Width 4 /Height 2"} {
+		if !strings.Contains(pdf, want) {
+			t.Errorf("PDF中没有%s", want)
+		}
+	}
+
+	// 没有图案时与canvas的写出结果相同
+	plain := canvas.New(50, 50)
+	fontcache.DrawPath(canvas.NewContext(plain), path, path.Bounds(), fontcache.SolidPaint(canvas.Black), fontcache.Paint{}, 0)
+	var want bytes.Buffer
+	buf.Reset()
+	if err := plain.Write(&buf, fontcache.SVG()); err != nil {
+		t.Fatalf("写出SVG失败: %v", err)
+	}
+	if err := plain.Write(&want, renderers.SVG()); err != nil {
+		t.Fatalf("写出SVG失败: %v", err)
+	}
+	if buf.String() != want.String() {
+		t.Errorf("没有图案时SVG不应改变: %s", buf.String())
+	}
+}
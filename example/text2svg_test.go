@@ -1,9 +1,23 @@
 package example_test
 
 import (
+	"bytes"
+	"errors"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"testing/fstest"
 
+	"github.com/ibryang/go-utils/changedpi"
+	"github.com/ibryang/go-utils/fontcache"
 	"github.com/ibryang/go-utils/text2svg"
+	"github.com/tdewolff/font"
+	"golang.org/x/image/font/gofont/goregular"
 )
 
 func TestText2svgColors(t *testing.T) {
@@ -96,3 +110,349 @@ func TestMirror(t *testing.T) {
 		t.Fatalf("生成双向镜像SVG失败: %v", err)
 	}
 }
+
+// TestRender 测试内存渲染
+func TestRender(t *testing.T) {
+	options := text2svg.Options{
+		Text:     "Hello, Gophers!",
+		FontData: goregular.TTF,
+		FontSize: 24.0,
+		Colors:   []string{"#FF0000"},
+		Format:   "png",
+		DPI:      300,
+	}
+
+	data, err := text2svg.Render(options)
+	if err != nil {
+		t.Fatalf("内存渲染失败: %v", err)
+	}
+	if !strings.HasPrefix(string(data), "\x89PNG") {
+		t.Fatalf("渲染结果不是PNG")
+	}
+
+	// base64 data URL
+	options.Format = "svg"
+	options.IsBase64 = true
+	data, err = text2svg.Render(options)
+	if err != nil {
+		t.Fatalf("内存渲染失败: %v", err)
+	}
+	if !strings.HasPrefix(string(data), "data:image/svg+xml;base64,") {
+		t.Fatalf("渲染结果不是SVG data URL: %.40s", data)
+	}
+}
+
+func TestRenderCMYK(t *testing.T) {
+	data, err := text2svg.Render(text2svg.Options{
+		Text:      "Hello, Gophers!",
+		FontData:  goregular.TTF,
+		FontSize:  24.0,
+		Colors:    []string{"#FF0000"},
+		Format:    "jpeg",
+		DPI:       300,
+		ColorMode: text2svg.ColorModeCMYK,
+	})
+	if err != nil {
+		t.Fatalf("CMYK渲染失败: %v", err)
+	}
+
+	img, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("CMYK JPEG无法解码: %v", err)
+	}
+	if _, ok := img.(*image.CMYK); !ok {
+		t.Fatalf("渲染结果不是CMYK图像: %T", img)
+	}
+	// JFIF只允许1或3个分量，CMYK JPEG的分辨率写入EXIF
+	if bytes.Contains(data, []byte("JFIF\x00")) {
+		t.Fatalf("CMYK JPEG不应包含JFIF段")
+	}
+	info, err := changedpi.ReadDpiBytes(data)
+	if err != nil || info.Source != changedpi.SourceEXIF || info.X != 300 || info.Y != 300 {
+		t.Fatalf("CMYK JPEG的DPI错误: %+v, %v", info, err)
+	}
+
+	// ICC配置文件的色彩空间必须与颜色模式一致
+	profile := make([]byte, 128)
+	copy(profile[36:], "acsp")
+	for _, c := range []struct {
+		space string
+		mode  text2svg.ColorMode
+		ok    bool
+	}{
+		{"CMYK", text2svg.ColorModeCMYK, true},
+		{"RGB ", text2svg.ColorModeCMYK, false},
+		{"CMYK", text2svg.ColorModeRGB, false},
+	} {
+		copy(profile[16:], c.space)
+		_, err := text2svg.Render(text2svg.Options{
+			Text:       "Hello",
+			FontData:   goregular.TTF,
+			FontSize:   24.0,
+			Format:     "jpeg",
+			ColorMode:  c.mode,
+			ICCProfile: profile,
+		})
+		if c.ok && err != nil {
+			t.Errorf("%s配置文件用于%s模式时不应返回错误: %v", c.space, c.mode, err)
+		}
+		if !c.ok && (err == nil || !strings.Contains(err.Error(), changedpi.ErrICCColorSpace.Error())) {
+			t.Errorf("%s配置文件用于%s模式时应返回色彩空间错误, 实际: %v", c.space, c.mode, err)
+		}
+	}
+}
+
+func TestFallbackFonts(t *testing.T) {
+	want := []text2svg.MissingGlyph{{Rune: '中', Index: 3}, {Rune: '文', Index: 4}}
+	for _, mode := range []text2svg.RenderMode{text2svg.RenderModeString, text2svg.RenderModeChar} {
+		var missing []text2svg.MissingGlyph
+		options := text2svg.Options{
+			Text:            "Go 中文",
+			FontData:        goregular.TTF,
+			FontSize:        24.0,
+			FallbackFonts:   []string{"testdata/missing.ttf"},
+			RenderMode:      mode,
+			OnMissingGlyphs: func(glyphs []text2svg.MissingGlyph) { missing = glyphs },
+		}
+		if _, err := text2svg.GenerateCanvas(options); err != nil {
+			t.Fatalf("生成画布失败: %v", err)
+		}
+		if !reflect.DeepEqual(missing, want) {
+			t.Errorf("模式%d未渲染的字符应为%v，实际: %v", mode, want, missing)
+		}
+
+		// 严格模式返回MissingGlyphError
+		options.Strict = true
+		_, err := text2svg.GenerateCanvas(options)
+		var glyphErr *text2svg.MissingGlyphError
+		if !errors.As(err, &glyphErr) || !reflect.DeepEqual(glyphErr.Glyphs, want) {
+			t.Errorf("严格模式应返回MissingGlyphError，实际: %v", err)
+		}
+	}
+}
+
+func TestFallbackCharOffsets(t *testing.T) {
+	// 主字体只保留"o"，"x"使用回退字体
+	sfnt, err := font.ParseSFNT(goregular.TTF, 0)
+	if err != nil {
+		t.Fatalf("解析字体失败: %v", err)
+	}
+	subset, err := sfnt.Subset([]uint16{0, sfnt.GlyphIndex('o')}, font.SubsetOptions{Tables: []string{"min"}})
+	if err != nil {
+		t.Fatalf("生成子集字体失败: %v", err)
+	}
+
+	height := func(offsets []text2svg.CharOffset) float64 {
+		var missing []text2svg.MissingGlyph
+		c, err := text2svg.GenerateCanvas(text2svg.Options{
+			Text:            "ox",
+			FontData:        subset.Write(),
+			FontFS:          fstest.MapFS{"Go-Regular.ttf": {Data: goregular.TTF}},
+			FallbackFonts:   []string{"Go-Regular.ttf"},
+			FontSize:        24.0,
+			RenderMode:      text2svg.RenderModeChar,
+			CharOffsets:     offsets,
+			OnMissingGlyphs: func(glyphs []text2svg.MissingGlyph) { missing = glyphs },
+		})
+		if err != nil {
+			t.Fatalf("生成画布失败: %v", err)
+		}
+		if len(missing) != 0 {
+			t.Fatalf("回退字体应包含所有字形，缺少: %v", missing)
+		}
+		return c.H
+	}
+
+	// 只移动一个字形时画布变高，两个字形一起移动时高度不变
+	base := height(nil)
+	for i := 0; i < 2; i++ {
+		offsets := make([]text2svg.CharOffset, i+1)
+		offsets[i].Y = 20
+		if h := height(offsets); h-base < 15 {
+			t.Errorf("偏移第%d个字符时只应移动该字形，画布高度: %v，未偏移: %v", i, h, base)
+		}
+	}
+}
+
+func TestAutoFit(t *testing.T) {
+	var fontSize float64
+	options := text2svg.Options{
+		Text:       "Shrink to fit a fixed label",
+		FontData:   goregular.TTF,
+		FontSize:   48.0,
+		RenderMode: text2svg.RenderModeChar,
+		Padding:    []float64{2},
+		LockWidth:  60,
+		LockHeight: 20,
+		AutoFit:    true,
+		OnFontSize: func(size float64) { fontSize = size },
+	}
+	c, err := text2svg.GenerateCanvas(options)
+	if err != nil {
+		t.Fatalf("生成画布失败: %v", err)
+	}
+	if fontSize <= 0 || fontSize >= 48 {
+		t.Fatalf("自动适配应缩小字号，实际: %v", fontSize)
+	}
+	if c.W != 60 || c.H != 20 {
+		t.Errorf("画布尺寸应为锁定尺寸，实际: %vx%v", c.W, c.H)
+	}
+
+	// 换行后可以使用更大的字号
+	var wrappedSize float64
+	options.WrapWidth = 56
+	options.OnFontSize = func(size float64) { wrappedSize = size }
+	if _, err := text2svg.GenerateCanvas(options); err != nil {
+		t.Fatalf("生成画布失败: %v", err)
+	}
+	if wrappedSize <= fontSize {
+		t.Errorf("换行后的字号应大于单行时的字号，实际: %v <= %v", wrappedSize, fontSize)
+	}
+}
+
+func TestTextSpans(t *testing.T) {
+	spans := []text2svg.TextSpan{
+		{Text: "H"},
+		{Text: "2", FontSize: 14.0, Color: "#FF0000", BaselineShift: -4},
+		{Text: "O", Weight: 700, StrokeWidth: 0.2},
+	}
+	options := text2svg.Options{
+		Spans:    spans,
+		FontData: goregular.TTF,
+		FontSize: 24.0,
+	}
+	for _, mode := range []text2svg.RenderMode{text2svg.RenderModeString, text2svg.RenderModeChar} {
+		options.RenderMode = mode
+		shifted, err := text2svg.GenerateCanvas(options)
+		if err != nil {
+			t.Fatalf("生成画布失败: %v", err)
+		}
+
+		// 去掉下标的基线偏移后，各段共用基线，高度不超过最大字号的字符
+		plain := options
+		plain.Spans = append([]text2svg.TextSpan(nil), spans...)
+		plain.Spans[1].BaselineShift = 0
+		baseline, err := text2svg.GenerateCanvas(plain)
+		if err != nil {
+			t.Fatalf("生成画布失败: %v", err)
+		}
+		if shifted.H <= baseline.H {
+			t.Errorf("模式%d下标应增加整体高度，实际: %v <= %v", mode, shifted.H, baseline.H)
+		}
+		if shifted.W != baseline.W {
+			t.Errorf("模式%d基线偏移不应改变宽度，实际: %v != %v", mode, shifted.W, baseline.W)
+		}
+	}
+
+	// 缺少字形的位置按字符在所有段拼接后的文本中计数
+	var missing []text2svg.MissingGlyph
+	options.Spans = []text2svg.TextSpan{{Text: "Go "}, {Text: "中", FontSize: 12.0}}
+	options.OnMissingGlyphs = func(glyphs []text2svg.MissingGlyph) { missing = glyphs }
+	if _, err := text2svg.GenerateCanvas(options); err != nil {
+		t.Fatalf("生成画布失败: %v", err)
+	}
+	if want := []text2svg.MissingGlyph{{Rune: '中', Index: 3}}; !reflect.DeepEqual(missing, want) {
+		t.Errorf("未渲染的字符应为%v，实际: %v", want, missing)
+	}
+}
+
+func TestGradientColors(t *testing.T) {
+	for _, mode := range []text2svg.RenderMode{text2svg.RenderModeString, text2svg.RenderModeChar} {
+		options := text2svg.Options{
+			Text:             "Gradient",
+			FontData:         goregular.TTF,
+			FontSize:         24.0,
+			RenderMode:       mode,
+			Colors:           []string{"linear-gradient(90deg, #FF0000, #0000FF)"},
+			EnableBackground: true,
+			BackgroundColor:  "radial-gradient(#FFFFFF, #CCCCCC)",
+			Format:           "svg",
+		}
+		data, err := text2svg.Render(options)
+		if err != nil {
+			t.Fatalf("模式%d渲染渐变失败: %v", mode, err)
+		}
+		// 渐变应输出为SVG原生渐变，并包含对应的颜色节点
+		svg := strings.ToLower(string(data))
+		for _, want := range []struct {
+			tag    string
+			colors []string
+		}{
+			{"lineargradient", []string{"#ff0000", "#0000ff"}},
+			{"radialgradient", []string{"#ffffff", "#cccccc"}},
+		} {
+			start := strings.Index(svg, "<"+want.tag)
+			end := strings.Index(svg, "</"+want.tag+">")
+			if start == -1 || end < start {
+				t.Errorf("模式%d的SVG中没有<%s>", mode, want.tag)
+				continue
+			}
+			gradient := svg[start:end]
+			if strings.Count(gradient, "<stop") != 2 || !strings.Contains(gradient, `offset="0"`) || !strings.Contains(gradient, `offset="1"`) {
+				t.Errorf("模式%d的<%s>颜色节点不正确: %s", mode, want.tag, gradient)
+			}
+			for _, color := range want.colors {
+				if !strings.Contains(gradient, color) {
+					t.Errorf("模式%d的<%s>中没有颜色%s: %s", mode, want.tag, color, gradient)
+				}
+			}
+		}
+
+		// PDF中渐变输出为原生的轴向和径向着色
+		options.Format = "pdf"
+		data, err = text2svg.Render(options)
+		if err != nil {
+			t.Fatalf("模式%d渲染PDF渐变失败: %v", mode, err)
+		}
+		for _, want := range []string{"/ShadingType 2", "/ShadingType 3"} {
+			if !bytes.Contains(data, []byte(want)) {
+				t.Errorf("模式%d的PDF中没有%s", mode, want)
+			}
+		}
+	}
+
+	// 图案图片不存在时返回错误
+	_, err := text2svg.GenerateCanvas(text2svg.Options{Text: "Wood", FontData: goregular.TTF, FontSize: 24.0, Colors: []string{"url(missing.png)"}})
+	if err == nil {
+		t.Error("图案图片不存在时应返回错误")
+	}
+
+	// 图案不能用于描边
+	path := filepath.Join(t.TempDir(), "wood.png")
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 4, 2))); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = text2svg.GenerateCanvas(text2svg.Options{Text: "Wood", FontData: goregular.TTF, FontSize: 24.0, Colors: []string{"url(" + path + ")"}})
+	if err != nil {
+		t.Errorf("图案用于填充时不应返回错误: %v", err)
+	}
+
+	// 图案在SVG和PDF中输出为原生图案，逐字符绘制的同一段文本共用一个图案
+	for format, wants := range map[string][]string{
+		"svg": {`<pattern id="fontcache-pattern-0"`, `fill="url(#fontcache-pattern-0)"`},
+		"pdf": {"/PatternType 1", "/FontcachePattern0"},
+	} {
+		for _, mode := range []text2svg.RenderMode{text2svg.RenderModeString, text2svg.RenderModeChar} {
+			data, err := text2svg.Render(text2svg.Options{Text: "Wood", FontData: goregular.TTF, FontSize: 24.0, RenderMode: mode, Colors: []string{"url(" + path + ") 5"}, Format: format})
+			if err != nil {
+				t.Fatalf("模式%d渲染%s图案失败: %v", mode, format, err)
+			}
+			for _, want := range wants {
+				if !bytes.Contains(data, []byte(want)) {
+					t.Errorf("模式%d的%s中没有%s", mode, format, want)
+				}
+			}
+			if bytes.Contains(data, []byte("fontcache-pattern-1")) || bytes.Contains(data, []byte("/FontcachePattern1")) {
+				t.Errorf("模式%d的%s中同一段文本使用了多个图案", mode, format)
+			}
+		}
+	}
+	_, err = text2svg.GenerateCanvas(text2svg.Options{Text: "Wood", FontData: goregular.TTF, FontSize: 24.0, EnableStroke: true, StrokeWidth: 1, StrokeColor: "url(" + path + ")"})
+	if err == nil || !strings.Contains(err.Error(), fontcache.ErrPatternStroke.Error()) {
+		t.Errorf("图案用于描边应返回错误，实际: %v", err)
+	}
+}
@@ -0,0 +1,649 @@
+package fontcache
+
+import (
+	"sort"
+
+	"golang.org/x/text/unicode/bidi"
+)
+
+const (
+	bidiMaxDepth        = 125 // 显式嵌入的最大层级（BD2）
+	bidiMaxBracketDepth = 63  // 括号配对栈的深度（BD16）
+)
+
+// BidiRun 嵌入层级相同的一段连续文本，Start和End为字符（rune）位置，不包含End
+type BidiRun struct {
+	Start, End int
+	Level      int // 嵌入层级，奇数为从右到左
+}
+
+// RTL 判断该段文本是否从右到左排列
+func (r BidiRun) RTL() bool {
+	return r.Level%2 == 1
+}
+
+// BidiLevels 按Unicode双向算法（UAX #9）计算每个字符（rune）的嵌入层级
+// 文本按段落分隔符拆分为多个段落分别计算，段落方向由第一个强方向字符决定（P2-P3），
+// 支持显式嵌入和覆盖（LRE/RLE/LRO/RLO/PDF）、隔离（LRI/RLI/FSI/PDI）和括号配对（N0），
+// 格式控制字符（X9）的层级与前一个字符相同；行尾空白按L1重置为段落层级
+func BidiLevels(s string) []int {
+	_, levels := resolveBidi([]rune(s))
+	return levels
+}
+
+// BidiRuns 返回按视觉顺序（从左到右）排列的层级段，多个段落按逻辑顺序排列（L2）
+// 从右到左的文本段内部仍为逻辑顺序，由整形时按方向反转
+func BidiRuns(s string) []BidiRun {
+	classes, levels := resolveBidi([]rune(s))
+	var runs []BidiRun
+	for _, p := range bidiParagraphs(classes) {
+		// 按逻辑顺序拆分为层级相同的文本段
+		var paragraph []BidiRun
+		start := p[0]
+		for i := p[0] + 1; i <= p[1]; i++ {
+			if i == p[1] || levels[i] != levels[start] {
+				paragraph = append(paragraph, BidiRun{Start: start, End: i, Level: levels[start]})
+				start = i
+			}
+		}
+		runs = append(runs, reorderRuns(paragraph)...)
+	}
+	return runs
+}
+
+// resolveBidi 返回每个字符的双向类型和逐段落计算的嵌入层级
+func resolveBidi(runes []rune) ([]bidi.Class, []int) {
+	classes := make([]bidi.Class, len(runes))
+	for i, r := range runes {
+		props, _ := bidi.LookupRune(r)
+		classes[i] = props.Class()
+	}
+
+	levels := make([]int, len(runes))
+	for _, p := range bidiParagraphs(classes) {
+		paragraph := &bidiParagraph{runes: runes[p[0]:p[1]], classes: classes[p[0]:p[1]], levels: levels[p[0]:p[1]]}
+		paragraph.resolve()
+	}
+	return classes, levels
+}
+
+// reorderRuns 从最高层级到最低的奇数层级，依次反转层级不低于该值的连续文本段（L2）
+func reorderRuns(runs []BidiRun) []BidiRun {
+	highest, lowestOdd := 0, -1
+	for _, run := range runs {
+		highest = max(highest, run.Level)
+		if run.RTL() && (lowestOdd == -1 || run.Level < lowestOdd) {
+			lowestOdd = run.Level
+		}
+	}
+	if lowestOdd == -1 {
+		return runs
+	}
+	for level := highest; level >= lowestOdd; level-- {
+		for i := 0; i < len(runs); {
+			if runs[i].Level < level {
+				i++
+				continue
+			}
+			j := i
+			for j < len(runs) && runs[j].Level >= level {
+				j++
+			}
+			for a, b := i, j-1; a < b; a, b = a+1, b-1 {
+				runs[a], runs[b] = runs[b], runs[a]
+			}
+			i = j
+		}
+	}
+	return runs
+}
+
+// bidiParagraphs 按段落分隔符（B）拆分文本，返回每个段落的起止位置，分隔符属于前一个段落
+func bidiParagraphs(classes []bidi.Class) [][2]int {
+	var paragraphs [][2]int
+	start := 0
+	for i, class := range classes {
+		if class == bidi.B {
+			paragraphs = append(paragraphs, [2]int{start, i + 1})
+			start = i + 1
+		}
+	}
+	if start < len(classes) {
+		paragraphs = append(paragraphs, [2]int{start, len(classes)})
+	}
+	return paragraphs
+}
+
+// bidiParagraph 计算单个段落层级时的状态
+type bidiParagraph struct {
+	runes   []rune
+	classes []bidi.Class // 原始的双向类型
+	types   []bidi.Class // 按规则解析后的类型
+	levels  []int
+	level   int   // 段落层级
+	match   []int // 隔离起始字符与配对的PDI互相对应的位置，没有配对时为-1（BD9）
+}
+
+// resolve 依次执行P2-P3、X1-X10、W1-W7、N0-N2、I1-I2和L1
+func (p *bidiParagraph) resolve() {
+	p.types = append([]bidi.Class{}, p.classes...)
+	p.matchIsolates()
+	p.level = 0
+	if p.firstStrong(0, false) == bidi.R {
+		p.level = 1
+	}
+	p.explicitLevels()
+	for _, seq := range p.sequences() {
+		p.resolveSequence(seq)
+	}
+
+	// X9移除的字符不参与解析，层级与前一个字符相同
+	for i, class := range p.classes {
+		if removedByX9(class) {
+			if i == 0 {
+				p.levels[i] = p.level
+			} else {
+				p.levels[i] = p.levels[i-1]
+			}
+		}
+	}
+	p.resetWhitespace()
+}
+
+// removedByX9 判断是否为X9中移除的嵌入、覆盖和边界中性字符
+func removedByX9(class bidi.Class) bool {
+	switch class {
+	case bidi.LRE, bidi.RLE, bidi.LRO, bidi.RLO, bidi.PDF, bidi.BN:
+		return true
+	}
+	return false
+}
+
+// isIsolateInitiator 判断是否为隔离起始字符
+func isIsolateInitiator(class bidi.Class) bool {
+	return class == bidi.LRI || class == bidi.RLI || class == bidi.FSI
+}
+
+// matchIsolates 查找隔离起始字符和配对的PDI（BD9）
+func (p *bidiParagraph) matchIsolates() {
+	p.match = make([]int, len(p.classes))
+	var stack []int
+	for i, class := range p.classes {
+		p.match[i] = -1
+		switch {
+		case isIsolateInitiator(class):
+			stack = append(stack, i)
+		case class == bidi.PDI && len(stack) > 0:
+			open := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			p.match[open], p.match[i] = i, open
+		}
+	}
+}
+
+// firstStrong 从start开始查找第一个强方向字符（P2），跳过隔离内的字符
+// isolate为true时在配对的PDI处停止，用于FSI；L返回bidi.L，R和AL返回bidi.R，没有时返回bidi.ON
+func (p *bidiParagraph) firstStrong(start int, isolate bool) bidi.Class {
+	for i := start; i < len(p.classes); i++ {
+		switch class := p.classes[i]; {
+		case class == bidi.L:
+			return bidi.L
+		case class == bidi.R || class == bidi.AL:
+			return bidi.R
+		case isIsolateInitiator(class):
+			if p.match[i] == -1 {
+				return bidi.ON
+			}
+			i = p.match[i]
+		case class == bidi.PDI && isolate:
+			return bidi.ON
+		}
+	}
+	return bidi.ON
+}
+
+// explicitLevels 按显式格式字符计算每个字符的嵌入层级和覆盖后的类型（X1-X8）
+func (p *bidiParagraph) explicitLevels() {
+	type status struct {
+		level    int
+		override bidi.Class // bidi.ON表示没有覆盖
+		isolate  bool
+	}
+	stack := []status{{level: p.level, override: bidi.ON}}
+	overflowIsolates, overflowEmbeddings, validIsolates := 0, 0, 0
+
+	// nextLevel 返回大于当前层级的最小奇数或偶数层级
+	nextLevel := func(rtl bool) int {
+		level := stack[len(stack)-1].level
+		if rtl {
+			return (level + 1) | 1
+		}
+		return (level + 2) &^ 1
+	}
+
+	for i, class := range p.classes {
+		top := stack[len(stack)-1]
+		switch class {
+		case bidi.RLE, bidi.LRE, bidi.RLO, bidi.LRO:
+			// X2-X5
+			p.levels[i] = top.level
+			level := nextLevel(class == bidi.RLE || class == bidi.RLO)
+			if level <= bidiMaxDepth && overflowIsolates == 0 && overflowEmbeddings == 0 {
+				override := bidi.ON
+				switch class {
+				case bidi.RLO:
+					override = bidi.R
+				case bidi.LRO:
+					override = bidi.L
+				}
+				stack = append(stack, status{level: level, override: override})
+			} else if overflowIsolates == 0 {
+				overflowEmbeddings++
+			}
+
+		case bidi.RLI, bidi.LRI, bidi.FSI:
+			// X5a-X5c
+			p.levels[i] = top.level
+			if top.override != bidi.ON {
+				p.types[i] = top.override
+			}
+			rtl := class == bidi.RLI
+			if class == bidi.FSI {
+				rtl = p.firstStrong(i+1, true) == bidi.R
+			}
+			level := nextLevel(rtl)
+			if level <= bidiMaxDepth && overflowIsolates == 0 && overflowEmbeddings == 0 {
+				validIsolates++
+				stack = append(stack, status{level: level, override: bidi.ON, isolate: true})
+			} else {
+				overflowIsolates++
+			}
+
+		case bidi.PDI:
+			// X6a
+			if overflowIsolates > 0 {
+				overflowIsolates--
+			} else if validIsolates > 0 {
+				overflowEmbeddings = 0
+				for !stack[len(stack)-1].isolate {
+					stack = stack[:len(stack)-1]
+				}
+				stack = stack[:len(stack)-1]
+				validIsolates--
+			}
+			top = stack[len(stack)-1]
+			p.levels[i] = top.level
+			if top.override != bidi.ON {
+				p.types[i] = top.override
+			}
+
+		case bidi.PDF:
+			// X7
+			p.levels[i] = top.level
+			if overflowIsolates > 0 {
+				break
+			}
+			if overflowEmbeddings > 0 {
+				overflowEmbeddings--
+			} else if !top.isolate && len(stack) >= 2 {
+				stack = stack[:len(stack)-1]
+			}
+
+		case bidi.B:
+			// X8
+			p.levels[i] = p.level
+
+		case bidi.BN:
+			p.levels[i] = top.level
+
+		default:
+			// X6
+			p.levels[i] = top.level
+			if top.override != bidi.ON {
+				p.types[i] = top.override
+			}
+		}
+	}
+}
+
+// sequences 按层级拆分并连接为隔离段序列（BD13、X10），X9移除的字符不包含在内
+func (p *bidiParagraph) sequences() [][]int {
+	// 层级相同的连续字符组成层级段
+	var runs [][]int
+	runOf := make([]int, len(p.classes))
+	for i, class := range p.classes {
+		if removedByX9(class) {
+			continue
+		}
+		if len(runs) == 0 || p.levels[runs[len(runs)-1][0]] != p.levels[i] {
+			runs = append(runs, nil)
+		}
+		runs[len(runs)-1] = append(runs[len(runs)-1], i)
+		runOf[i] = len(runs) - 1
+	}
+
+	// 以配对的隔离起始字符结尾的层级段，与以配对PDI开头的层级段连接
+	var sequences [][]int
+	for _, run := range runs {
+		if first := run[0]; p.classes[first] == bidi.PDI && p.match[first] != -1 {
+			continue
+		}
+		var seq []int
+		for {
+			seq = append(seq, run...)
+			last := run[len(run)-1]
+			if !isIsolateInitiator(p.classes[last]) || p.match[last] == -1 {
+				break
+			}
+			run = runs[runOf[p.match[last]]]
+		}
+		sequences = append(sequences, seq)
+	}
+	return sequences
+}
+
+// neighborLevel 返回pos之前（step为-1）或之后（step为1）第一个未被X9移除的字符的层级，没有时返回段落层级
+func (p *bidiParagraph) neighborLevel(pos, step int) int {
+	for i := pos + step; i >= 0 && i < len(p.classes); i += step {
+		if !removedByX9(p.classes[i]) {
+			return p.levels[i]
+		}
+	}
+	return p.level
+}
+
+// levelDirection 返回层级对应的方向
+func levelDirection(level int) bidi.Class {
+	if level%2 == 1 {
+		return bidi.R
+	}
+	return bidi.L
+}
+
+// strongDirection 返回N0-N2中类型对应的强方向，EN和AN视为R，中性类型返回bidi.ON
+func strongDirection(class bidi.Class) bidi.Class {
+	switch class {
+	case bidi.L:
+		return bidi.L
+	case bidi.R, bidi.AL, bidi.EN, bidi.AN:
+		return bidi.R
+	}
+	return bidi.ON
+}
+
+// isNeutral 判断是否为N1-N2中的中性或隔离格式字符
+func isNeutral(class bidi.Class) bool {
+	switch class {
+	case bidi.B, bidi.S, bidi.WS, bidi.ON, bidi.LRI, bidi.RLI, bidi.FSI, bidi.PDI:
+		return true
+	}
+	return false
+}
+
+// resolveSequence 解析隔离段序列中的弱类型和中性类型并计算最终层级（W1-W7、N0-N2、I1-I2）
+func (p *bidiParagraph) resolveSequence(seq []int) {
+	level := p.levels[seq[0]]
+	sos := levelDirection(max(level, p.neighborLevel(seq[0], -1)))
+	last := seq[len(seq)-1]
+	eosLevel := p.level
+	if !isIsolateInitiator(p.classes[last]) {
+		eosLevel = p.neighborLevel(last, 1)
+	}
+	eos := levelDirection(max(level, eosLevel))
+
+	t := make([]bidi.Class, len(seq))
+	for k, i := range seq {
+		t[k] = p.types[i]
+	}
+
+	// W1：NSM使用前一个字符的类型，前一个字符为隔离格式字符时为ON
+	for k := range t {
+		if t[k] != bidi.NSM {
+			continue
+		}
+		switch {
+		case k == 0:
+			t[k] = sos
+		case isIsolateInitiator(t[k-1]) || t[k-1] == bidi.PDI:
+			t[k] = bidi.ON
+		default:
+			t[k] = t[k-1]
+		}
+	}
+
+	// W2：EN前面的第一个强类型为AL时改为AN；W3：AL改为R
+	strong := sos
+	for k, class := range t {
+		switch class {
+		case bidi.L, bidi.R, bidi.AL:
+			strong = class
+		case bidi.EN:
+			if strong == bidi.AL {
+				t[k] = bidi.AN
+			}
+		}
+	}
+	for k := range t {
+		if t[k] == bidi.AL {
+			t[k] = bidi.R
+		}
+	}
+
+	// W4：两个EN之间的单个ES、两个相同数字之间的单个CS改为该数字类型
+	for k := 1; k+1 < len(t); k++ {
+		switch {
+		case t[k] == bidi.ES && t[k-1] == bidi.EN && t[k+1] == bidi.EN:
+			t[k] = bidi.EN
+		case t[k] == bidi.CS && t[k-1] == t[k+1] && (t[k-1] == bidi.EN || t[k-1] == bidi.AN):
+			t[k] = t[k-1]
+		}
+	}
+
+	// W5：与EN相邻的连续ET改为EN
+	for k := 0; k < len(t); k++ {
+		if t[k] != bidi.ET {
+			continue
+		}
+		end := k
+		for end < len(t) && t[end] == bidi.ET {
+			end++
+		}
+		if (k > 0 && t[k-1] == bidi.EN) || (end < len(t) && t[end] == bidi.EN) {
+			for j := k; j < end; j++ {
+				t[j] = bidi.EN
+			}
+		}
+		k = end
+	}
+
+	// W6：其余的分隔符和终止符改为ON
+	for k, class := range t {
+		if class == bidi.ES || class == bidi.ET || class == bidi.CS {
+			t[k] = bidi.ON
+		}
+	}
+
+	// W7：EN前面的第一个强类型为L时改为L
+	strong = sos
+	for k, class := range t {
+		switch class {
+		case bidi.L, bidi.R:
+			strong = class
+		case bidi.EN:
+			if strong == bidi.L {
+				t[k] = bidi.L
+			}
+		}
+	}
+
+	embedding := levelDirection(level)
+	p.resolveBrackets(seq, t, sos, embedding)
+
+	// N1-N2：中性字符两侧方向相同时使用该方向，否则使用嵌入方向
+	for k := 0; k < len(t); k++ {
+		if !isNeutral(t[k]) {
+			continue
+		}
+		end := k
+		for end < len(t) && isNeutral(t[end]) {
+			end++
+		}
+		leading, trailing := sos, eos
+		if k > 0 {
+			leading = strongDirection(t[k-1])
+		}
+		if end < len(t) {
+			trailing = strongDirection(t[end])
+		}
+		direction := embedding
+		if leading == trailing {
+			direction = leading
+		}
+		for j := k; j < end; j++ {
+			t[j] = direction
+		}
+		k = end
+	}
+
+	// I1-I2
+	for k, i := range seq {
+		switch {
+		case level%2 == 0 && t[k] == bidi.R:
+			p.levels[i] = level + 1
+		case level%2 == 0 && (t[k] == bidi.AN || t[k] == bidi.EN):
+			p.levels[i] = level + 2
+		case level%2 == 1 && (t[k] == bidi.L || t[k] == bidi.AN || t[k] == bidi.EN):
+			p.levels[i] = level + 1
+		default:
+			p.levels[i] = level
+		}
+	}
+}
+
+// resolveBrackets 按配对括号内外的强方向解析括号的类型（BD16、N0）
+func (p *bidiParagraph) resolveBrackets(seq []int, t []bidi.Class, sos, embedding bidi.Class) {
+	type opener struct {
+		pos     int
+		closing rune
+	}
+	var stack []opener
+	var pairs [][2]int
+	for k, i := range seq {
+		if t[k] != bidi.ON {
+			continue
+		}
+		props, _ := bidi.LookupRune(p.runes[i])
+		if !props.IsBracket() {
+			continue
+		}
+		if props.IsOpeningBracket() {
+			if len(stack) == bidiMaxBracketDepth {
+				break
+			}
+			stack = append(stack, opener{pos: k, closing: pairedBracket(p.runes[i])})
+			continue
+		}
+		closing := canonicalBracket(p.runes[i])
+		for j := len(stack) - 1; j >= 0; j-- {
+			if stack[j].closing == closing {
+				pairs = append(pairs, [2]int{stack[j].pos, k})
+				stack = stack[:j]
+				break
+			}
+		}
+	}
+	sort.Slice(pairs, func(a, b int) bool { return pairs[a][0] < pairs[b][0] })
+
+	opposite := bidi.L
+	if embedding == bidi.L {
+		opposite = bidi.R
+	}
+	for _, pair := range pairs {
+		open, end := pair[0], pair[1]
+		foundEmbedding, foundOpposite := false, false
+		for k := open + 1; k < end; k++ {
+			switch strongDirection(t[k]) {
+			case embedding:
+				foundEmbedding = true
+			case opposite:
+				foundOpposite = true
+			}
+		}
+
+		var direction bidi.Class
+		switch {
+		case foundEmbedding:
+			direction = embedding
+		case foundOpposite:
+			// 括号内只有相反方向时，按括号前的方向决定
+			context := sos
+			for k := open - 1; k >= 0; k-- {
+				if d := strongDirection(t[k]); d != bidi.ON {
+					context = d
+					break
+				}
+			}
+			direction = embedding
+			if context == opposite {
+				direction = opposite
+			}
+		default:
+			continue
+		}
+
+		// 括号及其后原本为NSM的字符使用相同的方向
+		for _, k := range []int{open, end} {
+			t[k] = direction
+			for j := k + 1; j < len(t) && p.classes[seq[j]] == bidi.NSM; j++ {
+				t[j] = direction
+			}
+		}
+	}
+}
+
+// canonicalBracket 将规范等价的括号统一为同一个字符，U+2329/U+232A等价于U+3008/U+3009
+func canonicalBracket(r rune) rune {
+	switch r {
+	case 0x2329:
+		return 0x3008
+	case 0x232A:
+		return 0x3009
+	}
+	return r
+}
+
+// pairedBracket 返回开括号对应的闭括号（Bidi_Paired_Bracket）
+// 闭括号除U+298D、U+298F外都是开括号之后的第一个或第二个字符，例如"()"、"[]"、"{}"
+func pairedBracket(r rune) rune {
+	r = canonicalBracket(r)
+	switch r {
+	case 0x298D:
+		return 0x2990
+	case 0x298F:
+		return 0x298E
+	}
+	for _, c := range []rune{r + 1, r + 2} {
+		if props, _ := bidi.LookupRune(c); props.IsBracket() && !props.IsOpeningBracket() {
+			return c
+		}
+	}
+	return -1
+}
+
+// resetWhitespace 将段落分隔符、段分隔符及其前面和行尾的空白、隔离格式字符重置为段落层级（L1）
+func (p *bidiParagraph) resetWhitespace() {
+	trailing := true
+	for i := len(p.classes) - 1; i >= 0; i-- {
+		switch class := p.classes[i]; {
+		case class == bidi.B || class == bidi.S:
+			p.levels[i] = p.level
+			trailing = true
+		case class == bidi.WS || isIsolateInitiator(class) || class == bidi.PDI || removedByX9(class):
+			if trailing {
+				p.levels[i] = p.level
+			}
+		default:
+			trailing = false
+		}
+	}
+}
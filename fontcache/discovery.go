@@ -0,0 +1,311 @@
+package fontcache
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/tdewolff/font"
+)
+
+// FontDirsEnv 额外字体目录的环境变量，多个目录用系统路径分隔符分隔（Linux为冒号）
+const FontDirsEnv = "GOUTILS_FONT_DIRS"
+
+// FontInfo 字体索引信息
+type FontInfo struct {
+	Path   string // 字体文件路径
+	Index  int    // 字体在.ttc字体集合中的序号
+	Family string // 字体族名称
+	Style  string // 样式名称，例如Regular、Bold Italic
+	Weight int    // 字重，100-900
+	Italic bool   // 是否斜体
+
+	coverage []runeRange // 覆盖的字符区间，按升序排列
+}
+
+// Covers 判断字体是否包含该字符
+func (info FontInfo) Covers(r rune) bool {
+	i := sort.Search(len(info.coverage), func(i int) bool { return info.coverage[i].Hi >= r })
+	return i < len(info.coverage) && info.coverage[i].Lo <= r
+}
+
+// CoverageOf 返回字体包含的指定文字（unicode.Scripts中的表）的字符数量
+func (info FontInfo) CoverageOf(table *unicode.RangeTable) int {
+	count := 0
+	for _, r16 := range table.R16 {
+		count += info.countRange(rune(r16.Lo), rune(r16.Hi), rune(r16.Stride))
+	}
+	for _, r32 := range table.R32 {
+		count += info.countRange(rune(r32.Lo), rune(r32.Hi), rune(r32.Stride))
+	}
+	return count
+}
+
+// countRange 统计[lo, hi]中以stride为步长的字符有多少被字体包含
+func (info FontInfo) countRange(lo, hi, stride rune) int {
+	if stride != 1 {
+		count := 0
+		for r := lo; r <= hi; r += stride {
+			if info.Covers(r) {
+				count++
+			}
+		}
+		return count
+	}
+	count := 0
+	i := sort.Search(len(info.coverage), func(i int) bool { return info.coverage[i].Hi >= lo })
+	for ; i < len(info.coverage) && info.coverage[i].Lo <= hi; i++ {
+		count += int(min(info.coverage[i].Hi, hi)-max(info.coverage[i].Lo, lo)) + 1
+	}
+	return count
+}
+
+// FontIndex 扫描目录得到的字体索引
+type FontIndex struct {
+	fonts []FontInfo
+}
+
+// FontDirs 返回默认扫描的字体目录：环境变量GOUTILS_FONT_DIRS中的目录和系统字体目录
+// Linux下系统字体目录包括/usr/share/fonts、/usr/local/share/fonts、~/.fonts和~/.local/share/fonts
+func FontDirs() []string {
+	var dirs []string
+	for _, dir := range filepath.SplitList(os.Getenv(FontDirsEnv)) {
+		if dir != "" {
+			dirs = append(dirs, dir)
+		}
+	}
+	return append(dirs, font.DefaultFontDirs()...)
+}
+
+// ScanFonts 扫描目录中的.ttf、.otf、.ttc和.otc字体文件并建立索引
+// 不存在的目录和无法解析的文件会被跳过
+func ScanFonts(dirs ...string) *FontIndex {
+	index := &FontIndex{}
+	seen := map[string]bool{}
+	for _, dir := range dirs {
+		filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil // 跳过无法访问的目录
+			}
+			if d.IsDir() {
+				if seen[path] {
+					return filepath.SkipDir
+				}
+				seen[path] = true
+				return nil
+			}
+			switch strings.ToLower(filepath.Ext(path)) {
+			case ".ttf", ".otf", ".ttc", ".otc":
+			default:
+				return nil
+			}
+			if seen[path] {
+				return nil
+			}
+			seen[path] = true
+
+			f, err := os.Open(path)
+			if err != nil {
+				return nil
+			}
+			defer f.Close()
+			infos, err := readFontInfos(f, path)
+			if err == nil {
+				index.fonts = append(index.fonts, infos...)
+			}
+			return nil
+		})
+	}
+	return index
+}
+
+// Fonts 返回索引中的所有字体
+func (idx *FontIndex) Fonts() []FontInfo {
+	return append([]FontInfo{}, idx.fonts...)
+}
+
+// Match 按字体族名称（不区分大小写）查找字重最接近、斜体一致的字体
+// 传入多个名称时按顺序查找，返回第一个找到的字体
+func (idx *FontIndex) Match(weight int, italic bool, families ...string) (FontInfo, bool) {
+	for _, family := range families {
+		best, bestScore := -1, 0
+		for i, info := range idx.fonts {
+			if !strings.EqualFold(info.Family, family) {
+				continue
+			}
+			if score := styleScore(info, weight, italic); best == -1 || score < bestScore {
+				best, bestScore = i, score
+			}
+		}
+		if best != -1 {
+			return idx.fonts[best], true
+		}
+	}
+	return FontInfo{}, false
+}
+
+// Fallbacks 按文字（script）为文本挑选回退字体
+// 每种文字优先选择包含文本中该文字字符最多的字体，数量相同时依次优先已选中的字体、
+// 常规字重的非斜体字体、对该文字整体覆盖更全的字体；一个字体不足以覆盖时继续为剩余字符挑选
+func (idx *FontIndex) Fallbacks(text string) []FontInfo {
+	var result []FontInfo
+	chosen := map[int]bool{}
+	for _, group := range groupByScript(text) {
+		remaining := group.runes
+		for len(remaining) > 0 {
+			best, bestRank := -1, fallbackRank{}
+			for i, info := range idx.fonts {
+				rank := fallbackRank{chosen: chosen[i], style: styleScore(info, 400, false)}
+				for _, r := range remaining {
+					if info.Covers(r) {
+						rank.count++
+					}
+				}
+				if rank.count == 0 || rank.count < bestRank.count {
+					continue
+				}
+				rank.coverage = info.CoverageOf(group.table)
+				if best == -1 || rank.better(bestRank) {
+					best, bestRank = i, rank
+				}
+			}
+			if best == -1 {
+				break // 没有字体包含剩余字符
+			}
+			if !chosen[best] {
+				chosen[best] = true
+				result = append(result, idx.fonts[best])
+			}
+			remaining = uncovered(idx.fonts[best], remaining)
+		}
+	}
+	return result
+}
+
+// fallbackRank 回退字体的排序依据
+type fallbackRank struct {
+	count    int  // 包含的待渲染字符数量
+	chosen   bool // 是否已被选为回退字体
+	style    int  // 与常规样式的差距
+	coverage int  // 对该文字整体的覆盖数量
+}
+
+// better 判断是否优于other
+func (rank fallbackRank) better(other fallbackRank) bool {
+	if rank.count != other.count {
+		return rank.count > other.count
+	}
+	if rank.chosen != other.chosen {
+		return rank.chosen
+	}
+	if regular, otherRegular := rank.style <= 100, other.style <= 100; regular != otherRegular {
+		return regular
+	}
+	if rank.coverage != other.coverage {
+		return rank.coverage > other.coverage
+	}
+	return rank.style < other.style
+}
+
+// scriptGroup 文本中属于同一文字的字符
+type scriptGroup struct {
+	table *unicode.RangeTable
+	runes []rune
+}
+
+// groupByScript 按文字对文本中需要字形的字符去重分组，按首次出现的顺序排列
+func groupByScript(text string) []scriptGroup {
+	var groups []scriptGroup
+	position := map[*unicode.RangeTable]int{}
+	seen := map[rune]bool{}
+	for _, r := range text {
+		if seen[r] || unicode.IsSpace(r) || unicode.IsControl(r) {
+			continue
+		}
+		seen[r] = true
+		table := scriptOf(r)
+		i, ok := position[table]
+		if !ok {
+			i = len(groups)
+			position[table] = i
+			groups = append(groups, scriptGroup{table: table})
+		}
+		groups[i].runes = append(groups[i].runes, r)
+	}
+	return groups
+}
+
+var (
+	scriptNames     []string
+	scriptNamesOnce sync.Once
+)
+
+// scriptOf 返回字符所属文字的表，未知字符归入Common
+func scriptOf(r rune) *unicode.RangeTable {
+	scriptNamesOnce.Do(func() {
+		for name := range unicode.Scripts {
+			scriptNames = append(scriptNames, name)
+		}
+		sort.Strings(scriptNames)
+	})
+	for _, name := range scriptNames {
+		if table := unicode.Scripts[name]; unicode.Is(table, r) {
+			return table
+		}
+	}
+	return unicode.Common
+}
+
+// uncovered 返回字体不包含的字符
+func uncovered(info FontInfo, runes []rune) []rune {
+	var rest []rune
+	for _, r := range runes {
+		if !info.Covers(r) {
+			rest = append(rest, r)
+		}
+	}
+	return rest
+}
+
+// styleScore 计算字体样式与目标的差距，越小越接近
+func styleScore(info FontInfo, weight int, italic bool) int {
+	score := info.Weight - weight
+	if score < 0 {
+		score = -score
+	}
+	if info.Italic != italic {
+		score += 1000
+	}
+	return score
+}
+
+var (
+	systemFonts   *FontIndex
+	systemFontsMu sync.Mutex
+)
+
+// SystemFonts 返回系统字体索引，首次调用时扫描FontDirs()中的目录
+func SystemFonts() *FontIndex {
+	systemFontsMu.Lock()
+	defer systemFontsMu.Unlock()
+	if systemFonts == nil {
+		systemFonts = ScanFonts(FontDirs()...)
+	}
+	return systemFonts
+}
+
+// RescanSystemFonts 重新扫描系统字体索引，dirs为空时使用FontDirs()
+func RescanSystemFonts(dirs ...string) *FontIndex {
+	if len(dirs) == 0 {
+		dirs = FontDirs()
+	}
+	index := ScanFonts(dirs...)
+	systemFontsMu.Lock()
+	systemFonts = index
+	systemFontsMu.Unlock()
+	return index
+}
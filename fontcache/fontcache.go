@@ -0,0 +1,400 @@
+package fontcache
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"hash/maphash"
+	"io"
+	"io/fs"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/ibryang/go-utils/os/file"
+	"github.com/tdewolff/canvas"
+)
+
+const (
+	DefaultCapacity = 32 // 默认缓存的字体数量
+
+	dataKeyPrefix = "data:" // LoadBytes缓存键的前缀
+	fsKeyPrefix   = "fs:"   // LoadFS缓存键的前缀
+)
+
+var ErrEmptyFontData = errors.New("字体数据为空")
+
+// Default text2svg和text2svgV2共用的字体注册表
+var Default = New(DefaultCapacity)
+
+// Key 缓存键，同一字体以不同样式、可变字体轴或OpenType特性加载时分别缓存
+type Key struct {
+	Name       string // 注册名、字体文件路径或系统字体名称
+	Style      canvas.FontStyle
+	Variations string // 可变字体轴，格式同Variations.String()
+	Features   string // OpenType特性，格式同Features.String()
+}
+
+// Source 字体来源，按Data、FS中的Path、Path的优先级加载
+// Data按内容缓存，同一切片重复加载时不会重新计算哈希；FS按文件系统和Path缓存，命中缓存时不读取文件，
+// 不可比较的文件系统（例如fstest.MapFS）每次读取后按内容缓存
+type Source struct {
+	Path  string // 注册名、字体文件路径或系统字体名称，设置FS时为FS中的路径
+	Index int    // 字体在.ttc字体集合中的序号
+	Data  []byte // 字体文件内容
+	FS    fs.FS  // 读取Path的文件系统
+}
+
+// entry 缓存项，once保证同一字体并发请求时只解析一次
+type entry struct {
+	key  Key
+	once sync.Once
+	font *canvas.Font
+	err  error
+}
+
+// Registry 并发安全的字体注册表，按LRU策略缓存已解析的字体
+type Registry struct {
+	mu        sync.Mutex
+	capacity  int
+	lru       *list.List
+	items     map[Key]*list.Element
+	sources   map[string][]byte    // 通过Register注册的内存字体
+	seed      maphash.Seed         // LoadBytes计算数据哈希的种子
+	dataNames map[dataRef]dataName // 按地址和长度记录已计算的数据缓存名称
+	fsIDs     map[fs.FS]int        // 可比较的文件系统的编号，用于缓存键
+}
+
+// dataRef 内存字体数据的首地址和长度
+type dataRef struct {
+	ptr *byte
+	len int
+}
+
+// dataName 已计算的数据缓存名称，保留data使其地址在记录期间不会被其他数据复用
+type dataName struct {
+	data []byte
+	name string
+}
+
+// New 创建字体注册表，capacity<=0时使用DefaultCapacity
+func New(capacity int) *Registry {
+	if capacity <= 0 {
+		capacity = DefaultCapacity
+	}
+	return &Registry{
+		capacity:  capacity,
+		lru:       list.New(),
+		items:     map[Key]*list.Element{},
+		sources:   map[string][]byte{},
+		seed:      maphash.MakeSeed(),
+		dataNames: map[dataRef]dataName{},
+		fsIDs:     map[fs.FS]int{},
+	}
+}
+
+// Load 按名称加载字体，依次尝试注册的内存字体、字体文件和系统字体
+// 加载成功的字体会被缓存，加载失败不缓存
+func (r *Registry) Load(name string, style canvas.FontStyle) (*canvas.Font, error) {
+	return r.LoadSource(Source{Path: name}, style, nil, nil)
+}
+
+// LoadSource 按来源加载字体，variations和features不为空时设置可变字体轴和OpenType特性，不同的设置分别缓存
+func (r *Registry) LoadSource(src Source, style canvas.FontStyle, variations Variations, features Features) (*canvas.Font, error) {
+	data := src.Data
+	var fsName string
+	if len(data) == 0 && src.FS != nil {
+		var ok bool
+		if fsName, ok = r.fsName(src.FS, src.Path, src.Index); !ok {
+			var err error
+			if data, err = readFSFont(src.FS, src.Path); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var key Key
+	var load func() (*canvas.Font, error)
+	switch {
+	case len(data) > 0:
+		key = Key{Name: r.dataName(data, src.Index), Style: style}
+		load = func() (*canvas.Font, error) {
+			return canvas.LoadFont(data, src.Index, style)
+		}
+	case fsName != "":
+		key = Key{Name: fsName, Style: style}
+		load = func() (*canvas.Font, error) {
+			data, err := readFSFont(src.FS, src.Path)
+			if err != nil {
+				return nil, err
+			}
+			return canvas.LoadFont(data, src.Index, style)
+		}
+	case src.Index > 0:
+		key = Key{Name: fmt.Sprintf("%s#%d", src.Path, src.Index), Style: style}
+		load = func() (*canvas.Font, error) {
+			data, err := os.ReadFile(src.Path)
+			if err != nil {
+				return nil, err
+			}
+			return canvas.LoadFont(data, src.Index, style)
+		}
+	default:
+		r.mu.Lock()
+		registered := r.sources[src.Path]
+		r.mu.Unlock()
+		key = Key{Name: src.Path, Style: style}
+		load = func() (*canvas.Font, error) {
+			return loadNamed(src.Path, style, registered)
+		}
+	}
+
+	key.Variations, key.Features = variations.String(), features.String()
+	return r.get(key, func() (*canvas.Font, error) {
+		font, err := load()
+		if err != nil {
+			return nil, err
+		}
+		if key.Variations != "" {
+			font.SetVariations(key.Variations)
+		}
+		if key.Features != "" {
+			font.SetFeatures(key.Features)
+		}
+		return font, nil
+	})
+}
+
+// LoadInfo 加载字体索引中的字体，支持.ttc字体集合中的非首个字体
+func (r *Registry) LoadInfo(info FontInfo, style canvas.FontStyle) (*canvas.Font, error) {
+	return r.LoadSource(Source{Path: info.Path, Index: info.Index}, style, nil, nil)
+}
+
+// LoadBytes 从内存中的字体数据加载字体，相同内容的数据共用同一个缓存项
+// 解析后的字体会引用data，调用方不应再修改data
+func (r *Registry) LoadBytes(data []byte, style canvas.FontStyle) (*canvas.Font, error) {
+	if len(data) == 0 {
+		return nil, ErrEmptyFontData
+	}
+	return r.LoadSource(Source{Data: data}, style, nil, nil)
+}
+
+// LoadReader 读取reader中的全部字体数据后加载
+func (r *Registry) LoadReader(reader io.Reader, style canvas.FontStyle) (*canvas.Font, error) {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("读取字体数据失败: %w", err)
+	}
+	return r.LoadBytes(data, style)
+}
+
+// LoadFS 从fsys中读取name对应的字体文件后加载，可用于embed.FS
+// 按fsys和name缓存，命中缓存时不读取文件；fsys不可比较时读取后按内容缓存
+func (r *Registry) LoadFS(fsys fs.FS, name string, style canvas.FontStyle) (*canvas.Font, error) {
+	return r.LoadSource(Source{Path: name, FS: fsys}, style, nil, nil)
+}
+
+// dataName 返回内存字体数据的缓存名称
+// 同一切片（首地址和长度相同）再次加载时直接使用已计算的名称，否则计算整个数据的哈希
+// 记录的名称数量不超过缓存容量，超出时任意移除一个
+func (r *Registry) dataName(data []byte, index int) string {
+	ref := dataRef{ptr: &data[0], len: len(data)}
+	r.mu.Lock()
+	known, ok := r.dataNames[ref]
+	r.mu.Unlock()
+	if !ok {
+		known = dataName{data: data, name: fmt.Sprintf("%s%016x-%d", dataKeyPrefix, maphash.Bytes(r.seed, data), len(data))}
+		r.mu.Lock()
+		for old := range r.dataNames {
+			if len(r.dataNames) < r.capacity {
+				break
+			}
+			delete(r.dataNames, old)
+		}
+		r.dataNames[ref] = known
+		r.mu.Unlock()
+	}
+	return fmt.Sprintf("%s#%d", known.name, index)
+}
+
+// fsName 返回文件系统中字体的缓存名称，fsys不可比较时返回false
+func (r *Registry) fsName(fsys fs.FS, path string, index int) (string, bool) {
+	if !reflect.ValueOf(fsys).Comparable() {
+		return "", false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	id, ok := r.fsIDs[fsys]
+	if !ok {
+		id = len(r.fsIDs) + 1
+		r.fsIDs[fsys] = id
+	}
+	return fmt.Sprintf("%s%d:%s#%d", fsKeyPrefix, id, path, index), true
+}
+
+// readFSFont 读取文件系统中的字体文件
+func readFSFont(fsys fs.FS, path string) ([]byte, error) {
+	data, err := fs.ReadFile(fsys, path)
+	if err != nil {
+		return nil, fmt.Errorf("读取字体文件失败: %w", err)
+	}
+	if len(data) == 0 {
+		return nil, ErrEmptyFontData
+	}
+	return data, nil
+}
+
+// get 返回缓存中的字体，不存在时调用load加载
+func (r *Registry) get(key Key, load func() (*canvas.Font, error)) (*canvas.Font, error) {
+	r.mu.Lock()
+	elem, ok := r.items[key]
+	if ok {
+		r.lru.MoveToFront(elem)
+	} else {
+		elem = r.lru.PushFront(&entry{key: key})
+		r.items[key] = elem
+		r.trim()
+	}
+	r.mu.Unlock()
+
+	e := elem.Value.(*entry)
+	e.once.Do(func() {
+		e.font, e.err = load()
+	})
+	if e.err != nil {
+		r.mu.Lock()
+		if r.items[key] == elem {
+			r.remove(elem)
+		}
+		r.mu.Unlock()
+		return nil, e.err
+	}
+	return e.font, nil
+}
+
+// Preload 并发加载多个字体并放入缓存，返回所有加载失败的错误
+func (r *Registry) Preload(style canvas.FontStyle, names ...string) error {
+	errs := make([]error, len(names))
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			if _, err := r.Load(name, style); err != nil {
+				errs[i] = fmt.Errorf("预加载字体%s失败: %w", name, err)
+			}
+		}(i, name)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// Register 以name注册内存中的字体数据，之后可通过Load(name, style)加载
+// 重复注册同一名称会替换原数据并清除该名称的缓存；注册后调用方不应再修改data
+func (r *Registry) Register(name string, data []byte) error {
+	if len(data) == 0 {
+		return ErrEmptyFontData
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sources[name] = data
+	r.evict(name)
+	return nil
+}
+
+// Unregister 移除注册的内存字体及其缓存
+func (r *Registry) Unregister(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.sources, name)
+	r.evict(name)
+}
+
+// Evict 从缓存中移除指定名称的所有样式，注册的内存字体保留
+func (r *Registry) Evict(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.evict(name)
+}
+
+// Clear 清空缓存，注册的内存字体保留
+func (r *Registry) Clear() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lru.Init()
+	r.items = map[Key]*list.Element{}
+	r.dataNames = map[dataRef]dataName{}
+}
+
+// Len 返回当前缓存的字体数量
+func (r *Registry) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.lru.Len()
+}
+
+// SetCapacity 修改缓存容量，超出部分按最近最少使用淘汰
+func (r *Registry) SetCapacity(capacity int) {
+	if capacity <= 0 {
+		capacity = DefaultCapacity
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.capacity = capacity
+	r.trim()
+}
+
+// evict 移除名称对应的缓存项，调用方需持有锁
+func (r *Registry) evict(name string) {
+	for key, elem := range r.items {
+		if key.Name == name {
+			r.remove(elem)
+		}
+	}
+}
+
+// trim 淘汰超出容量的缓存项，调用方需持有锁
+func (r *Registry) trim() {
+	for r.lru.Len() > r.capacity {
+		r.remove(r.lru.Back())
+	}
+}
+
+// remove 移除缓存项，调用方需持有锁
+// 内存字体的缓存项被移除时同时移除记录的数据名称，不再引用该数据
+func (r *Registry) remove(elem *list.Element) {
+	key := elem.Value.(*entry).key
+	r.lru.Remove(elem)
+	delete(r.items, key)
+	if name, ok := strings.CutPrefix(key.Name, dataKeyPrefix); ok {
+		name, _, _ = strings.Cut(name, "#")
+		for ref, known := range r.dataNames {
+			if known.name == dataKeyPrefix+name {
+				delete(r.dataNames, ref)
+			}
+		}
+	}
+}
+
+// loadNamed 按名称解析字体，data不为空时从内存加载，系统字体优先从字体索引中按字重和斜体匹配
+func loadNamed(name string, style canvas.FontStyle, data []byte) (*canvas.Font, error) {
+	if data != nil {
+		return canvas.LoadFont(data, 0, style)
+	}
+	if _, err := os.Stat(name); err == nil {
+		return canvas.LoadFontFile(name, style)
+	}
+	weight, italic := styleWeight(style), style&canvas.FontItalic != 0
+	if info, ok := SystemFonts().Match(weight, italic, name, file.Name(name)); ok {
+		data, err := os.ReadFile(info.Path)
+		if err == nil {
+			return canvas.LoadFont(data, info.Index, style)
+		}
+	}
+	font, err := canvas.LoadSystemFont(name, style)
+	if err != nil && file.Name(name) != name {
+		return canvas.LoadSystemFont(file.Name(name), style)
+	}
+	return font, err
+}
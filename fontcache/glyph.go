@@ -0,0 +1,61 @@
+package fontcache
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/tdewolff/canvas"
+)
+
+// MissingGlyph 所有字体都无法渲染的字符
+type MissingGlyph struct {
+	Rune  rune // 字符
+	Index int  // 字符在文本中的位置，按字符计数，从0开始
+}
+
+// MissingGlyphError 严格模式下文本包含无法渲染的字符时返回的错误
+type MissingGlyphError struct {
+	Glyphs []MissingGlyph
+}
+
+func (e *MissingGlyphError) Error() string {
+	var sb strings.Builder
+	sb.WriteString("字体缺少字形:")
+	for i, glyph := range e.Glyphs {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		fmt.Fprintf(&sb, " %q(U+%04X, 位置%d)", glyph.Rune, glyph.Rune, glyph.Index)
+	}
+	return sb.String()
+}
+
+// NeedsGlyph 判断字符是否需要字形，空白、控制字符、变体选择符和零宽连接符不需要
+func NeedsGlyph(r rune) bool {
+	return !(unicode.IsSpace(r) || unicode.IsControl(r) ||
+		unicode.Is(unicode.Variation_Selector, r) || r == '\u200d')
+}
+
+// HasGlyph 判断fonts中是否有字体包含该字符的字形
+func HasGlyph(fonts []*canvas.Font, r rune) bool {
+	for _, font := range fonts {
+		if font.GlyphIndex(r) != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// MissingGlyphs 返回文本中所有字体都不包含字形的字符及其位置
+func MissingGlyphs(text string, fonts []*canvas.Font) []MissingGlyph {
+	var missing []MissingGlyph
+	index := 0
+	for _, r := range text {
+		if NeedsGlyph(r) && !HasGlyph(fonts, r) {
+			missing = append(missing, MissingGlyph{Rune: r, Index: index})
+		}
+		index++
+	}
+	return missing
+}
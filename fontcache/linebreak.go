@@ -0,0 +1,259 @@
+package fontcache
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// WrapOptions 自动换行选项
+type WrapOptions struct {
+	Width    float64 // 最大行宽，不大于0时只按换行符分行
+	MaxLines int     // 最大行数，0表示不限制
+	Ellipsis string  // 超出MaxLines时添加在最后一行末尾的省略号，例如"…"，为空时直接截断
+}
+
+// Line 换行后的一行文本
+type Line struct {
+	Text  string // 文本，已去掉行尾的空白和换行符
+	Start int    // 在原文本中的字节位置
+}
+
+// Wrap 按Unicode换行算法（UAX #14）将文本拆分为宽度不超过opts.Width的多行，measure返回一行文本的宽度
+// 换行符处强制换行；汉字、假名之间可以断行，但结束标点、句读符号和小写假名等不能位于行首，开始标点不能位于行尾（避头尾）
+// 单个不可断开的片段超过行宽时逐字符断开
+func Wrap(text string, opts WrapOptions, measure func(string) float64) []Line {
+	var lines []Line
+	start, last := 0, -1
+	breaks := lineBreaks(text)
+	for i := 0; i < len(breaks); i++ {
+		bp := breaks[i]
+		if opts.Width > 0 && measure(lineText(text[start:bp.pos])) > opts.Width {
+			if last > start {
+				lines = append(lines, Line{Text: lineText(text[start:last]), Start: start})
+				start, last = last, -1
+				i-- // 在新的一行中重新判断当前断行位置
+				continue
+			}
+			for measure(lineText(text[start:bp.pos])) > opts.Width {
+				n := fitPrefix(text[start:bp.pos], opts.Width, measure)
+				if start+n >= bp.pos {
+					break
+				}
+				lines = append(lines, Line{Text: text[start : start+n], Start: start})
+				start += n
+			}
+		}
+		if bp.mandatory {
+			lines = append(lines, Line{Text: lineText(text[start:bp.pos]), Start: start})
+			start, last = bp.pos, -1
+			continue
+		}
+		last = bp.pos
+	}
+
+	if opts.MaxLines > 0 && len(lines) > opts.MaxLines {
+		lines = lines[:opts.MaxLines]
+		if opts.Ellipsis != "" {
+			line := &lines[len(lines)-1]
+			for line.Text != "" && opts.Width > 0 && measure(line.Text+opts.Ellipsis) > opts.Width {
+				line.Text = lineText(line.Text[:lastUnit(line.Text)])
+			}
+			line.Text += opts.Ellipsis
+		}
+	}
+	return lines
+}
+
+// lineText 去掉行尾的空白和换行符
+func lineText(s string) string {
+	return strings.TrimRightFunc(s, unicode.IsSpace)
+}
+
+// fitPrefix 返回s中宽度不超过width的最长前缀的字节长度，至少包含一个字符，组合字符不与前一个字符分开
+func fitPrefix(s string, width float64, measure func(string) float64) int {
+	n := 0
+	for pos := range s {
+		if pos == 0 || breakClassOf(mustDecodeRune(s[pos:])) == clCM {
+			continue
+		}
+		if measure(s[:pos]) > width {
+			break
+		}
+		n = pos
+	}
+	if n == 0 {
+		n = len(s)
+		for pos := range s {
+			if pos > 0 && breakClassOf(mustDecodeRune(s[pos:])) != clCM {
+				return pos
+			}
+		}
+	}
+	return n
+}
+
+// lastUnit 返回s中最后一个字符（连同其后的组合字符）的起始字节位置
+func lastUnit(s string) int {
+	for pos := len(s); pos > 0; {
+		r, size := utf8.DecodeLastRuneInString(s[:pos])
+		pos -= size
+		if breakClassOf(r) != clCM {
+			return pos
+		}
+	}
+	return 0
+}
+
+func mustDecodeRune(s string) rune {
+	r, _ := utf8.DecodeRuneInString(s)
+	return r
+}
+
+// breakClass UAX #14中的换行类别，只区分换行判断需要的类别
+type breakClass int
+
+const (
+	clAL breakClass = iota // 字母、符号等，彼此之间不断行
+	clNU                   // 数字
+	clBK                   // 强制换行
+	clCR                   // 回车
+	clLF                   // 换行
+	clSP                   // 空格
+	clZW                   // 零宽空格，之后可以断行
+	clGL                   // 不间断字符，前后都不能断行
+	clCM                   // 组合字符，沿用前一个字符的类别
+	clID                   // 表意文字，前后都可以断行
+	clOP                   // 开始标点，之后不能断行
+	clCL                   // 结束标点，之前不能断行
+	clEX                   // 感叹号、问号，之前不能断行
+	clIS                   // 中缀分隔符，之前不能断行
+	clNS                   // 不能位于行首的字符，例如小写假名和长音符号
+	clQU                   // 没有方向的引号，前后都不能断行
+	clHY                   // 连字符，之后可以断行
+	clBA                   // 之后可以断行的字符，例如制表符和破折号
+)
+
+// breakPoint 可以断行的位置，在pos之前断行
+type breakPoint struct {
+	pos       int
+	mandatory bool
+}
+
+// lineBreaks 返回文本中所有可以断行的位置，最后一个位置为文本末尾
+func lineBreaks(text string) []breakPoint {
+	var breaks []breakPoint
+	prev, lastNonSpace := breakClass(-1), breakClass(-1)
+	for pos, r := range text {
+		cur := breakClassOf(r)
+		if cur == clCM && prev != -1 && prev != clSP && prev != clBK && prev != clCR && prev != clLF && prev != clZW {
+			cur = prev // LB9：组合字符沿用前一个字符的类别
+		}
+		if prev != -1 {
+			if brk, mandatory := canBreak(prev, lastNonSpace, cur); brk {
+				breaks = append(breaks, breakPoint{pos: pos, mandatory: mandatory})
+			}
+		}
+		prev = cur
+		if cur != clSP {
+			lastNonSpace = cur
+		}
+	}
+	if n := len(breaks); len(text) > 0 && (n == 0 || breaks[n-1].pos != len(text)) {
+		breaks = append(breaks, breakPoint{pos: len(text), mandatory: true})
+	}
+	return breaks
+}
+
+// canBreak 判断两个相邻字符之间能否断行，lastNonSpace为prev及之前最后一个非空格字符的类别
+func canBreak(prev, lastNonSpace, cur breakClass) (brk, mandatory bool) {
+	switch {
+	case prev == clCR && cur == clLF:
+		return false, false
+	case prev == clBK || prev == clCR || prev == clLF:
+		return true, true
+	case cur == clBK || cur == clCR || cur == clLF || cur == clSP || cur == clZW:
+		return false, false
+	case prev == clZW:
+		return true, false
+	case prev == clGL || cur == clGL && prev != clSP && prev != clBA && prev != clHY:
+		return false, false
+	case cur == clCL || cur == clEX || cur == clIS || cur == clNS:
+		return false, false // 避头：结束标点等不能位于行首
+	case lastNonSpace == clOP:
+		return false, false // 避尾：开始标点不能位于行尾
+	case prev == clSP:
+		return true, false
+	case prev == clQU || cur == clQU:
+		return false, false
+	case cur == clHY || cur == clBA:
+		return false, false
+	case prev == clHY && cur == clNU:
+		return false, false // 负数
+	case prev == clHY || prev == clBA:
+		return true, false
+	case prev == clID || prev == clCL || prev == clEX || prev == clNS || cur == clID:
+		return true, false
+	}
+	return false, false
+}
+
+// breakClassOf 返回字符的换行类别
+// 泰文、老挝文等需要词典断词的文字按字母处理，不在词中断行
+func breakClassOf(r rune) breakClass {
+	switch r {
+	case '\n':
+		return clLF
+	case '\r':
+		return clCR
+	case '\v', '\f', '\u0085', '\u2028', '\u2029':
+		return clBK
+	case ' ':
+		return clSP
+	case '\u200B':
+		return clZW
+	case '\u00A0', '\u202F', '\u2007', '\u2060', '\uFEFF', '\u180E':
+		return clGL
+	case '\u200C', '\u200D':
+		return clCM
+	case '"', '\'':
+		return clQU
+	case '-':
+		return clHY
+	case '\t', '\u00AD', '\u2010', '\u2012', '\u2013', '\u2014', '\u3000', '|':
+		return clBA
+	case '!', '?', '！', '？':
+		return clEX
+	case ',', '.', ':', ';', '/', '：', '；':
+		return clIS
+	case '、', '。', '，', '．', '｡', '､', '〕', '〉', '》', '」', '』', '】', '〙', '〗', '〟', '｠':
+		return clCL
+	case 'ー', '々', '〻', 'ゝ', 'ゞ', 'ヽ', 'ヾ', '・', '･', '‥', '…', '〜', '～', '゠', '‼', '⁇', '⁈', '⁉',
+		'ぁ', 'ぃ', 'ぅ', 'ぇ', 'ぉ', 'っ', 'ゃ', 'ゅ', 'ょ', 'ゎ', 'ゕ', 'ゖ',
+		'ァ', 'ィ', 'ゥ', 'ェ', 'ォ', 'ッ', 'ャ', 'ュ', 'ョ', 'ヮ', 'ヵ', 'ヶ':
+		return clNS
+	}
+	switch {
+	case r >= 0x31F0 && r <= 0x31FF: // 片假名语音扩展中的小写假名
+		return clNS
+	case unicode.In(r, unicode.Mn, unicode.Me) || r >= 0xFE00 && r <= 0xFE0F || r >= 0x1F3FB && r <= 0x1F3FF:
+		return clCM
+	case unicode.Is(unicode.Ps, r):
+		return clOP
+	case unicode.Is(unicode.Pe, r):
+		return clCL
+	case unicode.Is(unicode.Pi, r):
+		return clOP // 中文引号“‘之后不断行
+	case unicode.Is(unicode.Pf, r):
+		return clCL // 中文引号”’之前不断行
+	case unicode.Is(unicode.Nd, r):
+		return clNU
+	case unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul, unicode.Bopomofo, unicode.Yi):
+		return clID
+	case r >= 0x3000 && r <= 0x303F, r >= 0xFF01 && r <= 0xFF60, r >= 0x3200 && r <= 0x33FF:
+		return clID // CJK符号、全角字符和带圈字符
+	case r >= 0x1F300 && r <= 0x1FAFF, r >= 0x2600 && r <= 0x27BF:
+		return clID // emoji
+	}
+	return clAL
+}
@@ -0,0 +1,405 @@
+package fontcache
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/jpeg" // 注册JPEG解码器
+	_ "image/png"  // 注册PNG解码器
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/tdewolff/canvas"
+	"github.com/tdewolff/canvas/renderers/rasterizer"
+)
+
+// ErrInvalidPaint 颜色字符串既不是纯色也不是支持的渐变或图案
+var ErrInvalidPaint = errors.New("颜色格式无效")
+
+// ErrPatternStroke 图案不能用于描边
+var ErrPatternStroke = errors.New("图案不能用于描边")
+
+// patternDPMM 图案按每毫米12像素（约300 DPI）栅格化
+const patternDPMM = 12.0
+
+// PaintKind 颜料类型
+type PaintKind int
+
+const (
+	PaintSolid   PaintKind = iota // 纯色
+	PaintLinear                   // 线性渐变
+	PaintRadial                   // 径向渐变
+	PaintPattern                  // 图片图案
+)
+
+// ColorStop 渐变的颜色节点
+type ColorStop struct {
+	Offset float64    // 位置，0-1
+	Color  color.RGBA // 颜色
+}
+
+// Paint 填充或描边使用的颜料：纯色、线性渐变、径向渐变或图片图案
+// 渐变和图案按所填充图形的边界框定位，SVG和PDF中渐变输出为原生渐变
+// 图案使用本包的SVG()和PDF()写出时输出为原生图案（SVG的<pattern>和PDF的平铺图案），图形保持矢量；
+// 位图格式和其他写出方式中按patternDPMM（约300 DPI）栅格化为裁剪成图形形状的位图；图案只能用于填充，不能用于描边
+type Paint struct {
+	Kind      PaintKind
+	Color     color.RGBA  // 纯色
+	Stops     []ColorStop // 渐变的颜色节点
+	Angle     float64     // 线性渐变的方向（度数），与CSS相同：0为从下到上，90为从左到右，180为从上到下
+	CX, CY    float64     // 径向渐变圆心相对边界框中心的偏移，按边界框宽高的比例，向右、向上为正
+	Radius    float64     // 径向渐变半径相对圆心到边界框最远角距离的比例，0为1
+	Image     image.Image // 图案图片
+	TileWidth float64     // 图案平铺时每块的宽度，0时图片等比缩放至覆盖整个边界框
+}
+
+// SolidPaint 返回纯色颜料
+func SolidPaint(c color.RGBA) Paint {
+	return Paint{Kind: PaintSolid, Color: c}
+}
+
+// ParsePaint 解析颜色字符串，parseColor解析纯色和渐变节点的颜色，为nil时使用canvas.Hex
+// 支持的格式：
+//   - 纯色，例如"#FF0000"
+//   - 线性渐变，例如"linear-gradient(90deg, #FF0000, #0000FF 80%)"，方向也可以写为"to right"、"to top left"等，默认从上到下
+//   - 径向渐变，例如"radial-gradient(at 30% 40%, #FFFFFF, #000000)"，默认圆心为边界框中心
+//   - 图片图案，例如"url(wood.png)"，后面加数字时按该宽度平铺，例如"url(wood.png) 20"，只能用于填充，见Paint
+func ParsePaint(s string, parseColor func(string) color.RGBA) (Paint, error) {
+	if parseColor == nil {
+		parseColor = canvas.Hex
+	}
+	s = strings.TrimSpace(s)
+	lower := strings.ToLower(s)
+	switch {
+	case strings.HasPrefix(lower, "url("):
+		end := strings.IndexByte(s, ')')
+		if end == -1 {
+			return Paint{}, fmt.Errorf("%w: %s", ErrInvalidPaint, s)
+		}
+		paint := Paint{Kind: PaintPattern}
+		if rest := strings.TrimSpace(s[end+1:]); rest != "" {
+			width, err := strconv.ParseFloat(rest, 64)
+			if err != nil {
+				return Paint{}, fmt.Errorf("%w: %s", ErrInvalidPaint, s)
+			}
+			paint.TileWidth = width
+		}
+		img, err := loadPatternImage(strings.Trim(strings.TrimSpace(s[4:end]), `"'`))
+		if err != nil {
+			return Paint{}, err
+		}
+		paint.Image = img
+		return paint, nil
+
+	case strings.HasPrefix(lower, "linear-gradient(") && strings.HasSuffix(s, ")"):
+		args := splitArgs(s[len("linear-gradient(") : len(s)-1])
+		paint := Paint{Kind: PaintLinear, Angle: 180}
+		if angle, ok := gradientAngle(args[0]); ok {
+			paint.Angle = angle
+			args = args[1:]
+		}
+		stops, err := parseStops(args, parseColor)
+		if err != nil {
+			return Paint{}, fmt.Errorf("%w: %s", err, s)
+		}
+		paint.Stops = stops
+		return paint, nil
+
+	case strings.HasPrefix(lower, "radial-gradient(") && strings.HasSuffix(s, ")"):
+		args := splitArgs(s[len("radial-gradient(") : len(s)-1])
+		paint := Paint{Kind: PaintRadial}
+		if first := strings.ToLower(args[0]); strings.HasPrefix(first, "at ") || strings.HasPrefix(first, "circle") {
+			if _, pos, ok := strings.Cut(first, "at "); ok {
+				fields := strings.Fields(pos)
+				if len(fields) != 2 {
+					return Paint{}, fmt.Errorf("%w: %s", ErrInvalidPaint, s)
+				}
+				x, errX := parsePercent(fields[0])
+				y, errY := parsePercent(fields[1])
+				if errX != nil || errY != nil {
+					return Paint{}, fmt.Errorf("%w: %s", ErrInvalidPaint, s)
+				}
+				paint.CX, paint.CY = x-0.5, 0.5-y
+			}
+			args = args[1:]
+		}
+		stops, err := parseStops(args, parseColor)
+		if err != nil {
+			return Paint{}, fmt.Errorf("%w: %s", err, s)
+		}
+		paint.Stops = stops
+		return paint, nil
+
+	case strings.Contains(s, "("):
+		return Paint{}, fmt.Errorf("%w: %s", ErrInvalidPaint, s)
+	}
+	return SolidPaint(parseColor(s)), nil
+}
+
+// splitArgs 按不在括号内的逗号拆分参数，至少返回一个元素
+func splitArgs(s string) []string {
+	var args []string
+	depth, start := 0, 0
+	for i, r := range s {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				args = append(args, strings.TrimSpace(s[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	return append(args, strings.TrimSpace(s[start:]))
+}
+
+// gradientAngle 解析线性渐变的方向，例如"90deg"或"to right"
+func gradientAngle(s string) (float64, bool) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if strings.HasSuffix(s, "deg") {
+		angle, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(s, "deg")), 64)
+		return angle, err == nil
+	}
+	sides := map[string]float64{
+		"to top": 0, "to top right": 45, "to right top": 45, "to right": 90,
+		"to bottom right": 135, "to right bottom": 135, "to bottom": 180,
+		"to bottom left": 225, "to left bottom": 225, "to left": 270,
+		"to top left": 315, "to left top": 315,
+	}
+	angle, ok := sides[strings.Join(strings.Fields(s), " ")]
+	return angle, ok
+}
+
+// parsePercent 解析百分比，例如"40%"返回0.4
+func parsePercent(s string) (float64, error) {
+	if !strings.HasSuffix(s, "%") {
+		return 0, ErrInvalidPaint
+	}
+	v, err := strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+	if err != nil {
+		return 0, ErrInvalidPaint
+	}
+	return v / 100, nil
+}
+
+// parseStops 解析渐变节点，例如"#FF0000"或"#FF0000 30%"
+// 未指定位置时第一个节点为0，最后一个为1，中间的节点在前后已知位置之间均匀分布
+func parseStops(args []string, parseColor func(string) color.RGBA) ([]ColorStop, error) {
+	if len(args) == 0 || args[0] == "" {
+		return nil, ErrInvalidPaint
+	}
+	stops := make([]ColorStop, len(args))
+	known := make([]bool, len(args))
+	for i, arg := range args {
+		fields := strings.Fields(arg)
+		if len(fields) == 0 || len(fields) > 2 {
+			return nil, ErrInvalidPaint
+		}
+		stops[i].Color = parseColor(fields[0])
+		if len(fields) == 2 {
+			offset, err := parsePercent(fields[1])
+			if err != nil {
+				return nil, err
+			}
+			stops[i].Offset, known[i] = offset, true
+		}
+	}
+	if !known[0] {
+		stops[0].Offset, known[0] = 0, true
+	}
+	if last := len(stops) - 1; !known[last] {
+		stops[last].Offset, known[last] = 1, true
+	}
+	for i := 1; i < len(stops); i++ {
+		if known[i] {
+			continue
+		}
+		j := i + 1
+		for !known[j] {
+			j++
+		}
+		from, to := stops[i-1].Offset, stops[j].Offset
+		for k := i; k < j; k++ {
+			stops[k].Offset = from + (to-from)*float64(k-i+1)/float64(j-i+1)
+			known[k] = true
+		}
+	}
+	return stops, nil
+}
+
+// patternImages 已加载的图案图片，按路径缓存
+var patternImages sync.Map
+
+// loadPatternImage 加载PNG或JPEG图案图片，相同路径只解码一次
+func loadPatternImage(path string) (image.Image, error) {
+	if img, ok := patternImages.Load(path); ok {
+		return img.(image.Image), nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("加载图案图片失败: %w", err)
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("解码图案图片失败: %w", err)
+	}
+	patternImages.Store(path, img)
+	return img, nil
+}
+
+// CheckStroke 检查p能否用于描边，图案返回ErrPatternStroke
+func CheckStroke(p Paint) error {
+	if p.Kind == PaintPattern {
+		return ErrPatternStroke
+	}
+	return nil
+}
+
+// canvasPaint 返回按rect定位的canvas颜料，图案不能直接设置为颜料，返回Color
+func (p Paint) canvasPaint(rect canvas.Rect) canvas.Paint {
+	switch p.Kind {
+	case PaintLinear:
+		// 与CSS相同，渐变线穿过边界框中心，长度使边界框的角落正好位于起点和终点的垂线上
+		sin, cos := math.Sincos(p.Angle * math.Pi / 180.0)
+		half := (math.Abs(rect.W()*sin) + math.Abs(rect.H()*cos)) / 2.0
+		cx, cy := (rect.X0+rect.X1)/2.0, (rect.Y0+rect.Y1)/2.0
+		g := canvas.NewLinearGradient(canvas.Point{X: cx - sin*half, Y: cy - cos*half}, canvas.Point{X: cx + sin*half, Y: cy + cos*half})
+		for _, stop := range p.Stops {
+			g.Add(stop.Offset, stop.Color)
+		}
+		return canvas.Paint{Gradient: g}
+	case PaintRadial:
+		c := canvas.Point{X: (rect.X0+rect.X1)/2.0 + p.CX*rect.W(), Y: (rect.Y0+rect.Y1)/2.0 + p.CY*rect.H()}
+		r := math.Hypot(math.Max(c.X-rect.X0, rect.X1-c.X), math.Max(c.Y-rect.Y0, rect.Y1-c.Y))
+		if p.Radius > 0 {
+			r *= p.Radius
+		}
+		g := canvas.NewRadialGradient(c, 0, c, r)
+		for _, stop := range p.Stops {
+			g.Add(stop.Offset, stop.Color)
+		}
+		return canvas.Paint{Gradient: g}
+	}
+	return canvas.Paint{Color: p.Color}
+}
+
+// DrawPath 使用fill填充path，strokeWidth大于0时使用stroke描边
+// rect为渐变和图案定位用的边界框，与path使用相同坐标，通常为path本身或整段文本的边界框
+// 图案不能用于描边，stroke为图案时不描边，调用方应先用CheckStroke检查
+func DrawPath(ctx *canvas.Context, path *canvas.Path, rect canvas.Rect, fill, stroke Paint, strokeWidth float64) {
+	ctx.Push()
+	defer ctx.Pop()
+
+	if fill.Kind == PaintPattern {
+		drawPattern(ctx, path, rect, fill)
+		fill = SolidPaint(canvas.Transparent)
+	}
+	ctx.SetFill(fill.canvasPaint(rect))
+	if strokeWidth > 0 && stroke.Kind != PaintPattern {
+		ctx.SetStroke(stroke.canvasPaint(rect))
+		ctx.SetStrokeWidth(strokeWidth)
+	} else {
+		ctx.SetStrokeColor(canvas.Transparent)
+	}
+	ctx.DrawPath(0, 0, path)
+}
+
+// patternImage 栅格化后的图案图片，同时保留填充的路径和图案的位置，SVG()和PDF()据此输出原生图案
+type patternImage struct {
+	*image.RGBA
+	path  *canvas.Path  // 填充的路径
+	image image.Image   // 图案图片
+	view  canvas.Matrix // 栅格化图片的像素坐标到路径坐标的变换
+	tile  canvas.Matrix // 图案空间（图案图片的像素坐标，y轴向下）到路径坐标的变换
+}
+
+// tileMatrix 返回图案空间（图片的像素坐标，y轴向下）到rect所在坐标的变换，与drawPattern的取色方式一致
+func (p Paint) tileMatrix(rect canvas.Rect) canvas.Matrix {
+	src := p.Image.Bounds()
+	imgW, imgH := float64(src.Dx()), float64(src.Dy())
+	if p.TileWidth > 0 {
+		scale := p.TileWidth / imgW
+		return canvas.Identity.Translate(rect.X0, rect.Y1).Scale(scale, -scale)
+	}
+	scale := math.Max(rect.W()/imgW, rect.H()/imgH)
+	return canvas.Identity.Translate((rect.X0+rect.X1)/2.0, (rect.Y0+rect.Y1)/2.0).Scale(scale, -scale).Translate(-imgW/2.0, -imgH/2.0)
+}
+
+// drawPattern 将图案裁剪为path的形状后作为图片绘制
+// 先按patternDPMM栅格化path得到遮罩，再逐像素从平铺或覆盖rect的图案中取色
+func drawPattern(ctx *canvas.Context, path *canvas.Path, rect canvas.Rect, paint Paint) {
+	if paint.Image == nil || path.Empty() {
+		return
+	}
+	bounds := path.Bounds()
+	maskCanvas := canvas.New(bounds.W(), bounds.H())
+	maskCtx := canvas.NewContext(maskCanvas)
+	maskCtx.SetFillColor(canvas.Black)
+	maskCtx.DrawPath(-bounds.X0, -bounds.Y0, path)
+	mask := rasterizer.Draw(maskCanvas, canvas.DPMM(patternDPMM), canvas.DefaultColorSpace)
+
+	src := paint.Image.Bounds()
+	imgW, imgH := float64(src.Dx()), float64(src.Dy())
+	if imgW == 0 || imgH == 0 {
+		return
+	}
+	// sample 返回图案在(x, y)处的颜色，y轴向上
+	sample := func(x, y float64) color.Color {
+		var u, v float64
+		if paint.TileWidth > 0 {
+			tileW, tileH := paint.TileWidth, paint.TileWidth*imgH/imgW
+			u = positiveMod(x-rect.X0, tileW) / tileW * imgW
+			v = positiveMod(rect.Y1-y, tileH) / tileH * imgH
+		} else {
+			scale := math.Max(rect.W()/imgW, rect.H()/imgH)
+			u = (x-(rect.X0+rect.X1)/2.0)/scale + imgW/2.0
+			v = ((rect.Y0+rect.Y1)/2.0-y)/scale + imgH/2.0
+		}
+		px := min(max(int(u), 0), src.Dx()-1)
+		py := min(max(int(v), 0), src.Dy()-1)
+		return paint.Image.At(src.Min.X+px, src.Min.Y+py)
+	}
+
+	out := image.NewRGBA(mask.Bounds())
+	for py := mask.Rect.Min.Y; py < mask.Rect.Max.Y; py++ {
+		for px := mask.Rect.Min.X; px < mask.Rect.Max.X; px++ {
+			a := uint32(mask.RGBAAt(px, py).A)
+			if a == 0 {
+				continue
+			}
+			x := bounds.X0 + (float64(px)+0.5)/patternDPMM
+			y := bounds.Y1 - (float64(py)+0.5)/patternDPMM
+			r, g, b, ca := sample(x, y).RGBA()
+			out.SetRGBA(px, py, color.RGBA{
+				R: uint8(r * a / 255 >> 8),
+				G: uint8(g * a / 255 >> 8),
+				B: uint8(b * a / 255 >> 8),
+				A: uint8(ca * a / 255 >> 8),
+			})
+		}
+	}
+	ctx.DrawImage(bounds.X0, bounds.Y0, &patternImage{
+		RGBA:  out,
+		path:  path,
+		image: paint.Image,
+		view:  canvas.Identity.Translate(bounds.X0, bounds.Y0).Scale(1.0/patternDPMM, 1.0/patternDPMM),
+		tile:  paint.tileMatrix(rect),
+	}, canvas.DPMM(patternDPMM))
+}
+
+// positiveMod 返回x除以m的非负余数
+func positiveMod(x, m float64) float64 {
+	x = math.Mod(x, m)
+	if x < 0 {
+		x += m
+	}
+	return x
+}
@@ -0,0 +1,629 @@
+package fontcache
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/tdewolff/canvas"
+)
+
+// errPDFStructure PDF的结构不是预期的单页面、交叉引用表格式，无法输出原生图案
+var errPDFStructure = errors.New("无法解析PDF结构")
+
+var (
+	pdfStartXref = regexp.MustCompile(`startxref\s+(\d+)\s+%%EOF\s*$`)
+	pdfObjStart  = regexp.MustCompile(`^\s*(\d+)\s+(\d+)\s+obj\s*`)
+	pdfRef       = regexp.MustCompile(`(\d+)\s+(\d+)\s+R`)
+)
+
+// pdfObject 交叉引用表中的对象位置
+type pdfObject struct {
+	offset int
+	gen    int
+}
+
+// pdfFile 解析后的PDF，只读取交叉引用表、trailer和需要修改的对象
+type pdfFile struct {
+	data    []byte
+	objects map[int]pdfObject
+	trailer []byte // 最后一个trailer字典
+	xref    int    // 最后一个交叉引用表的位置
+	size    int
+}
+
+// parsePDF 读取交叉引用表（包括/Prev指向的之前的表）和最后的trailer，不支持交叉引用流
+func parsePDF(data []byte) (*pdfFile, error) {
+	match := pdfStartXref.FindSubmatch(data)
+	if match == nil {
+		return nil, errPDFStructure
+	}
+	xref, _ := strconv.Atoi(string(match[1]))
+	f := &pdfFile{data: data, objects: map[int]pdfObject{}, xref: xref}
+	for offset, seen := xref, map[int]bool{}; !seen[offset]; seen[offset] = true {
+		trailer, err := f.parseXref(offset)
+		if err != nil {
+			return nil, err
+		}
+		if f.trailer == nil {
+			f.trailer = trailer
+			size, err := strconv.Atoi(string(dictValue(trailer, "Size")))
+			if err != nil {
+				return nil, errPDFStructure
+			}
+			f.size = size
+		}
+		prev, err := strconv.Atoi(string(dictValue(trailer, "Prev")))
+		if err != nil {
+			break
+		}
+		offset = prev
+	}
+	return f, nil
+}
+
+// parseXref 读取offset处的交叉引用表，已有的（更新的）对象位置不被覆盖，返回其后的trailer字典
+func (f *pdfFile) parseXref(offset int) ([]byte, error) {
+	if offset < 0 || offset >= len(f.data) || !bytes.HasPrefix(f.data[offset:], []byte("xref")) {
+		return nil, errPDFStructure
+	}
+	pos := offset + len("xref")
+	for {
+		token, next := nextToken(f.data, pos)
+		if string(token) == "trailer" {
+			pos = skipSpace(f.data, next)
+			end := skipValue(f.data, pos)
+			if end <= pos || !bytes.HasPrefix(f.data[pos:], []byte("<<")) {
+				return nil, errPDFStructure
+			}
+			return f.data[pos:end], nil
+		}
+		first, err1 := strconv.Atoi(string(token))
+		token, next = nextToken(f.data, next)
+		count, err2 := strconv.Atoi(string(token))
+		if err1 != nil || err2 != nil {
+			return nil, errPDFStructure
+		}
+		for i := 0; i < count; i++ {
+			var fields [3][]byte
+			for j := range fields {
+				fields[j], next = nextToken(f.data, next)
+			}
+			objOffset, err1 := strconv.Atoi(string(fields[0]))
+			gen, err2 := strconv.Atoi(string(fields[1]))
+			if err1 != nil || err2 != nil {
+				return nil, errPDFStructure
+			}
+			if _, ok := f.objects[first+i]; !ok && string(fields[2]) == "n" {
+				f.objects[first+i] = pdfObject{offset: objOffset, gen: gen}
+			}
+		}
+		pos = next
+	}
+}
+
+// object 返回对象的值，对象为流时同时返回流的原始数据
+func (f *pdfFile) object(num int) ([]byte, []byte, error) {
+	obj, ok := f.objects[num]
+	if !ok || obj.offset >= len(f.data) {
+		return nil, nil, errPDFStructure
+	}
+	match := pdfObjStart.FindIndex(f.data[obj.offset:])
+	if match == nil {
+		return nil, nil, errPDFStructure
+	}
+	start := obj.offset + match[1]
+	end := skipValue(f.data, start)
+	value := f.data[start:end]
+	pos := skipSpace(f.data, end)
+	if !bytes.HasPrefix(f.data[pos:], []byte("stream")) {
+		return value, nil, nil
+	}
+	pos += len("stream")
+	if bytes.HasPrefix(f.data[pos:], []byte("\r\n")) {
+		pos += 2
+	} else if pos < len(f.data) && f.data[pos] == '\n' {
+		pos++
+	}
+	length, err := f.int(dictValue(value, "Length"))
+	if err != nil || length < 0 || pos+length > len(f.data) {
+		return nil, nil, errPDFStructure
+	}
+	return value, f.data[pos : pos+length], nil
+}
+
+// int 返回整数值，value为间接引用时读取所引用的对象
+func (f *pdfFile) int(value []byte) (int, error) {
+	if ref := pdfRef.FindSubmatch(value); ref != nil {
+		num, _ := strconv.Atoi(string(ref[1]))
+		obj, _, err := f.object(num)
+		if err != nil {
+			return 0, err
+		}
+		value = obj
+	}
+	return strconv.Atoi(string(bytes.TrimSpace(value)))
+}
+
+// page 返回唯一的页面对象的编号，有多个页面时返回错误
+func (f *pdfFile) page() (int, error) {
+	page := -1
+	for num := range f.objects {
+		value, _, err := f.object(num)
+		if err != nil || !bytes.HasPrefix(value, []byte("<<")) {
+			continue
+		}
+		if string(dictValue(value, "Type")) == "/Page" {
+			if page != -1 {
+				return 0, errPDFStructure
+			}
+			page = num
+		}
+	}
+	if page == -1 {
+		return 0, errPDFStructure
+	}
+	return page, nil
+}
+
+// pdfPatterns 以增量更新的方式将页面内容中的标记颜色替换为平铺图案
+// 原文件内容保持不变，在末尾追加修改后的页面内容、资源字典和新的图案、图片对象
+// width、height为画布尺寸，用于将画布坐标转换为页面坐标
+func pdfPatterns(data []byte, marks []patternMark, width, height float64) ([]byte, error) {
+	f, err := parsePDF(data)
+	if err != nil {
+		return nil, err
+	}
+	pageNum, err := f.page()
+	if err != nil {
+		return nil, err
+	}
+	page, _, _ := f.object(pageNum)
+
+	// 图案名称和新对象的编号
+	nextNum := f.size
+	names := make([]string, len(marks))
+	for i := range marks {
+		names[i] = fmt.Sprintf("/FontcachePattern%d", i)
+	}
+
+	// 替换页面内容中的标记颜色
+	changed := map[int][]byte{}
+	replaced := make([]int, len(marks))
+	for _, ref := range pdfRef.FindAllSubmatch(dictValue(page, "Contents"), -1) {
+		num, _ := strconv.Atoi(string(ref[1]))
+		dict, stream, err := f.object(num)
+		if err != nil || stream == nil {
+			return nil, errPDFStructure
+		}
+		content := stream
+		switch filter := string(dictValue(dict, "Filter")); filter {
+		case "":
+		case "/FlateDecode", "[/FlateDecode]":
+			if dictValue(dict, "DecodeParms") != nil {
+				return nil, errPDFStructure
+			}
+			r, err := zlib.NewReader(bytes.NewReader(stream))
+			if err != nil {
+				return nil, err
+			}
+			if content, err = io.ReadAll(r); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, errPDFStructure
+		}
+		content, err = replaceMarkColors(content, marks, names, replaced)
+		if err != nil {
+			return nil, err
+		}
+		changed[num] = flateStream("", content)
+	}
+	for _, n := range replaced {
+		if n == 0 {
+			return nil, errPDFStructure
+		}
+	}
+
+	// 图案图片和图案对象
+	var added [][]byte
+	newObject := func(obj []byte) int {
+		added = append(added, obj)
+		nextNum++
+		return nextNum - 1
+	}
+	toPage := pageMatrix(page, width, height)
+	images := map[image.Image]int{}
+	var entries bytes.Buffer
+	for i, mark := range marks {
+		imageNum, ok := images[mark.image]
+		if !ok {
+			imageNum = newObject(nil)
+			images[mark.image] = imageNum
+			rgb, alpha := imageSamples(mark.image)
+			b := mark.image.Bounds()
+			dict := fmt.Sprintf("/Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceRGB /BitsPerComponent 8", b.Dx(), b.Dy())
+			if alpha != nil {
+				maskNum := newObject(flateStream(fmt.Sprintf("/Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceGray /BitsPerComponent 8", b.Dx(), b.Dy()), alpha))
+				dict += fmt.Sprintf(" /SMask %d 0 R", maskNum)
+			}
+			added[imageNum-f.size] = flateStream(dict, rgb)
+		}
+		b := mark.image.Bounds()
+		w, h := b.Dx(), b.Dy()
+		m := toPage.Mul(mark.matrix)
+		dict := fmt.Sprintf("/Type /Pattern /PatternType 1 /PaintType 1 /TilingType 1 /BBox [0 0 %d %d] /XStep %d /YStep %d /Matrix [%s %s %s %s %s %s] /Resources << /XObject << /FontcacheImage %d 0 R >> >>",
+			w, h, w, h, num(m[0][0]), num(m[1][0]), num(m[0][1]), num(m[1][1]), num(m[0][2]), num(m[1][2]), imageNum)
+		// 图案空间的y轴向下，图片的第一行位于y=0
+		patternNum := newObject(flateStream(dict, []byte(fmt.Sprintf("q %d 0 0 %d 0 %d cm /FontcacheImage Do Q", w, -h, h))))
+		fmt.Fprintf(&entries, " %s %d 0 R", names[i], patternNum)
+	}
+
+	// 在页面资源的/Pattern字典中加入图案，资源字典和/Pattern字典可以直接写在所在字典中，也可以是间接引用
+	if err := addPatternResources(f, pageNum, page, entries.String(), changed); err != nil {
+		return nil, err
+	}
+
+	// 追加修改和新增的对象、交叉引用表和trailer
+	var buf bytes.Buffer
+	buf.Write(data)
+	if !bytes.HasSuffix(data, []byte("\n")) {
+		buf.WriteByte('\n')
+	}
+	offsets := map[int]int{}
+	gens := map[int]int{}
+	for num, obj := range changed {
+		gens[num] = f.objects[num].gen
+		offsets[num] = buf.Len()
+		fmt.Fprintf(&buf, "%d %d obj\n%s\nendobj\n", num, gens[num], obj)
+	}
+	for i, obj := range added {
+		offsets[f.size+i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", f.size+i, obj)
+	}
+	nums := make([]int, 0, len(offsets))
+	for num := range offsets {
+		nums = append(nums, num)
+	}
+	sort.Ints(nums)
+	xrefOffset := buf.Len()
+	buf.WriteString("xref\n")
+	for _, num := range nums {
+		fmt.Fprintf(&buf, "%d 1\n%010d %05d n \n", num, offsets[num], gens[num])
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root %s", nextNum, dictValue(f.trailer, "Root"))
+	if info := dictValue(f.trailer, "Info"); info != nil {
+		fmt.Fprintf(&buf, " /Info %s", info)
+	}
+	fmt.Fprintf(&buf, " /Prev %d >>\nstartxref\n%d\n%%%%EOF\n", f.xref, xrefOffset)
+	return buf.Bytes(), nil
+}
+
+// addPatternResources 将图案条目加入页面资源的/Pattern字典，修改后的对象写入changed
+func addPatternResources(f *pdfFile, pageNum int, page []byte, entries string, changed map[int][]byte) error {
+	start, end := dictValueIndex(page, "Resources")
+	if start == -1 {
+		changed[pageNum] = insertDictEntries(page, " /Resources << /Pattern <<"+entries+" >> >>")
+		return nil
+	}
+	resources := page[start:end]
+	resNum := -1
+	if !bytes.HasPrefix(resources, []byte("<<")) {
+		ref := pdfRef.FindSubmatch(resources)
+		if ref == nil {
+			return errPDFStructure
+		}
+		resNum, _ = strconv.Atoi(string(ref[1]))
+		obj, _, err := f.object(resNum)
+		if err != nil || !bytes.HasPrefix(obj, []byte("<<")) {
+			return errPDFStructure
+		}
+		resources = obj
+	}
+
+	var updated []byte
+	patStart, patEnd := dictValueIndex(resources, "Pattern")
+	switch {
+	case patStart == -1:
+		updated = insertDictEntries(resources, " /Pattern <<"+entries+" >>")
+	case bytes.HasPrefix(resources[patStart:], []byte("<<")):
+		updated = splice(resources, patStart, patEnd, insertDictEntries(resources[patStart:patEnd], entries))
+	default:
+		ref := pdfRef.FindSubmatch(resources[patStart:patEnd])
+		if ref == nil {
+			return errPDFStructure
+		}
+		patNum, _ := strconv.Atoi(string(ref[1]))
+		obj, _, err := f.object(patNum)
+		if err != nil || !bytes.HasPrefix(obj, []byte("<<")) {
+			return errPDFStructure
+		}
+		changed[patNum] = insertDictEntries(obj, entries)
+		return nil
+	}
+	if resNum == -1 {
+		changed[pageNum] = splice(page, start, end, updated)
+	} else {
+		changed[resNum] = updated
+	}
+	return nil
+}
+
+// splice 返回将data[start:end]替换为value后的副本
+func splice(data []byte, start, end int, value []byte) []byte {
+	out := append([]byte{}, data[:start]...)
+	out = append(out, value...)
+	return append(out, data[end:]...)
+}
+
+// replaceMarkColors 将内容流中设置为标记颜色的"r g b rg"替换为"/Pattern cs /名称 scn"，replaced累加每个标记的替换次数
+func replaceMarkColors(content []byte, marks []patternMark, names []string, replaced []int) ([]byte, error) {
+	var out bytes.Buffer
+	var operands [][2]int // 操作数在content中的范围
+	last := 0
+	for pos := skipSpace(content, 0); pos < len(content); pos = skipSpace(content, pos) {
+		end := skipValue(content, pos)
+		if end <= pos {
+			return nil, errPDFStructure
+		}
+		token := string(content[pos:end])
+		if !isOperator(content[pos]) {
+			operands = append(operands, [2]int{pos, end})
+			pos = end
+			continue
+		}
+		if token == "BI" {
+			return nil, errPDFStructure // 不支持内嵌图片
+		}
+		if token == "rg" && len(operands) == 3 {
+			if i := markIndex(content, operands, marks); i != -1 {
+				out.Write(content[last:operands[0][0]])
+				out.WriteString("/Pattern cs " + names[i] + " scn")
+				last = end
+				replaced[i]++
+			}
+		}
+		operands = operands[:0]
+		pos = end
+	}
+	out.Write(content[last:])
+	return out.Bytes(), nil
+}
+
+// markIndex 返回三个操作数组成的RGB颜色对应的标记序号，不是标记颜色时返回-1
+func markIndex(content []byte, operands [][2]int, marks []patternMark) int {
+	var c [3]uint8
+	for i, operand := range operands {
+		v, err := strconv.ParseFloat(string(content[operand[0]:operand[1]]), 64)
+		if err != nil || v < 0 || v > 1 {
+			return -1
+		}
+		c[i] = uint8(math.Round(v * 255))
+	}
+	for i, mark := range marks {
+		if mark.color.R == c[0] && mark.color.G == c[1] && mark.color.B == c[2] {
+			return i
+		}
+	}
+	return -1
+}
+
+// pageMatrix 返回画布坐标（毫米，y轴向上）到页面默认坐标的变换，按页面的MediaBox缩放，没有MediaBox时按毫米转换为点
+func pageMatrix(page []byte, width, height float64) canvas.Matrix {
+	var box [4]float64
+	fields := bytes.Fields(bytes.Trim(dictValue(page, "MediaBox"), "[]"))
+	if len(fields) == 4 && width > 0 && height > 0 {
+		for i, field := range fields {
+			v, err := strconv.ParseFloat(string(field), 64)
+			if err != nil {
+				break
+			}
+			box[i] = v
+		}
+		if box[2] > box[0] && box[3] > box[1] {
+			return canvas.Identity.Translate(box[0], box[1]).Scale((box[2]-box[0])/width, (box[3]-box[1])/height)
+		}
+	}
+	return canvas.Identity.Scale(72.0/25.4, 72.0/25.4)
+}
+
+// imageSamples 返回图片的RGB数据和透明度数据，图片完全不透明时透明度数据为nil
+func imageSamples(img image.Image) ([]byte, []byte) {
+	b := img.Bounds()
+	rgb := make([]byte, 0, b.Dx()*b.Dy()*3)
+	alpha := make([]byte, 0, b.Dx()*b.Dy())
+	opaque := true
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			rgb = append(rgb, c.R, c.G, c.B)
+			alpha = append(alpha, c.A)
+			opaque = opaque && c.A == 0xFF
+		}
+	}
+	if opaque {
+		return rgb, nil
+	}
+	return rgb, alpha
+}
+
+// flateStream 返回使用FlateDecode压缩的流对象，dict为除/Length和/Filter之外的字典内容
+func flateStream(dict string, data []byte) []byte {
+	var z bytes.Buffer
+	zw := zlib.NewWriter(&z)
+	zw.Write(data)
+	zw.Close()
+	if dict != "" {
+		dict += " "
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "<< %s/Filter /FlateDecode /Length %d >>\nstream\n", dict, z.Len())
+	buf.Write(z.Bytes())
+	buf.WriteString("\nendstream")
+	return buf.Bytes()
+}
+
+// insertDictEntries 在字典的"<<"之后插入条目
+func insertDictEntries(dict []byte, entries string) []byte {
+	out := append([]byte{}, dict[:2]...)
+	out = append(out, entries...)
+	return append(out, dict[2:]...)
+}
+
+// dictValue 返回字典中键key的值，只查找最外层的键，不存在时返回nil
+func dictValue(dict []byte, key string) []byte {
+	start, end := dictValueIndex(dict, key)
+	if start == -1 {
+		return nil
+	}
+	return dict[start:end]
+}
+
+// dictValueIndex 返回字典中键key的值的范围，不存在时返回-1, -1
+func dictValueIndex(dict []byte, key string) (int, int) {
+	if !bytes.HasPrefix(dict, []byte("<<")) {
+		return -1, -1
+	}
+	pos := 2
+	for {
+		pos = skipSpace(dict, pos)
+		if pos >= len(dict) || bytes.HasPrefix(dict[pos:], []byte(">>")) {
+			return -1, -1
+		}
+		keyEnd := skipValue(dict, pos)
+		valueStart := skipSpace(dict, keyEnd)
+		valueEnd := skipValue(dict, valueStart)
+		if keyEnd <= pos || valueEnd <= valueStart {
+			return -1, -1
+		}
+		if string(dict[pos:keyEnd]) == "/"+key {
+			return valueStart, valueEnd
+		}
+		pos = valueEnd
+	}
+}
+
+// nextToken 返回pos之后的下一个值及其结束位置
+func nextToken(data []byte, pos int) ([]byte, int) {
+	pos = skipSpace(data, pos)
+	end := skipValue(data, pos)
+	return data[pos:end], end
+}
+
+// skipSpace 跳过空白和注释
+func skipSpace(data []byte, pos int) int {
+	for pos < len(data) {
+		switch c := data[pos]; {
+		case c == '%':
+			for pos < len(data) && data[pos] != '\n' && data[pos] != '\r' {
+				pos++
+			}
+		case isSpace(c):
+			pos++
+		default:
+			return pos
+		}
+	}
+	return pos
+}
+
+// skipValue 返回从pos开始的一个值的结束位置：字典、数组、字符串、名称、间接引用、数字或操作符
+func skipValue(data []byte, pos int) int {
+	if pos >= len(data) {
+		return pos
+	}
+	switch data[pos] {
+	case '<':
+		if pos+1 < len(data) && data[pos+1] == '<' {
+			pos += 2
+			for {
+				pos = skipSpace(data, pos)
+				if pos >= len(data) {
+					return pos
+				}
+				if bytes.HasPrefix(data[pos:], []byte(">>")) {
+					return pos + 2
+				}
+				end := skipValue(data, pos)
+				if end <= pos {
+					return pos
+				}
+				pos = end
+			}
+		}
+		end := bytes.IndexByte(data[pos:], '>')
+		if end == -1 {
+			return len(data)
+		}
+		return pos + end + 1
+	case '[':
+		pos++
+		for {
+			pos = skipSpace(data, pos)
+			if pos >= len(data) {
+				return pos
+			}
+			if data[pos] == ']' {
+				return pos + 1
+			}
+			end := skipValue(data, pos)
+			if end <= pos {
+				return pos
+			}
+			pos = end
+		}
+	case '(':
+		depth := 0
+		for ; pos < len(data); pos++ {
+			switch data[pos] {
+			case '\\':
+				pos++
+			case '(':
+				depth++
+			case ')':
+				depth--
+				if depth == 0 {
+					return pos + 1
+				}
+			}
+		}
+		return pos
+	case '>', ']', ')', '{', '}':
+		return pos
+	}
+	start := pos
+	if data[pos] == '/' {
+		pos++
+	}
+	for pos < len(data) && !isSpace(data[pos]) && !isDelimiter(data[pos]) {
+		pos++
+	}
+	// 间接引用"num gen R"作为一个值
+	if ref := pdfRef.FindIndex(data[start:min(len(data), start+32)]); ref != nil && ref[0] == 0 {
+		if end := start + ref[1]; end == len(data) || isSpace(data[end]) || isDelimiter(data[end]) {
+			return end
+		}
+	}
+	return pos
+}
+
+// isOperator 判断以c开头的内容流记号是否为操作符
+func isOperator(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '\'' || c == '"' || c == '*'
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\r' || c == '\t' || c == '\f' || c == 0
+}
+
+func isDelimiter(c byte) bool {
+	return c == '(' || c == ')' || c == '<' || c == '>' || c == '[' || c == ']' || c == '{' || c == '}' || c == '/' || c == '%'
+}
@@ -0,0 +1,325 @@
+package fontcache
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+	"unicode/utf16"
+)
+
+// SFNT 相关常量
+const (
+	sfntHeaderSize      = 12
+	sfntTableRecordSize = 16
+	ttcTag              = "ttcf"
+	maxReadSize         = 64 << 20 // 单次读取的上限，防止损坏的文件导致超大内存分配
+
+	nameFamily            = 1
+	nameSubfamily         = 2
+	nameTypographicFamily = 16
+	nameTypographicSub    = 17
+
+	platformUnicode   = 0
+	platformMacintosh = 1
+	platformWindows   = 3
+	languageEnglishUS = 0x0409
+
+	os2WeightOffset      = 4
+	os2FsSelectionOffset = 62
+	fsSelectionItalic    = 1
+)
+
+var ErrInvalidFont = errors.New("无效的字体文件")
+
+// runeRange 字体覆盖的连续字符区间
+type runeRange struct {
+	Lo, Hi rune
+}
+
+// readFontInfos 读取字体文件（含.ttc字体集合）中每个字体的名称、字重和字符覆盖范围
+// 只读取name、OS/2和cmap表，不解析字形数据
+func readFontInfos(r io.ReaderAt, path string) ([]FontInfo, error) {
+	header, err := readAt(r, 0, sfntHeaderSize)
+	if err != nil {
+		return nil, err
+	}
+
+	offsets := []int64{0}
+	if string(header[:4]) == ttcTag {
+		count := int(binary.BigEndian.Uint32(header[8:]))
+		list, err := readAt(r, sfntHeaderSize, 4*count)
+		if err != nil {
+			return nil, err
+		}
+		offsets = offsets[:0]
+		for i := 0; i < count; i++ {
+			offsets = append(offsets, int64(binary.BigEndian.Uint32(list[4*i:])))
+		}
+	}
+
+	var infos []FontInfo
+	for index, offset := range offsets {
+		info, err := readFontInfo(r, offset)
+		if err != nil {
+			continue // 跳过集合中无法解析的字体
+		}
+		info.Path, info.Index = path, index
+		infos = append(infos, info)
+	}
+	if len(infos) == 0 {
+		return nil, ErrInvalidFont
+	}
+	return infos, nil
+}
+
+// readFontInfo 读取offset处单个字体的信息
+func readFontInfo(r io.ReaderAt, offset int64) (FontInfo, error) {
+	header, err := readAt(r, offset, sfntHeaderSize)
+	if err != nil {
+		return FontInfo{}, err
+	}
+	switch string(header[:4]) {
+	case "\x00\x01\x00\x00", "OTTO", "true":
+	default:
+		return FontInfo{}, ErrInvalidFont
+	}
+
+	numTables := int(binary.BigEndian.Uint16(header[4:]))
+	records, err := readAt(r, offset+sfntHeaderSize, numTables*sfntTableRecordSize)
+	if err != nil {
+		return FontInfo{}, err
+	}
+	tables := map[string][]byte{}
+	for i := 0; i < numTables; i++ {
+		record := records[i*sfntTableRecordSize:]
+		switch tag := string(record[:4]); tag {
+		case "name", "OS/2", "cmap":
+			table, err := readAt(r, int64(binary.BigEndian.Uint32(record[8:])), int(binary.BigEndian.Uint32(record[12:])))
+			if err != nil {
+				return FontInfo{}, err
+			}
+			tables[tag] = table
+		}
+	}
+	if tables["name"] == nil || tables["cmap"] == nil {
+		return FontInfo{}, ErrInvalidFont
+	}
+
+	names := parseNames(tables["name"])
+	info := FontInfo{
+		Family: firstNonEmpty(names[nameTypographicFamily], names[nameFamily]),
+		Style:  firstNonEmpty(names[nameTypographicSub], names[nameSubfamily], "Regular"),
+		Weight: 400,
+	}
+	if info.Family == "" {
+		return FontInfo{}, ErrInvalidFont
+	}
+	if os2 := tables["OS/2"]; len(os2) >= os2FsSelectionOffset+2 {
+		info.Weight = int(binary.BigEndian.Uint16(os2[os2WeightOffset:]))
+		info.Italic = binary.BigEndian.Uint16(os2[os2FsSelectionOffset:])&fsSelectionItalic != 0
+	} else {
+		style := strings.ToLower(info.Style)
+		info.Italic = strings.Contains(style, "italic") || strings.Contains(style, "oblique")
+	}
+	if info.coverage, err = parseCmap(tables["cmap"]); err != nil {
+		return FontInfo{}, err
+	}
+	return info, nil
+}
+
+// parseNames 解析name表，优先使用Windows平台的英文名称
+func parseNames(data []byte) map[int]string {
+	names := map[int]string{}
+	if len(data) < 6 {
+		return names
+	}
+	count := int(binary.BigEndian.Uint16(data[2:]))
+	storage := int(binary.BigEndian.Uint16(data[4:]))
+	priority := map[int]int{}
+	for i := 0; i < count && 6+12*(i+1) <= len(data); i++ {
+		record := data[6+12*i:]
+		platform := binary.BigEndian.Uint16(record)
+		language := binary.BigEndian.Uint16(record[4:])
+		nameID := int(binary.BigEndian.Uint16(record[6:]))
+		length := int(binary.BigEndian.Uint16(record[8:]))
+		start := storage + int(binary.BigEndian.Uint16(record[10:]))
+		if start+length > len(data) {
+			continue
+		}
+
+		var value string
+		var level int
+		switch platform {
+		case platformWindows, platformUnicode:
+			value = decodeUTF16(data[start : start+length])
+			level = 2
+			if platform == platformWindows && language == languageEnglishUS {
+				level = 3
+			}
+		case platformMacintosh:
+			value = string(data[start : start+length])
+			level = 1
+		default:
+			continue
+		}
+		if value != "" && level > priority[nameID] {
+			names[nameID], priority[nameID] = value, level
+		}
+	}
+	return names
+}
+
+// parseCmap 解析cmap表得到字体覆盖的字符区间，支持格式4和格式12
+func parseCmap(data []byte) ([]runeRange, error) {
+	if len(data) < 4 {
+		return nil, ErrInvalidFont
+	}
+	// 优先使用覆盖完整Unicode的子表
+	best, bestRank := -1, 0
+	numTables := int(binary.BigEndian.Uint16(data[2:]))
+	for i := 0; i < numTables && 4+8*(i+1) <= len(data); i++ {
+		record := data[4+8*i:]
+		platform := binary.BigEndian.Uint16(record)
+		encoding := binary.BigEndian.Uint16(record[2:])
+		offset := int(binary.BigEndian.Uint32(record[4:]))
+		if offset+2 > len(data) {
+			continue
+		}
+		format := binary.BigEndian.Uint16(data[offset:])
+		rank := 0
+		switch {
+		case format == 12 && (platform == platformWindows && encoding == 10 || platform == platformUnicode):
+			rank = 2
+		case format == 4 && (platform == platformWindows && (encoding == 1 || encoding == 0) || platform == platformUnicode):
+			rank = 1
+		}
+		if rank > bestRank {
+			best, bestRank = offset, rank
+		}
+	}
+
+	var ranges []runeRange
+	switch bestRank {
+	case 2:
+		ranges = parseCmapFormat12(data[best:])
+	case 1:
+		ranges = parseCmapFormat4(data[best:])
+	default:
+		return nil, ErrInvalidFont
+	}
+	return mergeRanges(ranges), nil
+}
+
+// parseCmapFormat4 解析格式4子表（BMP分段映射）
+func parseCmapFormat4(data []byte) []runeRange {
+	if len(data) < 14 {
+		return nil
+	}
+	segCount := int(binary.BigEndian.Uint16(data[6:])) / 2
+	endCodes := 14
+	startCodes := endCodes + 2*segCount + 2
+	idDeltas := startCodes + 2*segCount
+	idRangeOffsets := idDeltas + 2*segCount
+	if idRangeOffsets+2*segCount > len(data) {
+		return nil
+	}
+
+	var ranges []runeRange
+	for i := 0; i < segCount; i++ {
+		end := int(binary.BigEndian.Uint16(data[endCodes+2*i:]))
+		start := int(binary.BigEndian.Uint16(data[startCodes+2*i:]))
+		delta := int(binary.BigEndian.Uint16(data[idDeltas+2*i:]))
+		rangeOffset := int(binary.BigEndian.Uint16(data[idRangeOffsets+2*i:]))
+		for c := start; c <= end && c != 0xFFFF; c++ {
+			glyph := (c + delta) & 0xFFFF
+			if rangeOffset != 0 {
+				pos := idRangeOffsets + 2*i + rangeOffset + 2*(c-start)
+				if pos+2 > len(data) {
+					break
+				}
+				if glyph = int(binary.BigEndian.Uint16(data[pos:])); glyph != 0 {
+					glyph = (glyph + delta) & 0xFFFF
+				}
+			}
+			if glyph != 0 {
+				ranges = appendRune(ranges, rune(c))
+			}
+		}
+	}
+	return ranges
+}
+
+// parseCmapFormat12 解析格式12子表（完整Unicode分组映射）
+func parseCmapFormat12(data []byte) []runeRange {
+	if len(data) < 16 {
+		return nil
+	}
+	numGroups := int(binary.BigEndian.Uint32(data[12:]))
+	var ranges []runeRange
+	for i := 0; i < numGroups && 16+12*(i+1) <= len(data); i++ {
+		group := data[16+12*i:]
+		lo := rune(binary.BigEndian.Uint32(group))
+		hi := rune(binary.BigEndian.Uint32(group[4:]))
+		if binary.BigEndian.Uint32(group[8:]) == 0 {
+			lo++ // 映射到字形0的字符视为缺失
+		}
+		if lo <= hi {
+			ranges = append(ranges, runeRange{Lo: lo, Hi: hi})
+		}
+	}
+	return ranges
+}
+
+// appendRune 按升序追加字符，与上一个区间相邻时合并
+func appendRune(ranges []runeRange, r rune) []runeRange {
+	if n := len(ranges); n > 0 && ranges[n-1].Hi+1 == r {
+		ranges[n-1].Hi = r
+		return ranges
+	}
+	return append(ranges, runeRange{Lo: r, Hi: r})
+}
+
+// mergeRanges 排序并合并重叠或相邻的区间
+func mergeRanges(ranges []runeRange) []runeRange {
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].Lo < ranges[j].Lo })
+	var merged []runeRange
+	for _, rr := range ranges {
+		if n := len(merged); n > 0 && rr.Lo <= merged[n-1].Hi+1 {
+			merged[n-1].Hi = max(merged[n-1].Hi, rr.Hi)
+			continue
+		}
+		merged = append(merged, rr)
+	}
+	return merged
+}
+
+func decodeUTF16(data []byte) string {
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		units[i] = binary.BigEndian.Uint16(data[2*i:])
+	}
+	return string(utf16.Decode(units))
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// readAt 读取offset处的n个字节
+func readAt(r io.ReaderAt, offset int64, n int) ([]byte, error) {
+	if offset < 0 || n < 0 || n > maxReadSize {
+		return nil, ErrInvalidFont
+	}
+	buf := make([]byte, n)
+	if _, err := r.ReadAt(buf, offset); err != nil {
+		return nil, ErrInvalidFont
+	}
+	return buf, nil
+}
@@ -0,0 +1,160 @@
+package fontcache
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/tdewolff/canvas"
+	"github.com/tdewolff/font"
+)
+
+// Features OpenType特性设置，值为0表示关闭，1表示开启，大于1时选择替代字形，例如{"liga": 0, "smcp": 1, "salt": 2}
+type Features map[string]int
+
+// String 按特性名称排序后格式化为"liga=0,smcp=1"，为空时返回空字符串
+func (f Features) String() string {
+	tags := make([]string, 0, len(f))
+	for tag := range f {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	for i, tag := range tags {
+		tags[i] = tag + "=" + strconv.Itoa(f[tag])
+	}
+	return strings.Join(tags, ",")
+}
+
+// Run 使用同一字体渲染的连续文本
+type Run struct {
+	Font int    // 字体在列表中的序号
+	Text string // 文本
+}
+
+// SplitRuns 按字体将文本拆分为多段，每个字符使用fonts中第一个包含其字形的字体，都不包含时使用第一个字体
+// 空白、控制字符等不需要字形的字符沿用前一段的字体
+func SplitRuns(fonts []*canvas.Font, text string) []Run {
+	var runs []Run
+	start, current := 0, -1
+	for pos, r := range text {
+		i := current
+		if NeedsGlyph(r) {
+			i = 0
+			for j, font := range fonts {
+				if font.GlyphIndex(r) != 0 {
+					i = j
+					break
+				}
+			}
+		}
+		if current == -1 {
+			current = max(i, 0)
+		} else if i != current {
+			runs = append(runs, Run{Font: current, Text: text[start:pos]})
+			start, current = pos, i
+		}
+	}
+	if start < len(text) {
+		runs = append(runs, Run{Font: max(current, 0), Text: text[start:]})
+	}
+	return runs
+}
+
+// Cluster 字形簇，即排版后对应同一段文本的字形，例如连字"fi"的两个字符对应一个字形
+type Cluster struct {
+	Text    string       // 对应的文本
+	Start   int          // 对应文本在输入文本中的字节位置
+	X       float64      // 字形簇起点相对文本起点的位置
+	Path    *canvas.Path // 字形轮廓，以字形簇起点为原点，空格等没有轮廓时为空路径
+	Advance float64      // 前进宽度，已包含字距调整
+}
+
+// ShapeClusters 对文本整体排版一次（保留字距调整、连字和face.Font上设置的OpenType特性），
+// 再按字形簇拆分为单独的路径，用于逐字符设置颜色
+// 返回的字形簇按视觉顺序（从左到右）排列，face.Direction为从右到左时与文本顺序相反
+// face的伪粗体和伪斜体会应用到每个字形簇上
+func ShapeClusters(face *canvas.FontFace, text string) ([]Cluster, error) {
+	glyphs := face.Glyphs(text)
+
+	// 字形的Cluster为其对应文本的起始字节位置，相邻的起始位置之间为一个字形簇的文本
+	starts := make([]int, 0, len(glyphs))
+	for _, glyph := range glyphs {
+		starts = append(starts, int(glyph.Cluster))
+	}
+	sort.Ints(starts)
+	ends := map[int]int{}
+	for i, start := range starts {
+		if _, ok := ends[start]; !ok {
+			ends[start] = len(text)
+		}
+		if i > 0 && starts[i-1] != start {
+			ends[starts[i-1]] = start
+		}
+	}
+
+	var clusters []Cluster
+	index := map[int]int{}
+	f := face.MmPerEm
+	x, y := face.XOffset, face.YOffset
+	for _, glyph := range glyphs {
+		start := int(glyph.Cluster)
+		i, ok := index[start]
+		if !ok {
+			i = len(clusters)
+			index[start] = i
+			clusters = append(clusters, Cluster{Text: text[start:ends[start]], Start: start, X: f * float64(x), Path: &canvas.Path{}})
+		}
+		cluster := &clusters[i]
+		err := face.Font.GlyphPath(cluster.Path, glyph.ID, 0, f*float64(x+glyph.XOffset)-cluster.X, f*float64(y+glyph.YOffset), f, font.NoHinting)
+		if err != nil {
+			return nil, err
+		}
+		cluster.Advance += f * float64(glyph.XAdvance)
+		x += glyph.XAdvance
+		y += glyph.YAdvance
+	}
+
+	for i := range clusters {
+		cluster := &clusters[i]
+		if face.FauxBold != 0.0 && !cluster.Path.Empty() {
+			d := face.FauxBold * face.Size
+			if face.Font.IsTrueType {
+				// TrueType字形轮廓为顺时针方向
+				d = -d
+			}
+			cluster.Path = cluster.Path.Offset(d, 0.01)
+		}
+		if face.FauxItalic != 0.0 {
+			cluster.Path = cluster.Path.Transform(canvas.Identity.Shear(face.FauxItalic, 0.0))
+		}
+	}
+	return clusters, nil
+}
+
+// Spacing 返回字形簇后增加的间距：每个字形簇增加letter，包含空白字符时再增加word，间距可以为负
+func Spacing(text string, letter, word float64) float64 {
+	if strings.ContainsFunc(text, unicode.IsSpace) {
+		return letter + word
+	}
+	return letter
+}
+
+// CharOffset 单个字符的额外偏移和旋转
+type CharOffset struct {
+	X      float64 // 横向偏移
+	Y      float64 // 纵向偏移，向上为正
+	Rotate float64 // 旋转角度（度数），以字形中心为原点逆时针旋转
+}
+
+// Apply 对字形路径应用偏移和旋转，空路径原样返回
+func (o CharOffset) Apply(path *canvas.Path) *canvas.Path {
+	if path.Empty() || o == (CharOffset{}) {
+		return path
+	}
+	if o.Rotate != 0.0 {
+		bounds := path.Bounds()
+		path = path.Transform(canvas.Identity.RotateAbout(o.Rotate, (bounds.X0+bounds.X1)/2, (bounds.Y0+bounds.Y1)/2))
+	}
+	return path.Translate(o.X, o.Y)
+}
@@ -0,0 +1,104 @@
+package fontcache
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/tdewolff/canvas"
+)
+
+// 伪粗体和伪斜体的参数
+const (
+	fauxBoldPerWeight = 0.00008 // 每差1个字重单位增加的描边宽度（相对字号）
+	fauxBoldMinDiff   = 100     // 实际字重比要求低于该值时才使用伪粗体
+	fauxItalicShear   = 0.2     // 伪斜体的错切系数，约11度
+)
+
+// Variations 可变字体轴设置，例如{"wght": 700, "wdth": 75, "slnt": -10}
+type Variations map[string]float64
+
+// String 按轴名称排序后格式化为"slnt=-10,wdth=75,wght=700"，为空时返回空字符串
+func (v Variations) String() string {
+	tags := make([]string, 0, len(v))
+	for tag := range v {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	for i, tag := range tags {
+		tags[i] = tag + "=" + strconv.FormatFloat(v[tag], 'f', -1, 64)
+	}
+	return strings.Join(tags, ",")
+}
+
+// Style 将字重（100-900）和斜体转换为canvas.FontStyle，weight为0时按常规字重400处理
+func Style(weight int, italic bool) canvas.FontStyle {
+	var style canvas.FontStyle
+	switch {
+	case weight == 0:
+		style = canvas.FontRegular
+	case weight <= 150:
+		style = canvas.FontThin
+	case weight <= 250:
+		style = canvas.FontExtraLight
+	case weight <= 350:
+		style = canvas.FontLight
+	case weight <= 450:
+		style = canvas.FontRegular
+	case weight <= 550:
+		style = canvas.FontMedium
+	case weight <= 650:
+		style = canvas.FontSemiBold
+	case weight <= 750:
+		style = canvas.FontBold
+	case weight <= 850:
+		style = canvas.FontExtraBold
+	default:
+		style = canvas.FontBlack
+	}
+	if italic {
+		style |= canvas.FontItalic
+	}
+	return style
+}
+
+// styleWeight 返回canvas.FontStyle对应的字重
+func styleWeight(style canvas.FontStyle) int {
+	switch style &^ canvas.FontItalic {
+	case canvas.FontThin:
+		return 100
+	case canvas.FontExtraLight:
+		return 200
+	case canvas.FontLight:
+		return 300
+	case canvas.FontMedium:
+		return 500
+	case canvas.FontSemiBold:
+		return 600
+	case canvas.FontBold:
+		return 700
+	case canvas.FontExtraBold:
+		return 800
+	case canvas.FontBlack:
+		return 900
+	}
+	return 400
+}
+
+// Face 创建字体Face，字体实际的字重比weight低或要求italic而字体不是斜体时，使用伪粗体和伪斜体
+// weight为0时不要求字重
+func Face(font *canvas.Font, size float64, weight int, italic bool, args ...interface{}) *canvas.FontFace {
+	face := font.Face(size, args...)
+	actualWeight, actualItalic := 400, false
+	if font.SFNT != nil && font.OS2 != nil {
+		actualWeight = int(font.OS2.UsWeightClass)
+		actualItalic = font.OS2.FsSelection&fsSelectionItalic != 0
+	}
+	if weight > 0 && weight-actualWeight >= fauxBoldMinDiff {
+		face.FauxBold = float64(weight-actualWeight) * fauxBoldPerWeight
+	}
+	if italic && !actualItalic {
+		face.FauxItalic = fauxItalicShear
+	}
+	return face
+}
@@ -0,0 +1,157 @@
+package fontcache
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/tdewolff/canvas"
+)
+
+// ErrInvalidTextPath 文字路径既没有设置Path也没有设置Radius
+var ErrInvalidTextPath = errors.New("文字路径无效，需要设置Path或Radius")
+
+// PathAlign 文字沿路径的对齐方式
+type PathAlign int
+
+const (
+	PathAlignStart  PathAlign = iota // 从路径起点开始排列
+	PathAlignCenter                  // 居中于路径中点
+	PathAlignEnd                     // 结束于路径终点
+)
+
+// TextPath 文字排列的路径，设置Path时沿SVG路径排列，否则沿以原点为圆心的圆弧排列
+type TextPath struct {
+	Path             string    // SVG路径数据，坐标与SVG相同y轴向下，例如"M0 100 Q100 0 200 100"
+	Radius           float64   // 圆弧半径，未设置Path时使用
+	StartAngle       float64   // 圆弧上对齐点的角度（度数），0为正上方，顺时针为正
+	CounterClockwise bool      // 沿圆弧逆时针排列，字头朝向圆心，用于圆形印章底部从左到右阅读的文字
+	Inside           bool      // 文字位于圆弧内侧，默认位于外侧（基线在圆弧上）
+	Align            PathAlign // 对齐方式，圆弧以StartAngle为对齐点，路径以起点、中点或终点为对齐点
+	Offset           float64   // 沿路径方向的额外偏移
+}
+
+// textCurve 文字排列的曲线，at返回距离曲线起点s处的位置和切线角度（弧度）
+type textCurve interface {
+	length() float64
+	at(s float64) (canvas.Point, float64)
+}
+
+// AlongPath 将横排的字形簇沿路径排列，每个字形以其中心所在位置的切线方向旋转
+// clusters的X为相对文本起点的位置（已包含字符间距），返回的字形簇路径已移动到所在位置，X为0
+func AlongPath(clusters []Cluster, tp TextPath) ([]Cluster, error) {
+	var curve textCurve
+	switch {
+	case tp.Path != "":
+		p, err := canvas.ParseSVGPath(tp.Path)
+		if err != nil {
+			return nil, fmt.Errorf("解析文字路径失败: %w", err)
+		}
+		curve = newPolyline(p.Transform(canvas.Identity.Scale(1.0, -1.0)).Flatten(0.01).Coords())
+	case tp.Radius > 0.0:
+		curve = arcCurve{radius: tp.Radius, start: tp.StartAngle * math.Pi / 180.0, ccw: tp.CounterClockwise}
+	default:
+		return nil, ErrInvalidTextPath
+	}
+
+	var width, top float64
+	for _, cluster := range clusters {
+		width = math.Max(width, cluster.X+cluster.Advance)
+		if !cluster.Path.Empty() {
+			top = math.Max(top, cluster.Path.Bounds().Y1)
+		}
+	}
+
+	start := tp.Offset
+	switch tp.Align {
+	case PathAlignCenter:
+		start += (curve.length() - width) / 2.0
+	case PathAlignEnd:
+		start += curve.length() - width
+	}
+
+	// 文字位于圆弧内侧时，顺时针排列的字头朝外，需要将字形整体移到基线以下；逆时针排列时相反
+	var shift float64
+	if _, ok := curve.(arcCurve); ok && tp.Inside != tp.CounterClockwise {
+		shift = -top
+	}
+
+	placed := make([]Cluster, len(clusters))
+	for i, cluster := range clusters {
+		mid := cluster.Advance / 2.0
+		pos, angle := curve.at(start + cluster.X + mid)
+		m := canvas.Identity.Translate(pos.X, pos.Y).Rotate(angle*180.0/math.Pi).Translate(-mid, shift)
+		cluster.Path = cluster.Path.Transform(m)
+		cluster.X = 0
+		placed[i] = cluster
+	}
+	return placed, nil
+}
+
+// arcCurve 以原点为圆心的圆弧，对齐点（s=0）位于start角度，角度从正上方起顺时针计算
+type arcCurve struct {
+	radius float64
+	start  float64
+	ccw    bool
+}
+
+// length 圆弧的对齐点固定在StartAngle，因此长度为0，居中和终点对齐分别将文字中点和终点放在对齐点上
+func (a arcCurve) length() float64 {
+	return 0.0
+}
+
+func (a arcCurve) at(s float64) (canvas.Point, float64) {
+	if a.ccw {
+		phi := a.start - s/a.radius
+		sin, cos := math.Sincos(phi)
+		return canvas.Point{X: a.radius * sin, Y: a.radius * cos}, math.Atan2(sin, -cos)
+	}
+	phi := a.start + s/a.radius
+	sin, cos := math.Sincos(phi)
+	return canvas.Point{X: a.radius * sin, Y: a.radius * cos}, math.Atan2(-sin, cos)
+}
+
+// polyline 拉平后的路径，超出两端时沿首尾线段的方向延长
+type polyline struct {
+	points []canvas.Point
+	dists  []float64 // 每个点到起点的累计长度
+}
+
+func newPolyline(points []canvas.Point) *polyline {
+	p := &polyline{}
+	for _, point := range points {
+		if n := len(p.points); n > 0 && point == p.points[n-1] {
+			continue // 跳过重复的点，避免零长度线段
+		}
+		d := 0.0
+		if n := len(p.points); n > 0 {
+			d = p.dists[n-1] + math.Hypot(point.X-p.points[n-1].X, point.Y-p.points[n-1].Y)
+		}
+		p.points = append(p.points, point)
+		p.dists = append(p.dists, d)
+	}
+	return p
+}
+
+func (p *polyline) length() float64 {
+	if len(p.dists) == 0 {
+		return 0.0
+	}
+	return p.dists[len(p.dists)-1]
+}
+
+func (p *polyline) at(s float64) (canvas.Point, float64) {
+	if len(p.points) < 2 {
+		if len(p.points) == 1 {
+			return canvas.Point{X: p.points[0].X + s, Y: p.points[0].Y}, 0.0
+		}
+		return canvas.Point{X: s}, 0.0
+	}
+	i := 1
+	for i < len(p.points)-1 && p.dists[i] < s {
+		i++
+	}
+	a, b := p.points[i-1], p.points[i]
+	t := (s - p.dists[i-1]) / (p.dists[i] - p.dists[i-1])
+	return canvas.Point{X: a.X + t*(b.X-a.X), Y: a.Y + t*(b.Y-a.Y)}, math.Atan2(b.Y-a.Y, b.X-a.X)
+}
@@ -0,0 +1,227 @@
+package fontcache
+
+import (
+	"unicode"
+
+	"github.com/tdewolff/canvas"
+)
+
+// DefaultTateChuYoko 默认的纵中横最大数字个数
+const DefaultTateChuYoko = 2
+
+// VerticalOptions 竖排选项
+type VerticalOptions struct {
+	Upright     bool // 拉丁字母等横排文字逐字直立排列，默认整段顺时针旋转90度
+	TateChuYoko int  // 连续数字不超过该个数时横排在同一格中（纵中横），0使用DefaultTateChuYoko，小于0不启用
+}
+
+// verticalForms 竖排标点，字体包含竖排形式（U+FE10-FE19、U+FE30-FE4F）时替换
+var verticalForms = map[rune]rune{
+	'，': '︐', '、': '︑', '。': '︒', '：': '︓', '；': '︔', '！': '︕', '？': '︖',
+	'〖': '︗', '〗': '︘', '…': '︙', '‥': '︰', '—': '︱', '–': '︲', '＿': '︳',
+	'（': '︵', '）': '︶', '｛': '︷', '｝': '︸', '〔': '︹', '〕': '︺',
+	'【': '︻', '】': '︼', '《': '︽', '》': '︾', '〈': '︿', '〉': '﹀',
+	'「': '﹁', '」': '﹂', '『': '﹃', '』': '﹄', '［': '﹇', '］': '﹈',
+}
+
+// verticalOrientation 竖排时字符的排列方式
+type verticalOrientation int
+
+const (
+	orientUpright  verticalOrientation = iota // 直立
+	orientSideways                            // 顺时针旋转90度
+	orientTCY                                 // 纵中横
+)
+
+// verticalSegment 竖排方式相同的一段连续文本
+type verticalSegment struct {
+	orient verticalOrientation
+	text   string
+	start  int // 在原文本中的字节位置
+}
+
+// VerticalClusters 竖排文本，字符从上到下排列
+// 汉字、假名等直立排列，使用字体的竖排度量（vhea/vmtx），没有时以字面框居中；
+// 拉丁字母等横排文字整段顺时针旋转90度或按opts.Upright逐字直立；短数字按纵中横横排在一格中；
+// 标点在字体包含竖排形式时替换为竖排形式，括号、破折号等没有竖排形式时旋转
+// 返回的字形簇以列中线为x=0，X为字形簇起点到列顶端的距离，路径以(0, -X)为原点，y轴向上，Advance为竖向前进高度
+// faces为主字体和回退字体，按顺序选择包含字形的字体
+func VerticalClusters(faces []*canvas.FontFace, text string, opts VerticalOptions) ([]Cluster, error) {
+	fonts := make([]*canvas.Font, len(faces))
+	for i, face := range faces {
+		fonts[i] = face.Font
+	}
+	tcy := opts.TateChuYoko
+	if tcy == 0 {
+		tcy = DefaultTateChuYoko
+	}
+
+	var clusters []Cluster
+	var y float64
+	start := 0
+	for _, run := range SplitRuns(fonts, text) {
+		face := faces[run.Font]
+		for _, seg := range verticalSegments(face.Font, run.Text, tcy, opts.Upright) {
+			seg.start += start
+			segClusters, err := layoutVertical(face, seg)
+			if err != nil {
+				return nil, err
+			}
+			offset := y
+			for _, cluster := range segClusters {
+				cluster.X += offset
+				clusters = append(clusters, cluster)
+				y += cluster.Advance
+			}
+		}
+		start += len(run.Text)
+	}
+	return clusters, nil
+}
+
+// verticalSegments 按竖排方式拆分同一字体的文本，start为相对text的字节位置
+func verticalSegments(font *canvas.Font, text string, tcy int, upright bool) []verticalSegment {
+	var segs []verticalSegment
+	runes := []rune(text)
+	pos := 0
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		orient := orientUpright
+		n := 1
+		switch {
+		case r >= '0' && r <= '9':
+			for i+n < len(runes) && runes[i+n] >= '0' && runes[i+n] <= '9' {
+				n++
+			}
+			if n <= tcy {
+				orient = orientTCY
+			} else if !upright {
+				orient = orientSideways
+			}
+		case verticalForms[r] != 0 && font.GlyphIndex(verticalForms[r]) != 0:
+			orient = orientUpright
+		case isVerticalRotated(r):
+			orient = orientSideways
+		case isVerticalUpright(r):
+			orient = orientUpright
+		case !upright:
+			orient = orientSideways
+		}
+
+		size := len(string(runes[i : i+n]))
+		last := len(segs) - 1
+		if orient == orientSideways && last >= 0 && segs[last].orient == orientSideways {
+			segs[last].text += string(runes[i : i+n]) // 连续的旋转文字整体排版
+		} else {
+			segs = append(segs, verticalSegment{orient: orient, text: string(runes[i : i+n]), start: pos})
+		}
+		pos += size
+		i += n
+	}
+	return segs
+}
+
+// layoutVertical 排版一段竖排文本，返回的X相对该段起点
+func layoutVertical(face *canvas.FontFace, seg verticalSegment) ([]Cluster, error) {
+	sfnt := face.Font.SFNT
+	f := face.MmPerEm
+	em := f * float64(sfnt.Head.UnitsPerEm)
+	// 横排字面框的中线，用于旋转文字和纵中横在列中居中
+	mid := f * float64(int(sfnt.Hhea.Ascender)+int(sfnt.Hhea.Descender)) / 2
+
+	switch seg.orient {
+	case orientSideways:
+		clusters, err := ShapeClusters(face, seg.text)
+		if err != nil {
+			return nil, err
+		}
+		// 顺时针旋转90度：(x, y) -> (y-mid, -x)
+		rotate := canvas.Matrix{{0, 1, -mid}, {-1, 0, 0}}
+		for i := range clusters {
+			clusters[i].Path = clusters[i].Path.Transform(rotate)
+			clusters[i].Start += seg.start
+		}
+		return clusters, nil
+
+	case orientTCY:
+		clusters, err := ShapeClusters(face, seg.text)
+		if err != nil {
+			return nil, err
+		}
+		path := &canvas.Path{}
+		var width float64
+		for _, cluster := range clusters {
+			path = path.Append(cluster.Path.Translate(cluster.X, 0))
+			width += cluster.Advance
+		}
+		scale := 1.0
+		if width > em {
+			scale = em / width // 超出一格时横向压缩
+		}
+		path = path.Transform(canvas.Identity.Translate(0, -em/2-mid).Scale(scale, 1).Translate(-width/2, 0))
+		return []Cluster{{Text: seg.text, Start: seg.start, Path: path, Advance: em}}, nil
+	}
+
+	var clusters []Cluster
+	var y float64
+	for i, r := range seg.text {
+		glyphRune := r
+		if form := verticalForms[r]; form != 0 && face.Font.GlyphIndex(form) != 0 {
+			glyphRune = form
+		}
+		shaped, err := ShapeClusters(face, string(glyphRune))
+		if err != nil {
+			return nil, err
+		}
+		path := &canvas.Path{}
+		var width float64
+		for _, cluster := range shaped {
+			path = path.Append(cluster.Path.Translate(cluster.X, 0))
+			width += cluster.Advance
+		}
+
+		// 有竖排度量时按上边距定位，否则在一格中居中
+		advance, top := em, em/2+mid
+		if id := face.Font.GlyphIndex(glyphRune); sfnt.Vmtx != nil && id < sfnt.NumGlyphs() {
+			if _, _, _, yMax, err := sfnt.GlyphBounds(id); err == nil {
+				advance = f * float64(sfnt.Vmtx.Advance(id))
+				top = f * float64(int(yMax)+int(sfnt.Vmtx.TopSideBearing(id)))
+			}
+		}
+		path = path.Translate(-width/2, -top)
+		clusters = append(clusters, Cluster{Text: string(r), Start: seg.start + i, X: y, Path: path, Advance: advance})
+		y += advance
+	}
+	return clusters, nil
+}
+
+// isVerticalRotated 判断字符在没有竖排形式时是否需要旋转，例如括号、破折号、省略号和波浪线
+func isVerticalRotated(r rune) bool {
+	switch r {
+	case '，', '、', '。', '：', '；', '！', '？':
+		return false // 句读符号保持直立
+	case '〜', '～', '-', '(', ')', '[', ']', '{', '}', '<', '>':
+		return true
+	}
+	return verticalForms[r] != 0
+}
+
+// isVerticalUpright 判断字符在竖排时是否直立，参考UAX #50的Vertical_Orientation
+func isVerticalUpright(r rune) bool {
+	if unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul, unicode.Bopomofo, unicode.Yi) {
+		return true
+	}
+	switch {
+	case r >= 0x3000 && r <= 0x303F: // CJK符号和标点
+		return true
+	case r >= 0xFF01 && r <= 0xFF60: // 全角字符
+		return true
+	case r >= 0xFE10 && r <= 0xFE1F, r >= 0xFE30 && r <= 0xFE4F: // 竖排形式
+		return true
+	case r >= 0x3200 && r <= 0x33FF, r >= 0x2460 && r <= 0x24FF: // 带圈和方框字符
+		return true
+	case r >= 0x1F300 && r <= 0x1FAFF, r >= 0x2600 && r <= 0x27BF: // emoji和符号
+		return true
+	}
+	return false
+}
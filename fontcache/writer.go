@@ -0,0 +1,234 @@
+package fontcache
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/tdewolff/canvas"
+	"github.com/tdewolff/canvas/renderers"
+)
+
+// markChannels 标记颜色各通道的取值，均为51的倍数，在PDF中可以精确地写为一位小数
+var markChannels = []uint8{0x33, 0x66, 0x99, 0xCC}
+
+var svgStartTag = regexp.MustCompile(`<svg[^>]*>`)
+
+// SVG 返回写出SVG的canvas.Writer，opts传给renderers.SVG
+// DrawPath绘制的图案输出为引用原图的<pattern>，图形保持矢量；无法输出原生图案时与renderers.SVG相同，图案为栅格化的位图
+func SVG(opts ...interface{}) canvas.Writer {
+	return func(w io.Writer, c *canvas.Canvas) error {
+		if marked, marks := markPatterns(c); len(marks) > 0 {
+			var buf bytes.Buffer
+			if err := marked.Write(&buf, renderers.SVG(opts...)); err != nil {
+				return err
+			}
+			_, h := c.Size()
+			if svg, ok := svgPatterns(buf.String(), marks, h); ok {
+				_, err := io.WriteString(w, svg)
+				return err
+			}
+		}
+		return c.Write(w, renderers.SVG(opts...))
+	}
+}
+
+// PDF 返回写出PDF的canvas.Writer，opts传给renderers.PDF
+// DrawPath绘制的图案输出为引用原图的平铺图案（PatternType 1），图形保持矢量；无法输出原生图案时与renderers.PDF相同，图案为栅格化的位图
+func PDF(opts ...interface{}) canvas.Writer {
+	return func(w io.Writer, c *canvas.Canvas) error {
+		if marked, marks := markPatterns(c); len(marks) > 0 {
+			var buf bytes.Buffer
+			if err := marked.Write(&buf, renderers.PDF(opts...)); err != nil {
+				return err
+			}
+			width, height := c.Size()
+			if data, err := pdfPatterns(buf.Bytes(), marks, width, height); err == nil {
+				_, err = w.Write(data)
+				return err
+			}
+		}
+		return c.Write(w, renderers.PDF(opts...))
+	}
+}
+
+// patternMark 以标记颜色填充的图案路径，写出后将标记颜色替换为原生图案
+type patternMark struct {
+	color  color.RGBA
+	image  image.Image
+	matrix canvas.Matrix // 图案空间（图片的像素坐标，y轴向下）到画布坐标的变换
+	paths  int           // 使用该标记颜色的路径数
+}
+
+// markPatterns 返回将图案图片替换为标记颜色填充路径的画布副本，标记颜色不与画布中已使用的颜色重复
+// 没有图案时返回的标记为空
+func markPatterns(c *canvas.Canvas) (*canvas.Canvas, []patternMark) {
+	used := &colorCollector{colors: map[color.RGBA]bool{}}
+	c.RenderTo(used)
+	if !used.patterns {
+		return c, nil
+	}
+	marker := &patternMarker{Canvas: canvas.New(c.Size()), used: used.colors}
+	c.RenderTo(marker)
+	return marker.Canvas, marker.marks
+}
+
+// colorCollector 收集画布中填充、描边和渐变使用的颜色，并记录是否有图案图片
+type colorCollector struct {
+	colors   map[color.RGBA]bool
+	patterns bool
+}
+
+func (r *colorCollector) Size() (float64, float64) { return 0, 0 }
+
+func (r *colorCollector) RenderPath(path *canvas.Path, style canvas.Style, m canvas.Matrix) {
+	for _, paint := range []canvas.Paint{style.Fill, style.Stroke} {
+		r.colors[paint.Color] = true
+		switch g := paint.Gradient.(type) {
+		case *canvas.LinearGradient:
+			r.addStops(g.Stops)
+		case *canvas.RadialGradient:
+			r.addStops(g.Stops)
+		}
+	}
+}
+
+func (r *colorCollector) addStops(stops canvas.Stops) {
+	for _, stop := range stops {
+		r.colors[stop.Color] = true
+	}
+}
+
+func (r *colorCollector) RenderText(text *canvas.Text, m canvas.Matrix) {}
+
+func (r *colorCollector) RenderImage(img image.Image, m canvas.Matrix) {
+	if _, ok := img.(*patternImage); ok {
+		r.patterns = true
+	}
+}
+
+// patternMarker 将内容复制到画布，图案图片替换为以标记颜色填充的路径
+// 相同图片且位置相同的图案（例如逐字符绘制的同一段文本）共用一个标记颜色，标记颜色用完后其余图案保留为位图
+type patternMarker struct {
+	*canvas.Canvas
+	used  map[color.RGBA]bool
+	marks []patternMark
+	next  int // 下一个候选标记颜色的序号
+}
+
+func (r *patternMarker) RenderImage(img image.Image, m canvas.Matrix) {
+	p, ok := img.(*patternImage)
+	if !ok {
+		r.Canvas.RenderImage(img, m)
+		return
+	}
+	view := m.Mul(p.view.Inv())
+	mark := r.mark(p.image, view.Mul(p.tile))
+	if mark == nil {
+		r.Canvas.RenderImage(img, m)
+		return
+	}
+	mark.paths++
+	r.Canvas.RenderPath(p.path, canvas.Style{Fill: canvas.Paint{Color: mark.color}}, view)
+}
+
+// mark 返回图片和位置相同的标记，没有时分配新的标记颜色，标记颜色用完时返回nil
+func (r *patternMarker) mark(img image.Image, matrix canvas.Matrix) *patternMark {
+	for i := range r.marks {
+		if r.marks[i].image == img && matrixEqual(r.marks[i].matrix, matrix) {
+			return &r.marks[i]
+		}
+	}
+	n := len(markChannels)
+	for ; r.next < n*n*n; r.next++ {
+		c := color.RGBA{markChannels[r.next/(n*n)], markChannels[r.next/n%n], markChannels[r.next%n], 0xFF}
+		// 灰色可能被写为单通道的灰度颜色，不使用
+		if r.used[c] || c.R == c.G && c.G == c.B {
+			continue
+		}
+		r.next++
+		r.marks = append(r.marks, patternMark{color: c, image: img, matrix: matrix})
+		return &r.marks[len(r.marks)-1]
+	}
+	return nil
+}
+
+// matrixEqual 判断两个变换是否相同，允许浮点误差
+func matrixEqual(a, b canvas.Matrix) bool {
+	for i := range a {
+		for j := range a[i] {
+			if math.Abs(a[i][j]-b[i][j]) > 1e-9*math.Max(1.0, math.Abs(a[i][j])) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// svgPatterns 将SVG中的标记颜色替换为对<pattern>的引用，并在开始标签之后插入图案定义
+// height为画布高度，用于将y轴向上的画布坐标转换为SVG坐标；标记颜色出现的次数与路径数不一致时返回false
+func svgPatterns(svg string, marks []patternMark, height float64) (string, bool) {
+	start := svgStartTag.FindStringIndex(svg)
+	if start == nil {
+		return svg, false
+	}
+	flip := canvas.Identity.Translate(0.0, height).Scale(1.0, -1.0)
+
+	var defs strings.Builder
+	defs.WriteString("<defs>")
+	images := map[image.Image]string{}
+	for i, mark := range marks {
+		re := regexp.MustCompile(`(?i)` + svgColorPattern(mark.color) + `\b`)
+		if len(re.FindAllStringIndex(svg, -1)) != mark.paths {
+			return svg, false
+		}
+		id := fmt.Sprintf("fontcache-pattern-%d", i)
+		svg = re.ReplaceAllLiteralString(svg, "url(#"+id+")")
+
+		imageID, ok := images[mark.image]
+		if !ok {
+			var buf bytes.Buffer
+			if err := png.Encode(&buf, mark.image); err != nil {
+				return svg, false
+			}
+			imageID = fmt.Sprintf("fontcache-pattern-image-%d", len(images))
+			images[mark.image] = imageID
+			b := mark.image.Bounds()
+			fmt.Fprintf(&defs, `<image id="%s" width="%d" height="%d" preserveAspectRatio="none" xlink:href="data:image/png;base64,%s"/>`,
+				imageID, b.Dx(), b.Dy(), base64.StdEncoding.EncodeToString(buf.Bytes()))
+		}
+		b := mark.image.Bounds()
+		m := flip.Mul(mark.matrix)
+		fmt.Fprintf(&defs, `<pattern id="%s" patternUnits="userSpaceOnUse" width="%d" height="%d" patternTransform="matrix(%s %s %s %s %s %s)"><use xlink:href="#%s"/></pattern>`,
+			id, b.Dx(), b.Dy(), num(m[0][0]), num(m[1][0]), num(m[0][1]), num(m[1][1]), num(m[0][2]), num(m[1][2]), imageID)
+	}
+	defs.WriteString("</defs>")
+	return svg[:start[1]] + defs.String() + svg[start[1]:], true
+}
+
+// svgColorPattern 返回匹配颜色的十六进制写法（包括三位的简写）的正则表达式
+func svgColorPattern(c color.RGBA) string {
+	s := fmt.Sprintf("#(?:%02x%02x%02x", c.R, c.G, c.B)
+	if c.R%0x11 == 0 && c.G%0x11 == 0 && c.B%0x11 == 0 {
+		s += fmt.Sprintf("|%x%x%x", c.R/0x11, c.G/0x11, c.B/0x11)
+	}
+	return s + ")"
+}
+
+// num 格式化数字，最多保留6位小数，不使用科学计数法
+func num(v float64) string {
+	s := strconv.FormatFloat(v, 'f', 6, 64)
+	s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	if s == "-0" {
+		s = "0"
+	}
+	return s
+}
@@ -2,7 +2,12 @@ module github.com/ibryang/go-utils
 
 go 1.22.0
 
-require github.com/tdewolff/canvas v0.0.0-20250203201237-59be1254c451
+require (
+	github.com/tdewolff/canvas v0.0.0-20250203201237-59be1254c451
+	github.com/tdewolff/font v0.0.0-20250120192450-68a3ecdf9008
+	golang.org/x/image v0.23.0
+	golang.org/x/text v0.21.0
+)
 
 require (
 	github.com/BurntSushi/freetype-go v0.0.0-20160129220410-b763ddbfe298 // indirect
@@ -21,13 +26,10 @@ require (
 	github.com/kolesa-team/go-webp v1.0.4 // indirect
 	github.com/srwiley/rasterx v0.0.0-20220730225603-2ab79fcdd4ef // indirect
 	github.com/srwiley/scanx v0.0.0-20190309010443-e94503791388 // indirect
-	github.com/tdewolff/font v0.0.0-20250120192450-68a3ecdf9008 // indirect
 	github.com/tdewolff/minify/v2 v2.21.1 // indirect
 	github.com/tdewolff/parse/v2 v2.7.19 // indirect
 	github.com/wcharczuk/go-chart/v2 v2.1.2 // indirect
-	golang.org/x/image v0.23.0 // indirect
 	golang.org/x/net v0.33.0 // indirect
-	golang.org/x/text v0.21.0 // indirect
 	gonum.org/v1/plot v0.15.0 // indirect
 	star-tex.org/x/tex v0.5.0 // indirect
 )
@@ -4,11 +4,15 @@ import (
 	"fmt"
 	"math"
 
+	"github.com/ibryang/go-utils/fontcache"
 	"github.com/tdewolff/canvas"
 )
 
 // validateOptions 验证选项并设置默认值
 func validateOptions(options *Options) error {
+	if len(options.Spans) > 0 {
+		options.Text = spansText(options.Spans)
+	}
 	if options.Text == "" {
 		return fmt.Errorf("文本内容不能为空")
 	}
@@ -41,6 +45,11 @@ func validateOptions(options *Options) error {
 		options.BackgroundStrokeWidth = 1.0
 	}
 
+	// 检查渐变和图案
+	if err := validatePaints(options); err != nil {
+		return err
+	}
+
 	// 处理内边距
 	options.Padding = processPadding(options.Padding)
 
@@ -50,94 +59,41 @@ func validateOptions(options *Options) error {
 // generateCanvasInternal 生成画布的内部实现
 func generateCanvasInternal(options Options) (*canvas.Canvas, error) {
 	// 加载字体
-	font, err := loadFontFamily(options.FontPath)
+	font, err := loadFont(fontcache.Source{Path: options.FontPath, Data: options.FontData, FS: options.FontFS}, options)
 	if err != nil {
 		return nil, fmt.Errorf("加载字体失败: %v", err)
 	}
 
-	face := font.Face(options.FontSize, nil)
-
-	var totalWidth float64
-	var maxHeight float64
-	var minY float64
-	var maxY float64
-	var paths []*canvas.Path
-	var xOffsets []float64
-	var bounds []canvas.Rect
-	var colorIndices []int
+	chain := newFontChain(font, options.FontSize, options)
+	if err := chain.checkGlyphs(options); err != nil {
+		return nil, err
+	}
 
-	if options.RenderMode == RenderModeString {
-		// 整体字符串路径模式
-		path, _, err := face.ToPath(options.Text)
+	// 自动适配字号：查找能放入锁定尺寸的最大字号
+	if options.AutoFit && (options.LockWidth > 0 || options.LockHeight > 0) {
+		size, err := fitFontSize(font, options)
 		if err != nil {
-			return nil, fmt.Errorf("转换文本到路径失败: %v", err)
+			return nil, err
 		}
-
-		if path == nil {
-			return nil, fmt.Errorf("生成路径失败")
-		}
-
-		path = path.Transform(canvas.Matrix{
-			{1, 0, -path.Bounds().X0},
-			{0, 1, 0},
-		})
-		pathBounds := path.Bounds()
-		totalWidth = pathBounds.W()
-		minY = pathBounds.Y0
-		maxY = pathBounds.Y1
-
-		paths = []*canvas.Path{path}
-		bounds = []canvas.Rect{pathBounds}
-		xOffsets = []float64{0}
-		colorIndices = []int{0}
-	} else {
-		// 单字符路径模式
-		runes := []rune(options.Text)
-		colorCount := 0
-		for i, char := range runes {
-			path, advance, err := face.ToPath(string(char))
-			if err != nil {
-				return nil, fmt.Errorf("转换文本到路径失败: %v", err)
-			}
-
-			if char == ' ' {
-				colorIndices = append(colorIndices, -1)
-				totalWidth += advance
-				continue
-			}
-
-			if path == nil {
-				continue
-			}
-
-			pathBounds := path.Bounds()
-			bounds = append(bounds, pathBounds)
-			paths = append(paths, path)
-			xOffsets = append(xOffsets, totalWidth)
-			colorIndices = append(colorIndices, colorCount%len(options.Colors))
-			colorCount++
-
-			if len(paths) == 1 {
-				minY = pathBounds.Y0
-				maxY = pathBounds.Y1
-			} else {
-				if pathBounds.Y0 < minY {
-					minY = pathBounds.Y0
-				}
-				if pathBounds.Y1 > maxY {
-					maxY = pathBounds.Y1
-				}
-			}
-
-			if i < len(runes)-1 {
-				totalWidth += advance
-			} else {
-				totalWidth += pathBounds.W()
-			}
+		options.Spans = scaleSpans(options.Spans, options.FontSize, size)
+		options.FontSize = size
+		chain = newFontChain(font, size, options)
+		if options.OnFontSize != nil {
+			options.OnFontSize(size)
 		}
 	}
 
-	maxHeight = maxY - minY
+	content, err := layoutContent(chain, options)
+	if err != nil {
+		return nil, err
+	}
+	paths, bounds, xOffsets, colorIndices := content.paths, content.bounds, content.xOffsets, content.colorIndices
+	if len(content.styles) > 0 {
+		// 富文本的各段分别绘制
+		options.RenderMode = RenderModeChar
+	}
+	totalWidth, minY := content.width, content.minY
+	maxHeight := content.maxY - content.minY
 
 	// 计算内边距的影响
 	contentWidth := totalWidth
@@ -225,7 +181,7 @@ func generateCanvasInternal(options Options) (*canvas.Canvas, error) {
 	}
 
 	// 绘制文本内容
-	drawTextContent(c, width, height, paths, colorIndices, bounds, xOffsets, minY, scaleX, scaleY, options)
+	drawTextContent(c, width, height, paths, colorIndices, content.styles, bounds, xOffsets, minY, scaleX, scaleY, options)
 
 	// 绘制额外的文本
 	if len(options.ExtraTexts) > 0 {
@@ -269,14 +225,187 @@ func generateCanvasInternal(options Options) (*canvas.Canvas, error) {
 	return c, nil
 }
 
+// textContent 排版后的文本内容，整体字符串模式只有一条路径
+type textContent struct {
+	paths        []*canvas.Path
+	bounds       []canvas.Rect
+	xOffsets     []float64
+	colorIndices []int
+	styles       []pathStyle // 富文本各路径的填充和描边，为空时按colorIndices使用Colors
+	width        float64     // 内容宽度，不含描边
+	minY, maxY   float64
+}
+
+// layoutContent 按options排版文本，返回各字符或整体的路径、位置和内容尺寸
+func layoutContent(chain *fontChain, options Options) (*textContent, error) {
+	if len(options.Spans) > 0 {
+		return layoutSpans(options)
+	}
+
+	var totalWidth float64
+	var minY float64
+	var maxY float64
+	var paths []*canvas.Path
+	var xOffsets []float64
+	var bounds []canvas.Rect
+	var colorIndices []int
+
+	if options.RenderMode == RenderModeString {
+		// 整体字符串路径模式，主字体缺少字形的部分使用回退字体
+		path := &canvas.Path{}
+		if clusterLayout(options) {
+			// 竖排、沿路径排列或设置了间距、偏移时按字形簇排版后合并
+			clusters, err := chain.layout(options.Text, options)
+			if err != nil {
+				return nil, fmt.Errorf("转换文本到路径失败: %v", err)
+			}
+			for _, cluster := range clusters {
+				path = path.Append(cluster.Path.Translate(cluster.X, 0))
+			}
+		} else {
+			var x float64
+			for _, run := range chain.split(options.Text) {
+				runPath, advance, err := chain.faces[run.Font].ToPath(run.Text)
+				if err != nil {
+					return nil, fmt.Errorf("转换文本到路径失败: %v", err)
+				}
+
+				if runPath == nil {
+					return nil, fmt.Errorf("生成路径失败")
+				}
+				path = path.Append(runPath.Translate(x, 0))
+				x += advance
+			}
+		}
+
+		path = path.Transform(canvas.Matrix{
+			{1, 0, -path.Bounds().X0},
+			{0, 1, 0},
+		})
+		pathBounds := path.Bounds()
+		totalWidth = pathBounds.W()
+		minY = pathBounds.Y0
+		maxY = pathBounds.Y1
+
+		paths = []*canvas.Path{path}
+		bounds = []canvas.Rect{pathBounds}
+		xOffsets = []float64{0}
+		colorIndices = []int{0}
+	} else {
+		// 单字符路径模式：整段文本排版一次后按字形簇拆分，保留字距调整和连字
+		clusters, err := chain.layout(options.Text, options)
+		if err != nil {
+			return nil, fmt.Errorf("转换文本到路径失败: %v", err)
+		}
+
+		// 以第一个字形的左边缘为起点，与整体字符串模式一致
+		startX := math.Inf(1)
+		for _, cluster := range clusters {
+			if !cluster.Path.Empty() {
+				startX = math.Min(startX, cluster.X+cluster.Path.Bounds().X0)
+			}
+		}
+
+		colorCount := 0
+		for _, cluster := range clusters {
+			if cluster.Path.Empty() {
+				continue // 跳过空格等没有轮廓的字符
+			}
+
+			pathBounds := cluster.Path.Bounds()
+			bounds = append(bounds, pathBounds)
+			paths = append(paths, cluster.Path)
+			xOffsets = append(xOffsets, cluster.X+pathBounds.X0-startX)
+			colorIndices = append(colorIndices, colorCount%len(options.Colors))
+			colorCount++
+
+			if len(paths) == 1 {
+				minY = pathBounds.Y0
+				maxY = pathBounds.Y1
+			} else {
+				if pathBounds.Y0 < minY {
+					minY = pathBounds.Y0
+				}
+				if pathBounds.Y1 > maxY {
+					maxY = pathBounds.Y1
+				}
+			}
+			totalWidth = math.Max(totalWidth, cluster.X+pathBounds.X1-startX)
+		}
+	}
+
+	return &textContent{
+		paths:        paths,
+		bounds:       bounds,
+		xOffsets:     xOffsets,
+		colorIndices: colorIndices,
+		width:        totalWidth,
+		minY:         minY,
+		maxY:         maxY,
+	}, nil
+}
+
+// fitFontSize 二分查找能放入LockWidth和LockHeight（减去内边距）的最大字号
+// 查找范围为MinFontSize到MaxFontSize，MaxFontSize为0时不超过FontSize，两者都为0时上限为1000；最小字号也放不下时返回最小字号
+func fitFontSize(font *canvas.Font, options Options) (float64, error) {
+	availWidth, availHeight := math.Inf(1), math.Inf(1)
+	if options.LockWidth > 0 {
+		availWidth = options.LockWidth - options.Padding[1] - options.Padding[3]
+	}
+	if options.LockHeight > 0 {
+		availHeight = options.LockHeight - options.Padding[0] - options.Padding[2]
+	}
+	if options.EnableStroke {
+		availWidth -= options.StrokeWidth * 2
+		availHeight -= options.StrokeWidth * 2
+	}
+
+	fits := func(size float64) (bool, error) {
+		sized := options
+		sized.FontSize = size
+		sized.Spans = scaleSpans(options.Spans, options.FontSize, size)
+		content, err := layoutContent(newFontChain(font, size, sized), sized)
+		if err != nil {
+			return false, err
+		}
+		return content.width <= availWidth && content.maxY-content.minY <= availHeight, nil
+	}
+
+	hi := options.MaxFontSize
+	if hi <= 0 {
+		hi = options.FontSize
+	}
+	if hi <= 0 {
+		hi = 1000
+	}
+	lo := math.Min(math.Max(options.MinFontSize, 0.1), hi)
+
+	if ok, err := fits(hi); err != nil || ok {
+		return hi, err
+	}
+	if ok, err := fits(lo); err != nil || !ok {
+		return lo, err
+	}
+	for hi-lo > 0.01 {
+		mid := (lo + hi) / 2
+		ok, err := fits(mid)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return lo, nil
+}
+
 // drawBackground 绘制背景
 func drawBackground(c *canvas.Canvas, width, height float64, options Options) {
 	// 使用单独的Context绘制背景
 	bgCtx := canvas.NewContext(c)
 
-	// 设置填充颜色
-	bgCtx.SetFillColor(canvas.Hex(options.BackgroundColor))
-
 	// 绘制矩形路径
 	var bgPath *canvas.Path
 	if options.BorderRadius > 0 {
@@ -318,21 +447,18 @@ func drawBackground(c *canvas.Canvas, width, height float64, options Options) {
 		bgPath = canvas.Rectangle(width, height)
 	}
 
-	// 如果有背景描边，设置描边属性
+	// 如果有背景描边，同时填充和描边
+	var strokeWidth float64
 	if options.BackgroundStroke != "" {
-		bgCtx.SetStrokeColor(canvas.Hex(options.BackgroundStroke))
-		bgCtx.SetStrokeWidth(options.BackgroundStrokeWidth)
-		bgCtx.DrawPath(0, 0, bgPath)
-		bgCtx.FillStroke()
-	} else {
-		bgCtx.DrawPath(0, 0, bgPath)
-		bgCtx.Fill()
+		strokeWidth = options.BackgroundStrokeWidth
 	}
+	fontcache.DrawPath(bgCtx, bgPath, canvas.Rect{X1: width, Y1: height},
+		parsePaint(options.BackgroundColor), parsePaint(options.BackgroundStroke), strokeWidth)
 }
 
 // drawTextContent 绘制文本内容
 func drawTextContent(c *canvas.Canvas, width, height float64, paths []*canvas.Path,
-	colorIndices []int, bounds []canvas.Rect, xOffsets []float64, minY float64,
+	colorIndices []int, styles []pathStyle, bounds []canvas.Rect, xOffsets []float64, minY float64,
 	scaleX, scaleY float64, options Options) {
 
 	// 创建文字上下文
@@ -348,8 +474,10 @@ func drawTextContent(c *canvas.Canvas, width, height float64, paths []*canvas.Pa
 	} else if len(paths) > 0 {
 		// 单字符模式计算总宽度
 		if len(xOffsets) > 0 && len(paths) > 0 {
-			lastIdx := len(paths) - 1
-			contentWidth = (xOffsets[lastIdx] + paths[lastIdx].Bounds().W()) * scaleX
+			// 竖排时最后一个字符不一定在最右侧，取所有字符的最大右边缘
+			for i, rect := range bounds {
+				contentWidth = math.Max(contentWidth, (xOffsets[i]+rect.W())*scaleX)
+			}
 
 			// 计算内容高度 - 使用所有路径的最大高度
 			var maxBoundsY float64
@@ -396,34 +524,19 @@ func drawTextContent(c *canvas.Canvas, width, height float64, paths []*canvas.Pa
 	ctx.Scale(scaleX, scaleY)
 
 	// 绘制每个字符并设置颜色
+	contentRect := canvas.Rect{X1: contentWidth / scaleX, Y1: contentHeight / scaleY}
 	pathIndex := 0
 	for _, colorIndex := range colorIndices {
 		if options.RenderMode == RenderModeString {
-			// 整体字符串路径模式
-			path := paths[0]
-
-			// 保存当前上下文状态
-			ctx.Push()
+			// 整体字符串路径模式，调整Y坐标，确保基线位置正确
+			path := paths[0].Translate(0, -minY)
 
-			// 如果启用描边，设置描边属性
+			// 如果启用描边，同时填充和描边
+			var strokeWidth float64
 			if options.EnableStroke && options.StrokeWidth > 0 {
-				ctx.SetStrokeWidth(options.StrokeWidth)
-				ctx.SetStrokeColor(canvas.Hex(options.StrokeColor))
-				// 设置填充颜色
-				ctx.SetFillColor(canvas.Hex(options.Colors[0]))
-				// 绘制路径 - 调整Y坐标，确保基线位置正确
-				ctx.DrawPath(0, -minY, path)
-				// 同时填充和描边
-				ctx.FillStroke()
-			} else {
-				// 只填充文字
-				ctx.SetFillColor(canvas.Hex(options.Colors[0]))
-				ctx.DrawPath(0, -minY, path)
-				ctx.Fill()
+				strokeWidth = options.StrokeWidth
 			}
-
-			// 恢复上下文状态
-			ctx.Pop()
+			fontcache.DrawPath(ctx, path, path.Bounds(), parsePaint(options.Colors[0]), parsePaint(options.StrokeColor), strokeWidth)
 			break // 只需要绘制一次
 		} else {
 			if colorIndex == -1 { // 跳过空格
@@ -449,28 +562,22 @@ func drawTextContent(c *canvas.Canvas, width, height float64, paths []*canvas.Pa
 			charX := xOffsets[pathIndex] - bounds[pathIndex].X0
 			charY := -minY // 调整Y坐标，使基线位置一致
 
-			// 保存当前上下文状态
-			ctx.Push()
-
-			// 如果启用描边，设置描边属性
-			if options.EnableStroke && options.StrokeWidth > 0 {
-				ctx.SetStrokeWidth(options.StrokeWidth)
-				ctx.SetStrokeColor(canvas.Hex(options.StrokeColor))
-				// 设置填充颜色
-				ctx.SetFillColor(canvas.Hex(options.Colors[colorIndex]))
-				// 绘制路径
-				ctx.DrawPath(charX, charY, path)
-				// 同时填充和描边
-				ctx.FillStroke()
-			} else {
-				// 只填充文字
-				ctx.SetFillColor(canvas.Hex(options.Colors[colorIndex]))
-				ctx.DrawPath(charX, charY, path)
-				ctx.Fill()
+			// 确定填充和描边，富文本使用所在段的样式
+			style := pathStyle{fill: options.Colors[colorIndex]}
+			if options.EnableStroke {
+				style.strokeColor, style.strokeWidth = options.StrokeColor, options.StrokeWidth
+			}
+			if pathIndex < len(styles) {
+				style = styles[pathIndex]
 			}
 
-			// 恢复上下文状态
-			ctx.Pop()
+			// 渐变和图案默认按整段文本的边界框定位，PaintPerChar时按每个字符定位
+			path = path.Translate(charX, charY)
+			rect := contentRect
+			if options.PaintPerChar {
+				rect = path.Bounds()
+			}
+			fontcache.DrawPath(ctx, path, rect, parsePaint(style.fill), parsePaint(style.strokeColor), style.strokeWidth)
 
 			pathIndex++
 		}
@@ -484,14 +591,14 @@ func drawExtraTexts(c *canvas.Canvas, width, height float64, options Options) {
 			continue // 跳过空文本
 		}
 
-		// 确定字体
-		extraFontPath := extraText.FontPath
+		// 确定字体，未指定时使用主文本字体
+		extraFontPath, extraFontData := extraText.FontPath, []byte(nil)
 		if extraFontPath == "" {
-			extraFontPath = options.FontPath // 使用主文本字体
+			extraFontPath, extraFontData = options.FontPath, options.FontData
 		}
 
 		// 加载字体
-		extraFont, err := loadFontFamily(extraFontPath)
+		extraFont, err := loadFont(fontcache.Source{Path: extraFontPath, Data: extraFontData, FS: options.FontFS}, Options{})
 		if err != nil {
 			continue // 跳过加载失败的字体
 		}
@@ -559,31 +666,17 @@ func drawExtraTexts(c *canvas.Canvas, width, height float64, options Options) {
 			textColor = "#000000" // 默认黑色
 		}
 
-		// 如果需要描边，设置描边属性
+		// 如果需要描边，同时填充和描边
+		var strokeWidth float64
+		strokeColor := extraText.StrokeColor
 		if extraText.StrokeText && extraText.StrokeWidth > 0 {
-			extraCtx.SetStrokeWidth(extraText.StrokeWidth)
-
-			strokeColor := extraText.StrokeColor
+			strokeWidth = extraText.StrokeWidth
 			if strokeColor == "" {
 				strokeColor = "#000000" // 默认黑色描边
 			}
-
-			extraCtx.SetStrokeColor(canvas.Hex(strokeColor))
-			extraCtx.SetFillColor(canvas.Hex(textColor))
-
-			// 绘制路径 - 使用原点(0,0)，已经通过Translate调整了位置
-			extraCtx.DrawPath(0, 0, extraPath)
-
-			// 同时填充和描边
-			extraCtx.FillStroke()
-		} else {
-			// 只填充文字
-			extraCtx.SetFillColor(canvas.Hex(textColor))
-
-			// 绘制路径 - 使用原点(0,0)，已经通过Translate调整了位置
-			extraCtx.DrawPath(0, 0, extraPath)
-
-			extraCtx.Fill()
 		}
+
+		// 绘制路径 - 使用原点(0,0)，已经通过Translate调整了位置
+		fontcache.DrawPath(extraCtx, extraPath, extraBounds, parsePaint(textColor), parsePaint(strokeColor), strokeWidth)
 	}
 }
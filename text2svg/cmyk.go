@@ -0,0 +1,369 @@
+package text2svg
+
+import (
+	"bufio"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"math/bits"
+)
+
+// Go标准库的image/jpeg只能编码灰度和YCbCr图像，x/image/tiff也不支持CMYK，
+// 印刷用的CMYK JPEG/TIFF在这里单独编码。
+
+// toCMYK 将渲染结果合成到白色背景上并转换为CMYK
+// 使用color.RGBToCMYK的简单公式，不经过ICC配置文件做色彩管理：纯黑为K=100，
+// 但抗锯齿边缘的灰色像素同样只用K表示，彩色边缘则会混入C/M/Y
+func toCMYK(img image.Image) *image.CMYK {
+	bounds := img.Bounds()
+	out := image.NewCMYK(bounds)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			// RGBA()返回预乘alpha的值，加上(1-a)的白色即为合成结果
+			r, g, b, a := img.At(x, y).RGBA()
+			white := 0xFFFF - a
+			c, m, yy, k := color.RGBToCMYK(uint8((r+white)>>8), uint8((g+white)>>8), uint8((b+white)>>8))
+			out.SetCMYK(x, y, color.CMYK{C: c, M: m, Y: yy, K: k})
+		}
+	}
+	return out
+}
+
+// jpegZigzag 之字形顺序到自然顺序的下标映射
+var jpegZigzag = [64]int{
+	0, 1, 8, 16, 9, 2, 3, 10,
+	17, 24, 32, 25, 18, 11, 4, 5,
+	12, 19, 26, 33, 40, 48, 41, 34,
+	27, 20, 13, 6, 7, 14, 21, 28,
+	35, 42, 49, 56, 57, 50, 43, 36,
+	29, 22, 15, 23, 30, 37, 44, 51,
+	58, 59, 52, 45, 38, 31, 39, 46,
+	53, 60, 61, 54, 47, 55, 62, 63,
+}
+
+// jpegQuantTable JPEG规范K.1中的亮度量化表（自然顺序），四个分量共用
+var jpegQuantTable = [64]int{
+	16, 11, 10, 16, 24, 40, 51, 61,
+	12, 12, 14, 19, 26, 58, 60, 55,
+	14, 13, 16, 24, 40, 57, 69, 56,
+	14, 17, 22, 29, 51, 87, 80, 62,
+	18, 22, 37, 56, 68, 109, 103, 77,
+	24, 35, 55, 64, 81, 104, 113, 92,
+	49, 64, 78, 87, 103, 121, 120, 101,
+	72, 92, 95, 98, 112, 100, 103, 99,
+}
+
+// JPEG规范K.3中的亮度DC/AC哈夫曼表，四个分量共用
+var (
+	jpegDCBits   = [16]byte{0, 1, 5, 1, 1, 1, 1, 1, 1, 0, 0, 0, 0, 0, 0, 0}
+	jpegDCValues = []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11}
+	jpegACBits   = [16]byte{0, 2, 1, 3, 3, 2, 4, 3, 5, 5, 4, 4, 0, 0, 1, 125}
+	jpegACValues = []byte{
+		0x01, 0x02, 0x03, 0x00, 0x04, 0x11, 0x05, 0x12,
+		0x21, 0x31, 0x41, 0x06, 0x13, 0x51, 0x61, 0x07,
+		0x22, 0x71, 0x14, 0x32, 0x81, 0x91, 0xa1, 0x08,
+		0x23, 0x42, 0xb1, 0xc1, 0x15, 0x52, 0xd1, 0xf0,
+		0x24, 0x33, 0x62, 0x72, 0x82, 0x09, 0x0a, 0x16,
+		0x17, 0x18, 0x19, 0x1a, 0x25, 0x26, 0x27, 0x28,
+		0x29, 0x2a, 0x34, 0x35, 0x36, 0x37, 0x38, 0x39,
+		0x3a, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48, 0x49,
+		0x4a, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58, 0x59,
+		0x5a, 0x63, 0x64, 0x65, 0x66, 0x67, 0x68, 0x69,
+		0x6a, 0x73, 0x74, 0x75, 0x76, 0x77, 0x78, 0x79,
+		0x7a, 0x83, 0x84, 0x85, 0x86, 0x87, 0x88, 0x89,
+		0x8a, 0x92, 0x93, 0x94, 0x95, 0x96, 0x97, 0x98,
+		0x99, 0x9a, 0xa2, 0xa3, 0xa4, 0xa5, 0xa6, 0xa7,
+		0xa8, 0xa9, 0xaa, 0xb2, 0xb3, 0xb4, 0xb5, 0xb6,
+		0xb7, 0xb8, 0xb9, 0xba, 0xc2, 0xc3, 0xc4, 0xc5,
+		0xc6, 0xc7, 0xc8, 0xc9, 0xca, 0xd2, 0xd3, 0xd4,
+		0xd5, 0xd6, 0xd7, 0xd8, 0xd9, 0xda, 0xe1, 0xe2,
+		0xe3, 0xe4, 0xe5, 0xe6, 0xe7, 0xe8, 0xe9, 0xea,
+		0xf1, 0xf2, 0xf3, 0xf4, 0xf5, 0xf6, 0xf7, 0xf8,
+		0xf9, 0xfa,
+	}
+)
+
+// jpegDCTCos 正向DCT的系数表：jpegDCTCos[u][x] = C(u)/2 * cos((2x+1)uπ/16)
+var jpegDCTCos = func() (table [8][8]float64) {
+	for u := 0; u < 8; u++ {
+		scale := 0.5
+		if u == 0 {
+			scale = 0.5 / math.Sqrt2
+		}
+		for x := 0; x < 8; x++ {
+			table[u][x] = scale * math.Cos(float64(2*x+1)*float64(u)*math.Pi/16)
+		}
+	}
+	return table
+}()
+
+// huffmanCode 哈夫曼编码
+type huffmanCode struct {
+	code uint32
+	size uint
+}
+
+// buildHuffmanCodes 根据码长统计和符号列表生成编码表
+func buildHuffmanCodes(counts [16]byte, values []byte) [256]huffmanCode {
+	var table [256]huffmanCode
+	code, k := uint32(0), 0
+	for size := uint(1); size <= 16; size++ {
+		for i := 0; i < int(counts[size-1]); i++ {
+			table[values[k]] = huffmanCode{code: code, size: size}
+			code++
+			k++
+		}
+		code <<= 1
+	}
+	return table
+}
+
+// cmykJpegEncoder Adobe CMYK JPEG的基线编码器
+// 四个分量都不做色度抽样，按Adobe的惯例反相保存（255表示无墨）
+type cmykJpegEncoder struct {
+	w      *bufio.Writer
+	quant  [64]int
+	dc, ac [256]huffmanCode
+	bits   uint32 // 待写出的位，从高位开始填充
+	nBits  uint
+}
+
+// encodeCMYKJPEG 将CMYK图像编码为JPEG
+func encodeCMYKJPEG(w io.Writer, img *image.CMYK, quality int) error {
+	e := &cmykJpegEncoder{
+		w:  bufio.NewWriter(w),
+		dc: buildHuffmanCodes(jpegDCBits, jpegDCValues),
+		ac: buildHuffmanCodes(jpegACBits, jpegACValues),
+	}
+
+	// 按libjpeg的方式根据质量缩放量化表
+	quality = max(1, min(quality, 100))
+	scale := 200 - quality*2
+	if quality < 50 {
+		scale = 5000 / quality
+	}
+	for i, q := range jpegQuantTable {
+		e.quant[i] = max(1, min((q*scale+50)/100, 255))
+	}
+
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	e.w.Write([]byte{0xFF, 0xD8}) // SOI
+	// APP14 Adobe段，transform=0表示CMYK不做颜色变换
+	e.writeSegment(0xEE, []byte{'A', 'd', 'o', 'b', 'e', 0, 100, 0, 0, 0, 0, 0})
+
+	dqt := []byte{0x00}
+	for _, idx := range jpegZigzag {
+		dqt = append(dqt, byte(e.quant[idx]))
+	}
+	e.writeSegment(0xDB, dqt)
+
+	sof := []byte{8}
+	sof = binary.BigEndian.AppendUint16(sof, uint16(height))
+	sof = binary.BigEndian.AppendUint16(sof, uint16(width))
+	sof = append(sof, 4)
+	for id := byte(1); id <= 4; id++ {
+		sof = append(sof, id, 0x11, 0)
+	}
+	e.writeSegment(0xC0, sof)
+
+	dht := append([]byte{0x00}, jpegDCBits[:]...)
+	dht = append(dht, jpegDCValues...)
+	dht = append(dht, 0x10)
+	dht = append(dht, jpegACBits[:]...)
+	dht = append(dht, jpegACValues...)
+	e.writeSegment(0xC4, dht)
+
+	e.writeSegment(0xDA, []byte{4, 1, 0, 2, 0, 3, 0, 4, 0, 0, 63, 0})
+
+	// 按MCU依次编码四个分量的8x8块，超出边界的部分重复边缘像素
+	var prevDC [4]int
+	var block [64]float64
+	for by := 0; by < height; by += 8 {
+		for bx := 0; bx < width; bx += 8 {
+			for c := 0; c < 4; c++ {
+				for y := 0; y < 8; y++ {
+					row := img.PixOffset(bounds.Min.X, bounds.Min.Y+min(by+y, height-1))
+					for x := 0; x < 8; x++ {
+						v := img.Pix[row+min(bx+x, width-1)*4+c]
+						block[y*8+x] = float64(255-v) - 128
+					}
+				}
+				prevDC[c] = e.writeBlock(&block, prevDC[c])
+			}
+		}
+	}
+
+	e.emit(0x7F, 7)               // 用1填充最后一个字节
+	e.w.Write([]byte{0xFF, 0xD9}) // EOI
+	return e.w.Flush()
+}
+
+// writeSegment 写入带长度的标记段
+func (e *cmykJpegEncoder) writeSegment(marker byte, payload []byte) {
+	e.w.Write([]byte{0xFF, marker})
+	binary.Write(e.w, binary.BigEndian, uint16(len(payload)+2))
+	e.w.Write(payload)
+}
+
+// emit 写出n位，遇到0xFF时按规范插入0x00
+func (e *cmykJpegEncoder) emit(value uint32, n uint) {
+	e.bits |= (value & (1<<n - 1)) << (32 - e.nBits - n)
+	e.nBits += n
+	for e.nBits >= 8 {
+		b := byte(e.bits >> 24)
+		e.w.WriteByte(b)
+		if b == 0xFF {
+			e.w.WriteByte(0)
+		}
+		e.bits <<= 8
+		e.nBits -= 8
+	}
+}
+
+// emitValue 写出系数的哈夫曼编码和附加位
+func (e *cmykJpegEncoder) emitValue(code huffmanCode, value int, size uint) {
+	e.emit(code.code, code.size)
+	if value < 0 {
+		value--
+	}
+	e.emit(uint32(value), size)
+}
+
+// writeBlock 对一个8x8块做DCT、量化和熵编码，返回本块的DC值
+func (e *cmykJpegEncoder) writeBlock(block *[64]float64, prevDC int) int {
+	// 先按行再按列做可分离的正向DCT
+	var tmp, coef [64]float64
+	for y := 0; y < 8; y++ {
+		for u := 0; u < 8; u++ {
+			var sum float64
+			for x := 0; x < 8; x++ {
+				sum += jpegDCTCos[u][x] * block[y*8+x]
+			}
+			tmp[y*8+u] = sum
+		}
+	}
+	for v := 0; v < 8; v++ {
+		for u := 0; u < 8; u++ {
+			var sum float64
+			for y := 0; y < 8; y++ {
+				sum += jpegDCTCos[v][y] * tmp[y*8+u]
+			}
+			coef[v*8+u] = sum
+		}
+	}
+
+	var q [64]int
+	for i := range coef {
+		q[i] = int(math.Round(coef[i] / float64(e.quant[i])))
+	}
+
+	// DC系数编码与上一块的差值
+	diff := q[0] - prevDC
+	size := uint(bits.Len(uint(abs(diff))))
+	e.emitValue(e.dc[size], diff, size)
+
+	// AC系数按之字形顺序做游程编码
+	run := 0
+	for k := 1; k < 64; k++ {
+		v := q[jpegZigzag[k]]
+		if v == 0 {
+			run++
+			continue
+		}
+		for run > 15 {
+			e.emit(e.ac[0xF0].code, e.ac[0xF0].size) // ZRL
+			run -= 16
+		}
+		size := uint(bits.Len(uint(abs(v))))
+		e.emitValue(e.ac[byte(run<<4)|byte(size)], v, size)
+		run = 0
+	}
+	if run > 0 {
+		e.emit(e.ac[0x00].code, e.ac[0x00].size) // EOB
+	}
+	return q[0]
+}
+
+// abs 整数绝对值
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// encodeCMYKTIFF 将CMYK图像编码为未压缩的TIFF（PhotometricInterpretation=Separated）
+func encodeCMYKTIFF(w io.Writer, img *image.CMYK) error {
+	order := binary.LittleEndian
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	type entry struct {
+		tag, typ uint16
+		count    uint32
+		value    uint32
+	}
+	const (
+		typeShort    = 3
+		typeLong     = 4
+		typeRational = 5
+		numEntries   = 14
+		ifdOffset    = 8
+		valuesOffset = ifdOffset + 2 + numEntries*12 + 4
+		bitsOffset   = valuesOffset      // BitsPerSample: 4个SHORT
+		xResOffset   = valuesOffset + 8  // XResolution
+		yResOffset   = valuesOffset + 16 // YResolution
+		pixelOffset  = valuesOffset + 24
+	)
+	entries := [numEntries]entry{
+		{256, typeLong, 1, uint32(width)},              // ImageWidth
+		{257, typeLong, 1, uint32(height)},             // ImageLength
+		{258, typeShort, 4, bitsOffset},                // BitsPerSample
+		{259, typeShort, 1, 1},                         // Compression: 不压缩
+		{262, typeShort, 1, 5},                         // PhotometricInterpretation: Separated
+		{273, typeLong, 1, pixelOffset},                // StripOffsets
+		{277, typeShort, 1, 4},                         // SamplesPerPixel
+		{278, typeLong, 1, uint32(height)},             // RowsPerStrip
+		{279, typeLong, 1, uint32(width * height * 4)}, // StripByteCounts
+		{282, typeRational, 1, xResOffset},             // XResolution
+		{283, typeRational, 1, yResOffset},             // YResolution
+		{284, typeShort, 1, 1},                         // PlanarConfiguration: 交错存储
+		{296, typeShort, 1, 2},                         // ResolutionUnit: 英寸
+		{332, typeShort, 1, 1},                         // InkSet: CMYK
+	}
+
+	buf := make([]byte, 0, pixelOffset+width*height*4)
+	buf = append(buf, "II\x2A\x00"...)
+	buf = order.AppendUint32(buf, ifdOffset)
+	buf = order.AppendUint16(buf, numEntries)
+	for _, e := range entries {
+		buf = order.AppendUint16(buf, e.tag)
+		buf = order.AppendUint16(buf, e.typ)
+		buf = order.AppendUint32(buf, e.count)
+		if e.typ == typeShort && e.count == 1 {
+			buf = order.AppendUint16(buf, uint16(e.value))
+			buf = append(buf, 0, 0)
+		} else {
+			buf = order.AppendUint32(buf, e.value)
+		}
+	}
+	buf = order.AppendUint32(buf, 0) // 没有下一个IFD
+	for i := 0; i < 4; i++ {
+		buf = order.AppendUint16(buf, 8)
+	}
+	for i := 0; i < 2; i++ { // 默认72DPI，保存时再按配置修改
+		buf = order.AppendUint32(buf, 72)
+		buf = order.AppendUint32(buf, 1)
+	}
+	for y := 0; y < height; y++ {
+		row := img.PixOffset(bounds.Min.X, bounds.Min.Y+y)
+		buf = append(buf, img.Pix[row:row+width*4]...)
+	}
+
+	_, err := w.Write(buf)
+	return err
+}
@@ -0,0 +1,218 @@
+package text2svg
+
+import (
+	"math"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ibryang/go-utils/fontcache"
+	"github.com/tdewolff/canvas"
+)
+
+type (
+	// MissingGlyph 所有字体都无法渲染的字符及其位置
+	MissingGlyph = fontcache.MissingGlyph
+	// MissingGlyphError 严格模式下文本包含无法渲染的字符时返回的错误
+	MissingGlyphError = fontcache.MissingGlyphError
+)
+
+// fontChain 主字体和回退字体组成的字体链，按顺序查找包含字形的字体
+type fontChain struct {
+	fonts []*canvas.Font
+	faces []*canvas.FontFace
+}
+
+// newFontChain 创建字体链，加载失败的回退字体会被跳过
+func newFontChain(font *canvas.Font, size float64, options Options) *fontChain {
+	chain := &fontChain{
+		fonts: []*canvas.Font{font},
+		faces: []*canvas.FontFace{newFontFace(font, size, options)},
+	}
+	for _, fallbackPath := range options.FallbackFonts {
+		fallback, err := loadFont(fontcache.Source{Path: fallbackPath, FS: options.FontFS}, options)
+		if err != nil {
+			continue // 跳过加载失败的回退字体
+		}
+		chain.fonts = append(chain.fonts, fallback)
+		chain.faces = append(chain.faces, newFontFace(fallback, size, options))
+	}
+	return chain
+}
+
+// split 按字体将文本拆分为多段，空白、控制字符等不需要字形的字符沿用前一段的字体
+func (fc *fontChain) split(text string) []fontcache.Run {
+	return fontcache.SplitRuns(fc.fonts, text)
+}
+
+// shape 逐段对文本整体排版并拆分为字形簇，保留字距调整和连字
+// 字形簇的X为相对文本起点的位置，Start为在整个文本中的字节位置
+func (fc *fontChain) shape(text string) ([]fontcache.Cluster, error) {
+	var clusters []fontcache.Cluster
+	var x float64
+	start := 0
+	for _, run := range fc.split(text) {
+		runClusters, err := fontcache.ShapeClusters(fc.faces[run.Font], run.Text)
+		if err != nil {
+			return nil, err
+		}
+		offset := x
+		for _, cluster := range runClusters {
+			cluster.X += offset
+			cluster.Start += start
+			clusters = append(clusters, cluster)
+			x += cluster.Advance
+		}
+		start += len(run.Text)
+	}
+	return clusters, nil
+}
+
+// clusterLayout 判断是否需要按字形簇排版后再合并为整体路径
+func clusterLayout(options Options) bool {
+	return options.Direction == DirectionVertical || options.TextPath != nil || wrapLines(options.Text, options) ||
+		options.LetterSpacing != 0 || options.WordSpacing != 0 || len(options.CharOffsets) > 0
+}
+
+// wrapLines 判断横排文本是否需要分为多行：设置了WrapWidth或包含换行符
+func wrapLines(text string, options Options) bool {
+	if options.Direction == DirectionVertical || options.TextPath != nil {
+		return false
+	}
+	return options.WrapWidth > 0 || strings.ContainsAny(text, "\n\r")
+}
+
+// layoutLines 自动换行后逐行排版，各行按Alignment对齐，行距为字体行高加LineSpacing
+// 字形簇的路径已移动到所在位置，X为0，第一行的基线为y=0
+func (fc *fontChain) layoutLines(text string, options Options) ([]fontcache.Cluster, error) {
+	lineOptions := options
+	lineOptions.WrapWidth = 0
+
+	var measureErr error
+	measure := func(s string) float64 {
+		lineOptions.CharOffsets = nil
+		clusters, err := fc.layout(s, lineOptions)
+		if err != nil {
+			measureErr = err
+			return 0
+		}
+		return lineWidth(clusters)
+	}
+	lines := fontcache.Wrap(text, fontcache.WrapOptions{
+		Width:    options.WrapWidth,
+		MaxLines: options.MaxLines,
+		Ellipsis: options.Ellipsis,
+	}, measure)
+	if measureErr != nil {
+		return nil, measureErr
+	}
+
+	lineClusters := make([][]fontcache.Cluster, len(lines))
+	widths := make([]float64, len(lines))
+	var maxWidth float64
+	for i, line := range lines {
+		// 逐字符偏移按字符在原文本中的位置对应
+		lineOptions.CharOffsets = nil
+		if index := utf8.RuneCountInString(text[:line.Start]); index < len(options.CharOffsets) {
+			lineOptions.CharOffsets = options.CharOffsets[index:]
+		}
+		clusters, err := fc.layout(line.Text, lineOptions)
+		if err != nil {
+			return nil, err
+		}
+		lineClusters[i] = clusters
+		widths[i] = lineWidth(clusters)
+		maxWidth = math.Max(maxWidth, widths[i])
+	}
+
+	var result []fontcache.Cluster
+	lineHeight := fc.faces[0].Metrics().LineHeight + options.LineSpacing
+	for i, clusters := range lineClusters {
+		var x float64
+		switch options.Alignment {
+		case AlignCenter:
+			x = (maxWidth - widths[i]) / 2
+		case AlignRight:
+			x = maxWidth - widths[i]
+		}
+		y := -float64(i) * lineHeight
+		for _, cluster := range clusters {
+			cluster.Path = cluster.Path.Translate(cluster.X+x, y)
+			cluster.X = 0
+			result = append(result, cluster)
+		}
+	}
+	return result, nil
+}
+
+// lineWidth 返回一行字形簇的前进宽度之和
+func lineWidth(clusters []fontcache.Cluster) float64 {
+	var width float64
+	for _, cluster := range clusters {
+		width = math.Max(width, cluster.X+cluster.Advance)
+	}
+	return width
+}
+
+// layout 按options横排、竖排或沿路径排列文本并拆分为字形簇，应用字符间距、单词间距和逐字符偏移
+// 多行、竖排和沿路径排列时字形簇的路径已移动到所在位置，X为0；竖排时列中线为x=0
+func (fc *fontChain) layout(text string, options Options) ([]fontcache.Cluster, error) {
+	if wrapLines(text, options) {
+		return fc.layoutLines(text, options)
+	}
+	vertical := options.Direction == DirectionVertical && options.TextPath == nil
+	var clusters []fontcache.Cluster
+	var err error
+	if vertical {
+		clusters, err = fontcache.VerticalClusters(fc.faces, text, fontcache.VerticalOptions{
+			Upright:     options.VerticalUpright,
+			TateChuYoko: options.TateChuYoko,
+		})
+	} else {
+		clusters, err = fc.shape(text)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var shift float64
+	for i := range clusters {
+		cluster := &clusters[i]
+		cluster.X += shift
+		spacing := fontcache.Spacing(cluster.Text, options.LetterSpacing, options.WordSpacing)
+		cluster.Advance += spacing
+		shift += spacing
+
+		if index := utf8.RuneCountInString(text[:cluster.Start]); index < len(options.CharOffsets) {
+			cluster.Path = options.CharOffsets[index].Apply(cluster.Path)
+		}
+		if vertical {
+			cluster.Path = cluster.Path.Translate(0, -cluster.X)
+			cluster.X = 0
+		}
+	}
+	if options.TextPath != nil {
+		return fontcache.AlongPath(clusters, *options.TextPath)
+	}
+	return clusters, nil
+}
+
+// checkGlyphs 检查所有字体都无法渲染的字符，严格模式下返回MissingGlyphError，否则通过OnMissingGlyphs回调
+func (fc *fontChain) checkGlyphs(options Options) error {
+	missing := fontcache.MissingGlyphs(options.Text, fc.fonts)
+	if len(options.Spans) > 0 {
+		var err error
+		if missing, err = spanMissingGlyphs(options); err != nil {
+			return err
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	if options.Strict {
+		return &MissingGlyphError{Glyphs: missing}
+	}
+	if options.OnMissingGlyphs != nil {
+		options.OnMissingGlyphs(missing)
+	}
+	return nil
+}
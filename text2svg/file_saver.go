@@ -1,11 +1,16 @@
 package text2svg
 
 import (
+	"bytes"
 	"fmt"
+	"io"
+	"os"
 
 	"github.com/ibryang/go-utils/changedpi"
+	"github.com/ibryang/go-utils/fontcache"
 	"github.com/tdewolff/canvas"
 	"github.com/tdewolff/canvas/renderers"
+	"github.com/tdewolff/canvas/renderers/rasterizer"
 )
 
 // saveToFile 保存画布到文件
@@ -14,7 +19,20 @@ func saveToFile(c *canvas.Canvas, config SaveConfig) (canvas *canvas.Canvas, err
 		return nil, fmt.Errorf("保存路径不能为空")
 	}
 
-	// 设置默认值
+	data, err := renderCanvas(c, config)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.WriteFile(config.Path, data, 0644); err != nil {
+		return nil, fmt.Errorf("保存%s文件失败: %v", formatName(config.Format), err)
+	}
+
+	return c, nil
+}
+
+// applySaveDefaults 设置保存配置的默认值
+func applySaveDefaults(config *SaveConfig) {
 	if config.DPI == 0 {
 		config.DPI = 72
 	}
@@ -24,67 +42,201 @@ func saveToFile(c *canvas.Canvas, config SaveConfig) (canvas *canvas.Canvas, err
 	if config.Quality == 0 {
 		config.Quality = 80
 	}
+}
 
-	// 根据不同格式保存
+// renderCanvas 在内存中按格式渲染画布，返回文件内容
+func renderCanvas(c *canvas.Canvas, config SaveConfig) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := writeCanvas(&buf, c, config); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeCanvas 按格式将画布写入writer
+func writeCanvas(w io.Writer, c *canvas.Canvas, config SaveConfig) error {
+	// 设置默认值
+	applySaveDefaults(&config)
+	if err := checkICCColorSpace(config); err != nil {
+		return err
+	}
+
+	switch config.ColorMode {
+	case "", ColorModeRGB:
+	case ColorModeCMYK:
+		switch config.Format {
+		case FormatJPEG, FormatJPG, FormatTIFF, FormatTIF:
+			return writeCMYK(w, c, config)
+		}
+		return fmt.Errorf("CMYK颜色模式仅支持JPEG和TIFF格式: %s", config.Format)
+	default:
+		return fmt.Errorf("不支持的颜色模式: %s", config.ColorMode)
+	}
+
+	// 根据不同格式渲染
 	switch config.Format {
 	case FormatPNG:
-		if err := savePNG(c, config); err != nil {
-			return nil, err
-		}
+		return writePNG(w, c, config)
 	case FormatJPEG, FormatJPG:
-		if err := saveJPEG(c, config); err != nil {
-			return nil, err
-		}
+		return writeJPEG(w, c, config)
 	case FormatSVG:
-		if err := c.WriteFile(config.Path, renderers.SVG()); err != nil {
-			return nil, fmt.Errorf("保存SVG文件失败: %v", err)
-		}
+		return writeSVG(w, c, config)
 	case FormatPDF:
-		if err := c.WriteFile(config.Path, renderers.PDF()); err != nil {
-			return nil, fmt.Errorf("保存PDF文件失败: %v", err)
-		}
+		return writePDF(w, c, config)
 	case FormatTIFF, FormatTIF:
-		if err := c.WriteFile(config.Path, renderers.TIFF()); err != nil {
-			return nil, fmt.Errorf("保存TIFF文件失败: %v", err)
-		}
-	default:
-		return nil, fmt.Errorf("不支持的文件格式: %s", config.Format)
+		return writeTIFF(w, c, config)
 	}
+	return fmt.Errorf("不支持的文件格式: %s", config.Format)
+}
 
-	return c, nil
+// checkICCColorSpace 检查ICC配置文件的色彩空间是否与颜色模式一致，在渲染前提前报错
+// SVG和PDF不嵌入配置文件，不检查
+func checkICCColorSpace(config SaveConfig) error {
+	space := changedpi.ICCColorSpace(config.ICCProfile)
+	if space == "" || config.Format == FormatSVG || config.Format == FormatPDF {
+		return nil
+	}
+	want := "RGB"
+	if config.ColorMode == ColorModeCMYK {
+		want = "CMYK"
+	}
+	if space != want {
+		return fmt.Errorf("嵌入ICC配置文件失败: %v: 配置文件为%s，颜色模式为%s", changedpi.ErrICCColorSpace, space, want)
+	}
+	return nil
 }
 
-// savePNG 保存PNG格式
-func savePNG(c *canvas.Canvas, config SaveConfig) error {
-	if err := c.WriteFile(config.Path, renderers.PNG(canvas.DPI(config.DPI))); err != nil {
-		return fmt.Errorf("保存PNG文件失败: %v", err)
+// writeSVG 渲染SVG格式
+func writeSVG(w io.Writer, c *canvas.Canvas, config SaveConfig) error {
+	var buf bytes.Buffer
+	if err := c.Write(&buf, fontcache.SVG()); err != nil {
+		return fmt.Errorf("渲染SVG失败: %v", err)
 	}
+	_, err := io.WriteString(w, addSVGMetadata(buf.String(), config.Metadata))
+	return err
+}
 
-	// 如果DPI不是72，需要更新DPI信息
-	if config.DPI != 72 {
-		return updateImageDPI(config.Path, int(config.DPI))
+// writePDF 渲染PDF格式
+func writePDF(w io.Writer, c *canvas.Canvas, config SaveConfig) error {
+	var buf bytes.Buffer
+	if err := c.Write(&buf, fontcache.PDF()); err != nil {
+		return fmt.Errorf("渲染PDF失败: %v", err)
 	}
-	return nil
+	data, err := addPDFInfo(buf.Bytes(), config.Metadata)
+	if err != nil {
+		return fmt.Errorf("写入PDF元数据失败: %v", err)
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// writePNG 渲染PNG格式
+func writePNG(w io.Writer, c *canvas.Canvas, config SaveConfig) error {
+	var buf bytes.Buffer
+	if err := c.Write(&buf, renderers.PNG(canvas.DPI(config.DPI))); err != nil {
+		return fmt.Errorf("渲染PNG失败: %v", err)
+	}
+	return writeImage(w, buf.Bytes(), config)
+}
+
+// writeJPEG 渲染JPEG格式
+func writeJPEG(w io.Writer, c *canvas.Canvas, config SaveConfig) error {
+	var buf bytes.Buffer
+	if err := c.Write(&buf, renderers.JPEG(canvas.DPI(config.DPI), config.Quality)); err != nil {
+		return fmt.Errorf("渲染JPEG失败: %v", err)
+	}
+	return writeImage(w, buf.Bytes(), config)
+}
+
+// writeTIFF 渲染TIFF格式
+func writeTIFF(w io.Writer, c *canvas.Canvas, config SaveConfig) error {
+	var buf bytes.Buffer
+	if err := c.Write(&buf, renderers.TIFF(canvas.DPI(config.DPI))); err != nil {
+		return fmt.Errorf("渲染TIFF失败: %v", err)
+	}
+	return writeImage(w, buf.Bytes(), config)
 }
 
-// saveJPEG 保存JPEG格式
-func saveJPEG(c *canvas.Canvas, config SaveConfig) error {
-	if err := c.WriteFile(config.Path, renderers.JPEG(canvas.DPI(config.DPI), config.Quality)); err != nil {
-		return fmt.Errorf("保存JPEG文件失败: %v", err)
+// writeCMYK 以CMYK颜色模式渲染JPEG或TIFF
+func writeCMYK(w io.Writer, c *canvas.Canvas, config SaveConfig) error {
+	img := toCMYK(rasterizer.Draw(c, canvas.DPI(config.DPI), canvas.DefaultColorSpace))
+
+	var buf bytes.Buffer
+	var err error
+	if config.Format == FormatTIFF || config.Format == FormatTIF {
+		err = encodeCMYKTIFF(&buf, img)
+	} else {
+		err = encodeCMYKJPEG(&buf, img, config.Quality)
 	}
+	if err != nil {
+		return fmt.Errorf("渲染CMYK %s失败: %v", formatName(config.Format), err)
+	}
+	return writeImage(w, buf.Bytes(), config)
+}
 
+// writeImage 更新图片的DPI信息、ICC配置文件和元数据后写入writer
+func writeImage(w io.Writer, data []byte, config SaveConfig) error {
+	var err error
 	// 如果DPI不是72，需要更新DPI信息
 	if config.DPI != 72 {
-		return updateImageDPI(config.Path, int(config.DPI))
+		data, err = updateImageDPI(data, config.DPI)
+		if err != nil {
+			return err
+		}
 	}
-	return nil
+	if len(config.ICCProfile) > 0 {
+		data, err = changedpi.EmbedICCProfile(data, config.ICCProfile)
+		if err != nil {
+			return fmt.Errorf("嵌入ICC配置文件失败: %v", err)
+		}
+	}
+	if len(config.Metadata) > 0 {
+		data, err = changedpi.WriteMetadata(data, config.Metadata)
+		if err != nil {
+			return fmt.Errorf("写入元数据失败: %v", err)
+		}
+	}
+	_, err = w.Write(data)
+	return err
 }
 
 // updateImageDPI 更新图片DPI信息
-func updateImageDPI(path string, dpi int) error {
-	err := changedpi.ChangeDpi(path, path, dpi)
+func updateImageDPI(data []byte, dpi float64) ([]byte, error) {
+	newData, err := changedpi.ChangeDpiBytesXY(data, dpi, dpi)
 	if err != nil {
-		return fmt.Errorf("更新DPI失败: %v", err)
+		return nil, fmt.Errorf("更新DPI失败: %v", err)
 	}
-	return nil
+	return newData, nil
+}
+
+// formatName 返回格式的显示名称
+func formatName(format SaveFormat) string {
+	switch format {
+	case FormatJPEG, FormatJPG:
+		return "JPEG"
+	case FormatTIFF, FormatTIF:
+		return "TIFF"
+	case FormatPNG:
+		return "PNG"
+	case FormatPDF:
+		return "PDF"
+	case FormatSVG:
+		return "SVG"
+	}
+	return string(format)
+}
+
+// mimeType 返回格式对应的MIME类型
+func mimeType(format SaveFormat) string {
+	switch format {
+	case FormatPNG:
+		return "image/png"
+	case FormatJPEG, FormatJPG:
+		return "image/jpeg"
+	case FormatPDF:
+		return "application/pdf"
+	case FormatTIFF, FormatTIF:
+		return "image/tiff"
+	}
+	return "image/svg+xml"
 }
@@ -1,71 +1,52 @@
 package text2svg
 
 import (
-	"fmt"
-	"os"
-
-	"github.com/ibryang/go-utils/os/file"
+	"github.com/ibryang/go-utils/fontcache"
 	"github.com/tdewolff/canvas"
 )
 
-// fontLoader 接口定义字体加载行为
-type fontLoader interface {
-	load(path string) (*canvas.Font, error)
-}
-
-// fileFontLoader 实现从文件加载字体
-type fileFontLoader struct{}
-
-func (l *fileFontLoader) load(path string) (*canvas.Font, error) {
-	if !isExist(path) {
-		return nil, fmt.Errorf("文件不存在: %s", path)
-	}
-	return canvas.LoadFontFile(path, canvas.FontBlack)
-}
-
-// systemFontLoader 实现从系统加载字体
-type systemFontLoader struct{}
-
-func (l *systemFontLoader) load(path string) (font *canvas.Font, err error) {
-	font, err = canvas.LoadSystemFont(path, canvas.FontBlack)
-	if err != nil {
-		return canvas.LoadSystemFont(file.Name(path), canvas.FontBlack)
-	}
-	return
-}
-
-// fontManager 管理字体加载
-type fontManager struct {
-	loaders []fontLoader
-}
+type (
+	// FontVariations 可变字体轴设置，例如{"wght": 700, "wdth": 75}
+	FontVariations = fontcache.Variations
+	// FontFeatures OpenType特性设置，例如{"liga": 0, "smcp": 1, "tnum": 1}
+	FontFeatures = fontcache.Features
+	// CharOffset 单个字符的额外偏移和旋转
+	CharOffset = fontcache.CharOffset
+	// TextPath 文字排列的路径，SVG路径或圆弧
+	TextPath = fontcache.TextPath
+	// PathAlign 文字沿路径的对齐方式
+	PathAlign = fontcache.PathAlign
+)
 
-func newFontManager() *fontManager {
-	return &fontManager{
-		loaders: []fontLoader{
-			&fileFontLoader{},
-			&systemFontLoader{},
-		},
-	}
-}
+const (
+	PathAlignStart  = fontcache.PathAlignStart  // 从路径起点开始排列
+	PathAlignCenter = fontcache.PathAlignCenter // 居中于路径中点
+	PathAlignEnd    = fontcache.PathAlignEnd    // 结束于路径终点
+)
 
-func (fm *fontManager) loadFont(path string) (*canvas.Font, error) {
-	var lastErr error
-	for _, loader := range fm.loaders {
-		font, err := loader.load(path)
-		if err == nil {
-			return font, nil
+// fontStyle 返回字重和斜体对应的字体样式，weight为0时沿用原有的FontBlack
+func fontStyle(weight int, italic bool) canvas.FontStyle {
+	if weight == 0 {
+		style := canvas.FontBlack
+		if italic {
+			style |= canvas.FontItalic
 		}
-		lastErr = err
+		return style
 	}
-	return nil, fmt.Errorf("所有加载方式均失败，最后错误: %v", lastErr)
+	return fontcache.Style(weight, italic)
 }
 
-func loadFontFamily(fontPath string) (*canvas.Font, error) {
-	fontManager := newFontManager()
-	return fontManager.loadFont(fontPath)
+// loadFont 从共享字体注册表加载字体，优先使用src.Data，其次从src.FS中读取src.Path，最后按路径或名称加载
+// 按名称查找系统字体时选择与options的Weight和Italic最接近的字体，并应用可变字体轴和OpenType特性
+func loadFont(src fontcache.Source, options Options) (*canvas.Font, error) {
+	return fontcache.Default.LoadSource(src, fontStyle(options.Weight, options.Italic), options.Variations, options.OpenTypeFeatures)
 }
 
-func isExist(path string) bool {
-	_, err := os.Stat(path)
-	return err == nil
+// newFontFace 创建字体Face，字体本身的字重或斜体不满足options时使用伪粗体和伪斜体
+func newFontFace(font *canvas.Font, size float64, options Options) *canvas.FontFace {
+	weight := options.Weight
+	if _, ok := options.Variations["wght"]; ok {
+		weight = 0 // 字重由可变字体的wght轴决定
+	}
+	return fontcache.Face(font, size, weight, options.Italic)
 }
@@ -0,0 +1,149 @@
+package text2svg
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/ibryang/go-utils/changedpi"
+)
+
+// pdfInfoKeys 元数据键与PDF文档信息字典标准键的对应关系
+var pdfInfoKeys = map[string]string{
+	"Title":       "Title",
+	"Author":      "Author",
+	"Description": "Subject",
+	"Keywords":    "Keywords",
+	"Software":    "Creator",
+}
+
+var (
+	svgStartTag     = regexp.MustCompile(`<svg[^>]*>`)
+	pdfStartXref    = regexp.MustCompile(`startxref\s+(\d+)\s+%%EOF\s*$`)
+	pdfTrailerRoot  = regexp.MustCompile(`/Root\s+(\d+)\s+(\d+)\s+R`)
+	pdfTrailerSize  = regexp.MustCompile(`/Size\s+(\d+)`)
+	pdfTrailerStart = regexp.MustCompile(`trailer\s*<<`)
+)
+
+// addSVGMetadata 在SVG开始标签之后插入<title>和包含XMP的<metadata>
+func addSVGMetadata(svg string, metadata map[string]string) string {
+	if len(metadata) == 0 {
+		return svg
+	}
+	match := svgStartTag.FindStringIndex(svg)
+	if match == nil {
+		return svg
+	}
+
+	var b strings.Builder
+	if title, ok := metadata["Title"]; ok {
+		b.WriteString("<title>")
+		xml.EscapeText(&b, []byte(title))
+		b.WriteString("</title>")
+	}
+	b.WriteString("<metadata>")
+	b.WriteString(changedpi.BuildXMP(metadata))
+	b.WriteString("</metadata>")
+
+	return svg[:match[1]] + b.String() + svg[match[1]:]
+}
+
+// addPDFInfo 以增量更新的方式为PDF追加新的文档信息字典
+// 原文件内容保持不变，只在末尾追加Info对象、交叉引用表和新的trailer
+func addPDFInfo(data []byte, metadata map[string]string) ([]byte, error) {
+	if len(metadata) == 0 {
+		return data, nil
+	}
+
+	match := pdfStartXref.FindSubmatchIndex(data)
+	if match == nil {
+		return nil, fmt.Errorf("无效的PDF文件: 未找到startxref")
+	}
+	prevXref, _ := strconv.Atoi(string(data[match[2]:match[3]]))
+
+	// 最后一个trailer字典；使用交叉引用流的文件从xref对象的字典中读取
+	trailer := data[:match[0]]
+	if loc := pdfTrailerStart.FindAllIndex(trailer, -1); loc != nil {
+		trailer = trailer[loc[len(loc)-1][0]:]
+	} else if prevXref < len(data) {
+		trailer = data[prevXref:match[0]]
+	}
+	root := pdfTrailerRoot.FindSubmatch(trailer)
+	size := pdfTrailerSize.FindSubmatch(trailer)
+	if root == nil || size == nil {
+		return nil, fmt.Errorf("无效的PDF文件: 无法解析trailer")
+	}
+	infoID, _ := strconv.Atoi(string(size[1]))
+
+	var buf bytes.Buffer
+	buf.Write(data)
+	if !bytes.HasSuffix(data, []byte("\n")) {
+		buf.WriteByte('\n')
+	}
+
+	// Info对象
+	infoOffset := buf.Len()
+	fmt.Fprintf(&buf, "%d 0 obj\n<<", infoID)
+	keys := make([]string, 0, len(metadata))
+	for key := range metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		name, ok := pdfInfoKeys[key]
+		if !ok {
+			name = key
+		}
+		buf.WriteString(" /" + pdfName(name) + " " + pdfString(metadata[key]))
+	}
+	buf.WriteString(" >>\nendobj\n")
+
+	// 只包含Info对象的交叉引用表
+	xrefOffset := buf.Len()
+	fmt.Fprintf(&buf, "xref\n%d 1\n%010d 00000 n \n", infoID, infoOffset)
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root %s %s R /Info %d 0 R /Prev %d >>\n",
+		infoID+1, root[1], root[2], infoID, prevXref)
+	fmt.Fprintf(&buf, "startxref\n%d\n%%%%EOF\n", xrefOffset)
+	return buf.Bytes(), nil
+}
+
+// pdfName 转义PDF名称对象中的特殊字符
+func pdfName(name string) string {
+	var b strings.Builder
+	for _, c := range []byte(name) {
+		if c <= ' ' || c >= 0x7F || strings.IndexByte("#()<>[]{}/%", c) >= 0 {
+			fmt.Fprintf(&b, "#%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// pdfString 生成PDF文本字符串，非ASCII文本使用带BOM的UTF-16BE十六进制字符串
+func pdfString(s string) string {
+	ascii := true
+	for _, r := range s {
+		if r >= 0x80 {
+			ascii = false
+			break
+		}
+	}
+	if ascii {
+		r := strings.NewReplacer(`\`, `\\`, `(`, `\(`, `)`, `\)`, "\r", `\r`, "\n", `\n`)
+		return "(" + r.Replace(s) + ")"
+	}
+
+	var b strings.Builder
+	b.WriteString("<FEFF")
+	for _, u := range utf16.Encode([]rune(s)) {
+		fmt.Fprintf(&b, "%04X", u)
+	}
+	b.WriteString(">")
+	return b.String()
+}
@@ -0,0 +1,57 @@
+package text2svg
+
+import (
+	"fmt"
+
+	"github.com/ibryang/go-utils/fontcache"
+	"github.com/tdewolff/canvas"
+)
+
+// parsePaint 解析颜色字符串，支持纯色、线性渐变、径向渐变和图片图案，格式无效时按十六进制纯色处理
+func parsePaint(s string) fontcache.Paint {
+	paint, err := fontcache.ParsePaint(s, nil)
+	if err != nil {
+		return fontcache.SolidPaint(canvas.Hex(s))
+	}
+	return paint
+}
+
+// validatePaints 检查所有颜色字段能否解析，图案图片无法加载或描边颜色为图案时返回错误
+func validatePaints(options *Options) error {
+	fills := append([]string{options.BackgroundColor}, options.Colors...)
+	strokes := []string{options.StrokeColor, options.BackgroundStroke}
+	for _, span := range options.Spans {
+		fills = append(fills, span.Color)
+		strokes = append(strokes, span.StrokeColor)
+	}
+	for _, extraText := range options.ExtraTexts {
+		fills = append(fills, extraText.Color)
+		strokes = append(strokes, extraText.StrokeColor)
+	}
+	for _, color := range fills {
+		if color == "" {
+			continue
+		}
+		if _, err := fontcache.ParsePaint(color, nil); err != nil {
+			return fmt.Errorf("颜色%q无效: %v", color, err)
+		}
+	}
+	return validateStrokes(strokes...)
+}
+
+// validateStrokes 检查描边颜色能否解析且不是图案
+func validateStrokes(colors ...string) error {
+	for _, color := range colors {
+		if color == "" {
+			continue
+		}
+		paint, err := fontcache.ParsePaint(color, nil)
+		if err == nil {
+			err = fontcache.CheckStroke(paint)
+		}
+		if err != nil {
+			return fmt.Errorf("描边颜色%q无效: %v", color, err)
+		}
+	}
+	return nil
+}
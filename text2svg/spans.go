@@ -0,0 +1,172 @@
+package text2svg
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ibryang/go-utils/fontcache"
+	"github.com/tdewolff/canvas"
+)
+
+// pathStyle 单条路径的填充和描边，描边宽度为0时只填充
+type pathStyle struct {
+	fill        string
+	strokeColor string
+	strokeWidth float64
+}
+
+// spansText 返回富文本各段文本的拼接
+func spansText(spans []TextSpan) string {
+	var sb strings.Builder
+	for _, span := range spans {
+		sb.WriteString(span.Text)
+	}
+	return sb.String()
+}
+
+// scaleSpans 自动适配字号时按主文本字号从from变为to的比例缩放各段的字号和基线偏移
+func scaleSpans(spans []TextSpan, from, to float64) []TextSpan {
+	if len(spans) == 0 || from <= 0 || from == to {
+		return spans
+	}
+	scaled := make([]TextSpan, len(spans))
+	for i, span := range spans {
+		span.FontSize *= to / from
+		span.BaselineShift *= to / from
+		scaled[i] = span
+	}
+	return scaled
+}
+
+// spanChain 加载一段富文本的字体链，返回该段使用的选项
+func spanChain(span TextSpan, options Options) (*fontChain, Options, error) {
+	spanOptions := options
+	spanOptions.Text = span.Text
+	spanOptions.Spans = nil
+	spanOptions.Direction = DirectionHorizontal
+	spanOptions.TextPath = nil
+	spanOptions.WrapWidth = 0
+	if span.FontSize > 0 {
+		spanOptions.FontSize = span.FontSize
+	}
+	if span.Weight > 0 {
+		spanOptions.Weight = span.Weight
+	}
+	spanOptions.Italic = options.Italic || span.Italic
+
+	src := fontcache.Source{Path: options.FontPath, Data: options.FontData, FS: options.FontFS}
+	if span.FontData != nil {
+		src = fontcache.Source{Data: span.FontData}
+	} else if span.FontPath != "" {
+		src = fontcache.Source{Path: span.FontPath, FS: options.FontFS}
+	}
+	font, err := loadFont(src, spanOptions)
+	if err != nil {
+		return nil, spanOptions, fmt.Errorf("加载字体失败: %v", err)
+	}
+	return newFontChain(font, spanOptions.FontSize, spanOptions), spanOptions, nil
+}
+
+// spanMissingGlyphs 返回富文本中所在段的字体都无法渲染的字符，位置按字符在Text中计数
+func spanMissingGlyphs(options Options) ([]MissingGlyph, error) {
+	var missing []MissingGlyph
+	index := 0
+	for _, span := range options.Spans {
+		chain, _, err := spanChain(span, options)
+		if err != nil {
+			return nil, err
+		}
+		for _, glyph := range fontcache.MissingGlyphs(span.Text, chain.fonts) {
+			glyph.Index += index
+			missing = append(missing, glyph)
+		}
+		index += utf8.RuneCountInString(span.Text)
+	}
+	return missing, nil
+}
+
+// layoutSpans 排版富文本，各段依次排列在同一基线上，BaselineShift将该段上移或下移
+// 整体字符串模式每段合并为一条路径，单字符模式每个字形簇一条路径，各路径使用所在段的颜色和描边
+func layoutSpans(options Options) (*textContent, error) {
+	var paths []*canvas.Path
+	var styles []pathStyle
+	var colorIndices []int
+	var x float64
+	index := 0 // 当前段第一个字符在Text中的位置
+	for i, span := range options.Spans {
+		chain, spanOptions, err := spanChain(span, options)
+		if err != nil {
+			return nil, err
+		}
+		spanOptions.CharOffsets = nil
+		if index < len(options.CharOffsets) {
+			spanOptions.CharOffsets = options.CharOffsets[index:]
+		}
+		clusters, err := chain.layout(span.Text, spanOptions)
+		if err != nil {
+			return nil, fmt.Errorf("转换文本到路径失败: %v", err)
+		}
+
+		colorIndex := i % len(options.Colors)
+		style := pathStyle{fill: span.Color}
+		if style.fill == "" {
+			style.fill = options.Colors[colorIndex]
+		} else if style.fill == "none" {
+			style.fill = "#00000000"
+		}
+		if options.EnableStroke {
+			style.strokeColor, style.strokeWidth = options.StrokeColor, options.StrokeWidth
+		}
+		if span.StrokeWidth > 0 {
+			style.strokeWidth = span.StrokeWidth
+			if style.strokeColor == "" {
+				style.strokeColor = "#000000"
+			}
+		}
+		if span.StrokeColor != "" {
+			style.strokeColor = span.StrokeColor
+		}
+
+		spanPath := &canvas.Path{}
+		for _, cluster := range clusters {
+			path := cluster.Path.Translate(x+cluster.X, span.BaselineShift)
+			if options.RenderMode == RenderModeString {
+				spanPath = spanPath.Append(path)
+			} else if !path.Empty() {
+				paths = append(paths, path)
+				styles = append(styles, style)
+				colorIndices = append(colorIndices, colorIndex)
+			}
+		}
+		if options.RenderMode == RenderModeString && !spanPath.Empty() {
+			paths = append(paths, spanPath)
+			styles = append(styles, style)
+			colorIndices = append(colorIndices, colorIndex)
+		}
+		x += lineWidth(clusters)
+		index += utf8.RuneCountInString(span.Text)
+	}
+
+	// 以第一个字形的左边缘为起点，路径已在所在位置，xOffsets为左边缘到起点的距离
+	content := &textContent{styles: styles, colorIndices: colorIndices}
+	startX, minY, maxY := math.Inf(1), math.Inf(1), math.Inf(-1)
+	for _, path := range paths {
+		pathBounds := path.Bounds()
+		content.bounds = append(content.bounds, pathBounds)
+		startX = math.Min(startX, pathBounds.X0)
+		minY = math.Min(minY, pathBounds.Y0)
+		maxY = math.Max(maxY, pathBounds.Y1)
+	}
+	if len(paths) == 0 {
+		return content, nil
+	}
+	content.paths = paths
+	for _, pathBounds := range content.bounds {
+		content.xOffsets = append(content.xOffsets, pathBounds.X0-startX)
+		content.width = math.Max(content.width, pathBounds.X1-startX)
+	}
+	content.minY, content.maxY = minY, maxY
+	return content, nil
+}
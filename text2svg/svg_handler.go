@@ -8,8 +8,8 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/ibryang/go-utils/fontcache"
 	"github.com/tdewolff/canvas"
-	"github.com/tdewolff/canvas/renderers"
 )
 
 // cleanSVG 清理SVG中的空路径
@@ -164,9 +164,24 @@ func createSVGRoundedRect(width, height, radius float64) string {
 
 // handleSVGSave 处理SVG格式保存的特殊逻辑
 func handleSVGSave(c *canvas.Canvas, options *Options, config SaveConfig) (canvas *canvas.Canvas, err error) {
+	svg, err := renderSVG(c, options)
+	if err != nil {
+		return nil, err
+	}
+
+	// 保存修改后的SVG
+	if err := SaveToFile(svg, config.Path); err != nil {
+		return nil, fmt.Errorf("保存SVG文件失败: %v", err)
+	}
+
+	return c, nil
+}
+
+// renderSVG 在内存中渲染SVG，并清理空路径、替换圆角背景矩形
+func renderSVG(c *canvas.Canvas, options *Options) (string, error) {
 	var buf bytes.Buffer
-	if err := c.Write(&buf, renderers.SVG()); err != nil {
-		return nil, fmt.Errorf("渲染SVG失败: %v", err)
+	if err := c.Write(&buf, fontcache.SVG()); err != nil {
+		return "", fmt.Errorf("渲染SVG失败: %v", err)
 	}
 
 	svg := buf.String()
@@ -174,8 +189,9 @@ func handleSVGSave(c *canvas.Canvas, options *Options, config SaveConfig) (canva
 	// 清理SVG内的空路径
 	svg = cleanSVG(svg)
 
-	// 如果启用了背景和圆角，替换圆角矩形路径
-	if options.EnableBackground && options.BorderRadius > 0 {
+	// 如果启用了背景和圆角，替换圆角矩形路径；渐变和图案背景保留渲染结果
+	if options.EnableBackground && options.BorderRadius > 0 &&
+		parsePaint(options.BackgroundColor).Kind == fontcache.PaintSolid && parsePaint(options.BackgroundStroke).Kind == fontcache.PaintSolid {
 		// 获取画布尺寸
 		finalWidth, finalHeight := c.Size()
 
@@ -219,10 +235,5 @@ func handleSVGSave(c *canvas.Canvas, options *Options, config SaveConfig) (canva
 		}
 	}
 
-	// 保存修改后的SVG
-	if err := SaveToFile(svg, config.Path); err != nil {
-		return nil, fmt.Errorf("保存SVG文件失败: %v", err)
-	}
-
-	return c, nil
+	return addSVGMetadata(svg, options.Metadata), nil
 }
@@ -1,7 +1,11 @@
 package text2svg
 
 import (
+	"bytes"
+	"encoding/base64"
 	"fmt"
+	"io"
+	"io/fs"
 	"strings"
 
 	"github.com/ibryang/go-utils/os/file"
@@ -18,6 +22,16 @@ const (
 	RenderModeString
 )
 
+// TextDirection 定义文本排列方向
+type TextDirection int
+
+const (
+	// DirectionHorizontal 横排，字符从左到右
+	DirectionHorizontal TextDirection = iota
+	// DirectionVertical 竖排，字符从上到下；多行时各列从右到左排列
+	DirectionVertical
+)
+
 // Options 定义文本转SVG的配置选项
 //
 // Width和Height与LockWidth和LockHeight的区别：
@@ -36,33 +50,66 @@ const (
 //   - 需要输出精确尺寸的图像：使用LockWidth/LockHeight
 //   - 需要在固定尺寸下自动居中内容：使用LockWidth/LockHeight
 type Options struct {
-	Text                  string          // 要转换的文本内容
-	FontPath              string          // 字体文件路径或字体名称
-	FontSize              float64         // 字体大小
-	IsBase64              bool            // 是否输出base64编码的SVG
-	Width                 float64         // 目标宽度，可选
-	Height                float64         // 目标高度，可选
-	Colors                []string        // 颜色列表
-	SavePath              string          // 保存路径
-	Format                string          // 保存格式
-	DPI                   float64         // 保存DPI
-	DPMM                  float64         // 保存DPMM
-	Quality               int             // 保存质量
-	EnableStroke          bool            // 是否启用描边
-	StrokeWidth           float64         // 描边宽度
-	StrokeColor           string          // 描边颜色
-	EnableBackground      bool            // 是否启用背景矩形
-	BackgroundColor       string          // 背景颜色
-	BackgroundStroke      string          // 背景描边颜色
-	BackgroundStrokeWidth float64         // 背景描边宽度
-	BorderRadius          float64         // 背景矩形圆角半径
-	Padding               []float64       // 内边距：[上, 右, 下, 左]，支持1-4个值，类似CSS padding
-	LockWidth             float64         // 锁定最终宽度（如果设置，将动态调整水平内边距）
-	LockHeight            float64         // 锁定最终高度（如果设置，将动态调整垂直内边距）
-	ExtraTexts            []ExtraTextInfo // 额外的文本信息列表
-	RenderMode            RenderMode      // 渲染模式
-	MirrorX               bool            // X轴镜像
-	MirrorY               bool            // Y轴镜像
+	Text                  string            // 要转换的文本内容
+	Spans                 []TextSpan        // 富文本，各段使用各自的字体、字号、颜色和描边，设置后Text为各段文本的拼接
+	FontPath              string            // 字体文件路径或字体名称，设置FontFS时为FontFS中的路径
+	FontData              []byte            // 字体文件内容，设置后优先于FontPath
+	FontFS                fs.FS             // 读取FontPath的文件系统，例如embed.FS
+	FallbackFonts         []string          // 回退字体路径或名称，主字体缺少字形时按顺序使用
+	Strict                bool              // 严格模式，存在主字体和回退字体都无法渲染的字符时返回MissingGlyphError
+	FontSize              float64           // 字体大小
+	Weight                int               // 字重（100-900），0表示不指定；字体缺少对应字重时使用伪粗体
+	Italic                bool              // 斜体，字体缺少斜体时使用伪斜体
+	Variations            FontVariations    // 可变字体轴设置，例如{"wght": 700}，设置wght轴时不再使用伪粗体
+	OpenTypeFeatures      FontFeatures      // OpenType特性，例如{"liga": 0, "kern": 1, "smcp": 1, "tnum": 1, "ss01": 1}
+	IsBase64              bool              // 是否输出base64编码的data URL（仅Render/RenderTo生效）
+	Width                 float64           // 目标宽度，可选
+	Height                float64           // 目标高度，可选
+	Colors                []string          // 颜色列表，每个颜色也可以是渐变或图案，例如"linear-gradient(90deg, #FF0000, #0000FF)"、"url(wood.png)"
+	PaintPerChar          bool              // 单字符模式下渐变和图案按每个字符的边界框定位，默认按整段文本定位
+	SavePath              string            // 保存路径
+	Format                string            // 保存格式
+	DPI                   float64           // 保存DPI
+	DPMM                  float64           // 保存DPMM
+	Quality               int               // 保存质量
+	ICCProfile            []byte            // 嵌入的ICC色彩配置文件（PNG/JPEG/TIFF），只作为标记写入文件，不参与颜色转换，色彩空间需与ColorMode一致
+	ColorMode             ColorMode         // 颜色模式，默认RGB，CMYK仅支持JPEG/TIFF，按简单公式从RGB转换
+	Metadata              map[string]string // 写入输出文件的元数据，例如订单号、原文和字体
+	EnableStroke          bool              // 是否启用描边
+	StrokeWidth           float64           // 描边宽度
+	StrokeColor           string            // 描边颜色，支持渐变，不支持图案
+	EnableBackground      bool              // 是否启用背景矩形
+	BackgroundColor       string            // 背景颜色
+	BackgroundStroke      string            // 背景描边颜色，支持渐变，不支持图案
+	BackgroundStrokeWidth float64           // 背景描边宽度
+	BorderRadius          float64           // 背景矩形圆角半径
+	Padding               []float64         // 内边距：[上, 右, 下, 左]，支持1-4个值，类似CSS padding
+	LockWidth             float64           // 锁定最终宽度（如果设置，将动态调整水平内边距）
+	LockHeight            float64           // 锁定最终高度（如果设置，将动态调整垂直内边距）
+	AutoFit               bool              // 自动适配字号，查找能放入LockWidth/LockHeight（减去Padding）的最大字号，不拉伸变形
+	MinFontSize           float64           // 自动适配的最小字号，最小字号也放不下时使用该字号
+	MaxFontSize           float64           // 自动适配的最大字号，0表示不超过FontSize
+	ExtraTexts            []ExtraTextInfo   // 额外的文本信息列表
+	RenderMode            RenderMode        // 渲染模式
+	Direction             TextDirection     // 排列方向，默认横排
+	VerticalUpright       bool              // 竖排时拉丁字母等逐字直立，默认整段旋转90度
+	TateChuYoko           int               // 竖排时连续数字不超过该个数时横排在一格中（纵中横），0为2个，小于0不启用
+	LetterSpacing         float64           // 字符间距，每个字符后增加的距离，可以为负
+	WordSpacing           float64           // 单词间距，空格后在字符间距之外额外增加的距离，可以为负
+	CharOffsets           []CharOffset      // 逐字符的偏移和旋转，按字符在Text中的位置（包含空格）对应
+	TextPath              *TextPath         // 沿SVG路径或圆弧排列文字，每个字形按切线方向旋转，设置后忽略Direction
+	WrapWidth             float64           // 自动换行的最大行宽，0表示只在换行符处换行；竖排和沿路径排列时不换行
+	MaxLines              int               // 最大行数，0表示不限制
+	Ellipsis              string            // 超出MaxLines时添加在最后一行末尾的省略号，例如"…"
+	LineSpacing           float64           // 多行时在字体行高之外额外增加的行间距
+	Alignment             AlignmentMode     // 多行时各行的对齐方式
+	MirrorX               bool              // X轴镜像
+	MirrorY               bool              // Y轴镜像
+
+	// OnMissingGlyphs 非严格模式下，存在主字体和回退字体都无法渲染的字符时回调，参数为这些字符及其位置
+	OnMissingGlyphs func(glyphs []MissingGlyph)
+	// OnFontSize 自动适配字号时回调最终使用的字号
+	OnFontSize func(fontSize float64)
 }
 
 // SaveFormat 定义保存格式
@@ -78,13 +125,25 @@ const (
 	FormatTIF  SaveFormat = "tif"
 )
 
+// ColorMode 定义位图的颜色模式
+type ColorMode string
+
+const (
+	ColorModeRGB  ColorMode = "rgb"
+	ColorModeCMYK ColorMode = "cmyk" // 印刷用CMYK，颜色按设备无关的简单公式从RGB转换，不经过ICC配置文件
+)
+
 // SaveConfig 保存配置
 type SaveConfig struct {
-	Format  SaveFormat
-	Path    string
-	DPI     float64
-	DPMM    float64
-	Quality int
+	Format     SaveFormat
+	Path       string
+	DPI        float64
+	DPMM       float64
+	Quality    int
+	ICCProfile []byte    // ICC色彩配置文件，PNG写入iCCP，JPEG写入APP2，TIFF写入标签34675，只作为标记，不参与颜色转换，色彩空间需与ColorMode一致
+	ColorMode  ColorMode // 颜色模式，为空时使用RGB
+	// Metadata 元数据，PNG写入tEXt/iTXt，JPEG写入XMP/COM，TIFF写入XMP/ImageDescription，SVG写入<title>/<metadata>，PDF写入Info字典
+	Metadata map[string]string
 }
 
 // ExtraTextInfo 定义额外的文本信息
@@ -95,7 +154,7 @@ type SaveConfig struct {
 // - OffsetX和OffsetY可用于微调位置
 type ExtraTextInfo struct {
 	Text        string  // 文本内容
-	FontPath    string  // 字体路径，如果为空则使用主文本的字体
+	FontPath    string  // 字体路径，如果为空则使用主文本的字体；主文本设置了FontFS时从FontFS中读取
 	FontSize    float64 // 字体大小，如果为0则使用主文本的字体大小
 	Color       string  // 文本颜色，如果为空则使用黑色
 	X           float64 // X坐标（左侧为原点）
@@ -104,11 +163,26 @@ type ExtraTextInfo struct {
 	Opacity     float64 // 透明度（0-1）
 	StrokeText  bool    // 是否启用文本描边
 	StrokeWidth float64 // 描边宽度
-	StrokeColor string  // 描边颜色
+	StrokeColor string  // 描边颜色，不支持图案
 	OffsetX     float64 // X方向额外偏移
 	OffsetY     float64 // Y方向额外偏移
 }
 
+// TextSpan 富文本中的一段文本，各段依次排列在同一基线上，未设置的字段沿用Options中的设置
+// 富文本只支持单行横排，各段不换行、不竖排，也不沿路径排列
+type TextSpan struct {
+	Text          string  // 文本内容
+	FontPath      string  // 字体路径或名称，为空时使用主文本的字体；主文本设置了FontFS时从FontFS中读取
+	FontData      []byte  // 字体文件内容，设置后优先于FontPath
+	FontSize      float64 // 字体大小，为0时使用主文本的字体大小
+	Weight        int     // 字重（100-900），为0时使用主文本的字重
+	Italic        bool    // 斜体，主文本为斜体时该段也为斜体
+	Color         string  // 填充颜色，为空时按段的顺序使用Colors中的颜色
+	StrokeColor   string  // 描边颜色，为空时使用主文本的描边颜色，不支持图案
+	StrokeWidth   float64 // 描边宽度，为0时使用主文本的描边设置
+	BaselineShift float64 // 基线偏移，向上为正，用于上标和下标
+}
+
 // CanvasConvert 转换并保存文件
 func CanvasConvert(options Options) (canvas *canvas.Canvas, err error) {
 	// 参数验证
@@ -126,19 +200,8 @@ func CanvasConvert(options Options) (canvas *canvas.Canvas, err error) {
 		return nil, fmt.Errorf("保存路径不能为空")
 	}
 
-	// 如果未指定格式，从文件扩展名获取
-	if options.Format == "" {
-		options.Format = strings.ToLower(file.ExtName(options.SavePath))
-	}
-
 	// 创建保存配置
-	config := SaveConfig{
-		Format:  SaveFormat(options.Format),
-		Path:    options.SavePath,
-		DPI:     options.DPI,
-		DPMM:    options.DPMM,
-		Quality: options.Quality,
-	}
+	config := newSaveConfig(options)
 
 	// 如果是SVG格式，进行特殊处理
 	if config.Format == FormatSVG {
@@ -148,6 +211,76 @@ func CanvasConvert(options Options) (canvas *canvas.Canvas, err error) {
 	return saveToFile(c, config)
 }
 
+// Render 在内存中转换文本，返回渲染后的文件内容
+// 格式由Format决定，未设置时取SavePath的扩展名，两者都为空时输出SVG。
+// 如果IsBase64为true，返回base64编码的data URL。
+func Render(options Options) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := RenderTo(&buf, options); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// RenderTo 在内存中转换文本，并将渲染结果写入w
+func RenderTo(w io.Writer, options Options) error {
+	// 参数验证
+	if err := validateOptions(&options); err != nil {
+		return err
+	}
+
+	// 生成画布
+	c, err := GenerateCanvas(options)
+	if err != nil {
+		return err
+	}
+
+	config := newSaveConfig(options)
+	if config.Format == "" {
+		config.Format = FormatSVG
+	}
+
+	var data []byte
+	if config.Format == FormatSVG {
+		svg, err := renderSVG(c, &options)
+		if err != nil {
+			return err
+		}
+		data = []byte(svg)
+	} else {
+		data, err = renderCanvas(c, config)
+		if err != nil {
+			return err
+		}
+	}
+
+	if options.IsBase64 {
+		data = []byte("data:" + mimeType(config.Format) + ";base64," + base64.StdEncoding.EncodeToString(data))
+	}
+
+	_, err = w.Write(data)
+	return err
+}
+
+// newSaveConfig 根据选项创建保存配置
+func newSaveConfig(options Options) SaveConfig {
+	// 如果未指定格式，从文件扩展名获取
+	if options.Format == "" && options.SavePath != "" {
+		options.Format = strings.ToLower(file.ExtName(options.SavePath))
+	}
+
+	return SaveConfig{
+		Format:     SaveFormat(strings.ToLower(options.Format)),
+		Path:       options.SavePath,
+		DPI:        options.DPI,
+		DPMM:       options.DPMM,
+		Quality:    options.Quality,
+		ICCProfile: options.ICCProfile,
+		ColorMode:  ColorMode(strings.ToLower(string(options.ColorMode))),
+		Metadata:   options.Metadata,
+	}
+}
+
 // GenerateCanvas 将文本转换为画布 - 为兼容旧版API而保留
 func GenerateCanvas(options Options) (*canvas.Canvas, error) {
 	// 参数验证和默认值设置
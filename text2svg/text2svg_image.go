@@ -13,8 +13,8 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/ibryang/go-utils/fontcache"
 	"github.com/tdewolff/canvas"
-	"github.com/tdewolff/canvas/renderers"
 )
 
 // ImageElement 定义图片元素
@@ -32,16 +32,17 @@ type ImageElement struct {
 
 // MultiElement 多元素配置结构
 type MultiElement struct {
-	CanvasWidth     float64        // 画布宽度
-	CanvasHeight    float64        // 画布高度
-	BackgroundColor string         // 背景颜色
-	Images          []ImageElement // 图片元素列表
-	SVGs            []ImageElement // SVG元素列表（复用ImageElement结构）
-	TextOptions     []Options      // 文本元素列表（复用现有Options结构）
-	SavePath        string         // 保存路径
-	SaveFormat      string         // 保存格式
-	DPI             float64        // 导出DPI
-	Quality         int            // 导出质量（JPEG等格式使用）
+	CanvasWidth     float64           // 画布宽度
+	CanvasHeight    float64           // 画布高度
+	BackgroundColor string            // 背景颜色
+	Images          []ImageElement    // 图片元素列表
+	SVGs            []ImageElement    // SVG元素列表（复用ImageElement结构）
+	TextOptions     []Options         // 文本元素列表（复用现有Options结构）
+	SavePath        string            // 保存路径
+	SaveFormat      string            // 保存格式
+	DPI             float64           // 导出DPI
+	Quality         int               // 导出质量（JPEG等格式使用）
+	Metadata        map[string]string // 写入输出文件的元数据
 }
 
 // RenderMultiElement 渲染多元素画布
@@ -58,10 +59,11 @@ func RenderMultiElement(config MultiElement) (*canvas.Canvas, error) {
 
 	// 绘制背景
 	if config.BackgroundColor != "" && config.BackgroundColor != "none" {
-		// 使用hex函数解析颜色
-		bgColor := canvas.Hex(config.BackgroundColor)
-		ctx.SetFillColor(bgColor)
-		ctx.DrawPath(0, 0, canvas.Rectangle(config.CanvasWidth, config.CanvasHeight))
+		// 支持纯色、渐变和图案，按y轴向上的坐标绘制，使渐变方向与其他输出一致
+		ctx.SetCoordSystem(canvas.CartesianI)
+		bgPath := canvas.Rectangle(config.CanvasWidth, config.CanvasHeight)
+		fontcache.DrawPath(ctx, bgPath, bgPath.Bounds(), parsePaint(config.BackgroundColor), fontcache.Paint{}, 0)
+		ctx.SetCoordSystem(canvas.CartesianIV)
 	}
 
 	// 先绘制图片
@@ -113,10 +115,11 @@ func RenderMultiElement(config MultiElement) (*canvas.Canvas, error) {
 	// 保存
 	if config.SavePath != "" {
 		saveConfig := SaveConfig{
-			Format:  SaveFormat(config.SaveFormat),
-			Path:    config.SavePath,
-			DPI:     config.DPI,
-			Quality: config.Quality,
+			Format:   SaveFormat(config.SaveFormat),
+			Path:     config.SavePath,
+			DPI:      config.DPI,
+			Quality:  config.Quality,
+			Metadata: config.Metadata,
 		}
 
 		if _, err := saveToFile(c, saveConfig); err != nil {
@@ -328,7 +331,7 @@ func CreateMultiElementSVG(config MultiElement) (string, error) {
 	}
 
 	var buf bytes.Buffer
-	if err := c.Write(&buf, renderers.SVG()); err != nil {
+	if err := c.Write(&buf, fontcache.SVG()); err != nil {
 		return "", fmt.Errorf("渲染SVG失败: %v", err)
 	}
 
@@ -5,6 +5,7 @@ import (
 	"math"
 	"os"
 
+	"github.com/ibryang/go-utils/fontcache"
 	"github.com/ibryang/go-utils/os/file"
 	"github.com/tdewolff/canvas"
 )
@@ -30,7 +31,7 @@ type MultiLineOptions struct {
 	Padding         []float64       // 内边距 [上, 右, 下, 左]
 	MarginPadding   bool            // 是否启用外边距
 	EnableBorder    bool            // 是否启用边框
-	BorderColor     string          // 边框颜色
+	BorderColor     string          // 边框颜色，不支持图案
 	BorderWidth     float64         // 边框宽度
 	BorderRadius    float64         // 边框圆角半径
 	BackgroundColor string          // 背景颜色
@@ -41,6 +42,7 @@ type MultiLineOptions struct {
 	MirrorX         bool            // X轴镜像
 	MirrorY         bool            // Y轴镜像
 	ExtraTexts      []ExtraTextInfo // 额外的文本信息列表
+	Direction       TextDirection   // 排列方向，竖排时每个文件为一列，从右到左排列，LineSpacing为列间距
 }
 
 // CanvasConvertMultipeLine 处理多行文本
@@ -48,6 +50,12 @@ type MultiLineOptions struct {
 // options: 多行文本配置
 // baseOptions: 基础配置选项(用于每个单独文本的样式设置)
 func CanvasConvertMultipeLine(files []string, options *MultiLineOptions) (c *canvas.Canvas, err error) {
+	if options != nil && options.EnableBorder {
+		if err := validateStrokes(options.BorderColor); err != nil {
+			return nil, err
+		}
+	}
+
 	// 加载SVG文件
 	var canvases []*canvas.Canvas
 	var widths []float64
@@ -104,6 +112,19 @@ func CanvasConvertMultipeLine(files []string, options *MultiLineOptions) (c *can
 		}
 	}
 
+	// 竖排时每个文件为一列，对齐方式作用于列的竖直方向：左对齐为顶端对齐，右对齐为底端对齐
+	vertical := options != nil && options.Direction == DirectionVertical
+	if vertical {
+		maxWidth, totalHeight = 0.0, 0.0
+		for i, w := range widths {
+			maxWidth += w
+			if i < len(widths)-1 {
+				maxWidth += lineSpacing
+			}
+			totalHeight = math.Max(totalHeight, heights[i])
+		}
+	}
+
 	contentWidth := maxWidth
 	contentHeight := totalHeight
 
@@ -114,48 +135,65 @@ func CanvasConvertMultipeLine(files []string, options *MultiLineOptions) (c *can
 	// 创建最终画布
 	finalCanvas := canvas.New(finalWidth, finalHeight)
 
-	// 绘制每一行文本
-	yPos := 0.0 // 初始Y位置（从上边距开始）
-
-	// 将canvases数组翻转顺序，以便文本从上到下显示
-	reversedCanvases := make([]*canvas.Canvas, len(canvases))
-	reversedWidths := make([]float64, len(widths))
-	reversedHeights := make([]float64, len(heights))
-
-	for i := 0; i < len(canvases); i++ {
-		reversedCanvases[i] = canvases[len(canvases)-1-i]
-		reversedWidths[i] = widths[len(widths)-1-i]
-		reversedHeights[i] = heights[len(heights)-1-i]
-	}
-
-	for i, c := range reversedCanvases {
-		// 根据对齐方式计算X位置
-		var xPos float64
-
-		if options != nil {
+	if vertical {
+		// 第一列位于最右侧
+		xPos := contentWidth
+		for i, c := range canvases {
+			xPos -= widths[i]
+			yPos := contentHeight - heights[i] // 默认顶端对齐
 			switch options.Alignment {
 			case AlignCenter:
-				// 居中对齐
-				xPos = (contentWidth - reversedWidths[i]) / 2
+				yPos = (contentHeight - heights[i]) / 2
 			case AlignRight:
-				// 右对齐
-				xPos = contentWidth - reversedWidths[i]
-			default:
+				yPos = 0
+			}
+			c.RenderViewTo(finalCanvas, canvas.Identity.Translate(xPos, yPos))
+			xPos -= lineSpacing
+		}
+	} else {
+		// 绘制每一行文本
+		yPos := 0.0 // 初始Y位置（从上边距开始）
+
+		// 将canvases数组翻转顺序，以便文本从上到下显示
+		reversedCanvases := make([]*canvas.Canvas, len(canvases))
+		reversedWidths := make([]float64, len(widths))
+		reversedHeights := make([]float64, len(heights))
+
+		for i := 0; i < len(canvases); i++ {
+			reversedCanvases[i] = canvases[len(canvases)-1-i]
+			reversedWidths[i] = widths[len(widths)-1-i]
+			reversedHeights[i] = heights[len(heights)-1-i]
+		}
+
+		for i, c := range reversedCanvases {
+			// 根据对齐方式计算X位置
+			var xPos float64
+
+			if options != nil {
+				switch options.Alignment {
+				case AlignCenter:
+					// 居中对齐
+					xPos = (contentWidth - reversedWidths[i]) / 2
+				case AlignRight:
+					// 右对齐
+					xPos = contentWidth - reversedWidths[i]
+				default:
+					// 默认左对齐
+					xPos = 0.0
+				}
+			} else {
 				// 默认左对齐
 				xPos = 0.0
 			}
-		} else {
-			// 默认左对齐
-			xPos = 0.0
-		}
 
-		// 在最终画布上绘制当前行
-		// 使用变换矩阵定位当前Canvas的内容到最终Canvas上的正确位置
-		transformMatrix := canvas.Identity.Translate(xPos, yPos)
-		c.RenderViewTo(finalCanvas, transformMatrix)
+			// 在最终画布上绘制当前行
+			// 使用变换矩阵定位当前Canvas的内容到最终Canvas上的正确位置
+			transformMatrix := canvas.Identity.Translate(xPos, yPos)
+			c.RenderViewTo(finalCanvas, transformMatrix)
 
-		// 更新Y位置，为下一行做准备
-		yPos += reversedHeights[i] + lineSpacing
+			// 更新Y位置，为下一行做准备
+			yPos += reversedHeights[i] + lineSpacing
+		}
 	}
 
 	var newWidth float64
@@ -285,11 +323,10 @@ func CanvasConvertMultipeLine(files []string, options *MultiLineOptions) (c *can
 	if options != nil && options.EnableBorder {
 		// 创建背景上下文
 		bgCtx := canvas.NewContext(newCanvas)
+		fill := fontcache.SolidPaint(canvas.RGBA(255, 255, 255, 0))
 		if options.BackgroundColor != "" {
-			// 设置填充颜色
-			bgCtx.SetFillColor(canvas.Hex(options.BackgroundColor))
-		} else {
-			bgCtx.SetFillColor(canvas.RGBA(255, 255, 255, 0))
+			// 设置填充颜色，支持渐变和图案
+			fill = parsePaint(options.BackgroundColor)
 		}
 
 		// 绘制矩形路径
@@ -333,15 +370,11 @@ func CanvasConvertMultipeLine(files []string, options *MultiLineOptions) (c *can
 		}
 
 		// 如果有边框，设置描边属性
+		var strokeWidth float64
 		if options.EnableBorder && options.BorderColor != "" && options.BorderWidth > 0 {
-			bgCtx.SetStrokeColor(canvas.Hex(options.BorderColor))
-			bgCtx.SetStrokeWidth(options.BorderWidth)
-			bgCtx.DrawPath(0, 0, bgPath)
-			bgCtx.FillStroke()
-		} else {
-			bgCtx.DrawPath(0, 0, bgPath)
-			bgCtx.Fill()
+			strokeWidth = options.BorderWidth
 		}
+		fontcache.DrawPath(bgCtx, bgPath, bgPath.Bounds(), fill, parsePaint(options.BorderColor), strokeWidth)
 	}
 	finalCanvas.RenderViewTo(newCanvas, canvas.Matrix{
 		{scale, 0, offsetX},
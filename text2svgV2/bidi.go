@@ -0,0 +1,26 @@
+package text2svgV2
+
+import "github.com/ibryang/go-utils/fontcache"
+
+// bidiRun 嵌入层级相同的一段连续文本
+type bidiRun struct {
+	text  string // 文本，按逻辑顺序
+	start int    // 第一个字符在原文本中的位置，按字符计数
+	level int    // 嵌入层级，奇数为从右到左
+}
+
+// rtl 判断该段文本是否从右到左排列
+func (r bidiRun) rtl() bool {
+	return r.level%2 == 1
+}
+
+// visualRuns 按Unicode双向算法（UAX #9）计算每个字符的嵌入层级，
+// 返回按视觉顺序（从左到右）排列的文本段，每个段落的方向由第一个强方向字符决定
+func visualRuns(s string) []bidiRun {
+	runes := []rune(s)
+	var runs []bidiRun
+	for _, run := range fontcache.BidiRuns(s) {
+		runs = append(runs, bidiRun{text: string(runes[run.Start:run.End]), start: run.Start, level: run.Level})
+	}
+	return runs
+}
@@ -2,6 +2,7 @@ package text2svgV2
 
 import (
 	"image/color"
+	"io/fs"
 
 	"github.com/tdewolff/canvas"
 )
@@ -13,6 +14,14 @@ const (
 	RenderChar   RenderMode = 2
 )
 
+// Direction 定义文本排列方向
+type Direction int
+
+const (
+	DirectionHorizontal Direction = iota // 横排，字符从左到右
+	DirectionVertical                    // 竖排，字符从上到下；多行时各列从右到左排列
+)
+
 // BaseOption 定义了画布的基本选项
 type BaseOption struct {
 	MinSize   bool    // 获取宽高最小比例
@@ -27,17 +36,61 @@ type BaseOption struct {
 // TextOption 定义了文本绘制选项
 type TextOption struct {
 	Text         string      // 文本内容
-	FontPath     string      // 字体路径
+	FontPath     string      // 字体路径，设置FontFS时为FontFS中的路径
+	FontData     []byte      // 字体文件内容，设置后优先于FontPath
+	FontFS       fs.FS       // 读取FontPath的文件系统，例如embed.FS
 	FontPathList []string    // 文字路径列表
+	Strict       bool        // 严格模式，存在所有字体都无法渲染的字符时返回MissingGlyphError
 	FontSize     float64     // 字体大小
-	FontColor    any         // 字体颜色
-	StrokeColor  any         // 描边颜色
+	Weight       int         // 字重（100-900），0表示不指定；字体缺少对应字重时使用伪粗体
+	Italic       bool        // 斜体，字体缺少斜体时使用伪斜体
+	FontColor    any         // 字体颜色，string、[]string、Paint或[]Paint，字符串也可以是渐变或图案，见ParsePaint
+	StrokeColor  any         // 描边颜色，string或Paint，支持渐变，不支持图案
 	StrokeWidth  float64     // 描边宽度
 	BaseOption               // 嵌入基本选项
 	RectOption   *RectOption // 矩形选项（可选）
 	// 额外的文本
 	ExtraText  []ExtraTextOption // 额外的文本
 	RenderMode RenderMode        // 渲染模式
+	Direction  Direction         // 排列方向，默认横排
+
+	// Variations 可变字体轴设置，例如{"wght": 700}，设置wght轴时不再使用伪粗体
+	Variations FontVariations
+	// OpenTypeFeatures OpenType特性，例如{"liga": 0, "kern": 1, "smcp": 1, "tnum": 1, "ss01": 1}
+	OpenTypeFeatures FontFeatures
+	// LetterSpacing 字符间距，每个字符后增加的距离，可以为负
+	LetterSpacing float64
+	// WordSpacing 单词间距，空格后在字符间距之外额外增加的距离，可以为负
+	WordSpacing float64
+	// CharOffsets 逐字符的偏移和旋转，按字符在Text中的位置（包含空格）对应
+	CharOffsets []CharOffset
+	// TextPath 沿SVG路径或圆弧排列文字，每个字形按切线方向旋转，设置后忽略Direction
+	TextPath *TextPath
+	// VerticalUpright 竖排时拉丁字母等逐字直立，默认整段旋转90度
+	VerticalUpright bool
+	// TateChuYoko 竖排时连续数字不超过该个数时横排在一格中（纵中横），0为2个，小于0不启用
+	TateChuYoko int
+	// PaintPerChar 单字符模式下渐变和图案按每个字符的边界框定位，默认按整段文本定位
+	PaintPerChar bool
+	// Spans 富文本，各段使用各自的字体、字号、颜色和描边，设置后Text为各段文本的拼接，按单字符模式绘制
+	Spans []TextSpan
+	// OnMissingGlyphs 非严格模式下，存在所有字体都无法渲染的字符时回调，参数为这些字符及其位置
+	OnMissingGlyphs func(glyphs []MissingGlyph)
+}
+
+// TextSpan 定义了富文本中的一段文本，各段依次排列在同一基线上，未设置的字段沿用TextOption中的设置
+// 富文本只支持单行横排
+type TextSpan struct {
+	Text          string  // 文本内容
+	FontPath      string  // 字体路径，为空时使用TextOption的字体
+	FontData      []byte  // 字体文件内容，设置后优先于FontPath
+	FontSize      float64 // 字体大小，为0时使用TextOption的字体大小
+	Weight        int     // 字重（100-900），为0时使用TextOption的字重
+	Italic        bool    // 斜体，TextOption为斜体时该段也为斜体
+	FontColor     string  // 字体颜色，支持渐变和图案，为空时按段的顺序使用TextOption的字体颜色
+	StrokeColor   string  // 描边颜色，为空时使用TextOption的描边颜色，不支持图案
+	StrokeWidth   float64 // 描边宽度，为0时使用TextOption的描边宽度
+	BaselineShift float64 // 基线偏移，向上为正，用于上标和下标
 }
 
 // TextLineOption 定义了文本行选项
@@ -47,6 +100,10 @@ type TextLineOption struct {
 	LineGap    float64           // 行间距
 	Align      TextAlign         // 对齐方式
 	VAlign     TextAlign         // 垂直对齐方式
+	Direction  Direction         // 排列方向，竖排时每个文本为一列，从右到左排列，LineGap为列间距，VAlign为列的对齐方式
+	WrapWidth  float64           // 自动换行的最大行宽，0表示只在换行符处换行；竖排时不按宽度换行，换行符处另起一列
+	MaxLines   int               // 每个文本换行后的最大行数，0表示不限制
+	Ellipsis   string            // 超出MaxLines时添加在最后一行末尾的省略号，例如"…"
 	BaseOption                   // 嵌入基本选项
 	RectOption []RectOption      // 矩形选项列表（可选）
 	ExtraText  []ExtraTextOption // 额外的文本
@@ -69,9 +126,9 @@ type RectOption struct {
 	X           float64 // X坐标
 	Y           float64 // Y坐标
 	Radius      float64 // 圆角半径
-	BgColor     string  // 背景颜色
+	BgColor     string  // 背景颜色，支持渐变和图案，见ParsePaint
 	BgFile      string  // 背景文件
-	StrokeColor string  // 描边颜色
+	StrokeColor string  // 描边颜色，支持渐变，不支持图案
 	StrokeWidth float64 // 描边宽度
 }
 
@@ -2,28 +2,54 @@ package text2svgV2
 
 import (
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
 	"runtime"
 
-	"github.com/ibryang/go-utils/os/file"
+	"github.com/ibryang/go-utils/fontcache"
 	"github.com/tdewolff/canvas"
 )
 
+type (
+	// MissingGlyph 所有字体都无法渲染的字符及其位置
+	MissingGlyph = fontcache.MissingGlyph
+	// MissingGlyphError 严格模式下文本包含无法渲染的字符时返回的错误
+	MissingGlyphError = fontcache.MissingGlyphError
+	// FontVariations 可变字体轴设置，例如{"wght": 700, "wdth": 75}
+	FontVariations = fontcache.Variations
+	// FontFeatures OpenType特性设置，例如{"liga": 0, "smcp": 1, "tnum": 1}
+	FontFeatures = fontcache.Features
+	// CharOffset 单个字符的额外偏移和旋转
+	CharOffset = fontcache.CharOffset
+	// TextPath 文字排列的路径，SVG路径或圆弧
+	TextPath = fontcache.TextPath
+	// PathAlign 文字沿路径的对齐方式
+	PathAlign = fontcache.PathAlign
+	// Paint 颜料：纯色、线性渐变、径向渐变或图片图案
+	Paint = fontcache.Paint
+	// PaintKind 颜料类型
+	PaintKind = fontcache.PaintKind
+	// ColorStop 渐变的颜色节点
+	ColorStop = fontcache.ColorStop
+)
+
+const (
+	PathAlignStart  = fontcache.PathAlignStart  // 从路径起点开始排列
+	PathAlignCenter = fontcache.PathAlignCenter // 居中于路径中点
+	PathAlignEnd    = fontcache.PathAlignEnd    // 结束于路径终点
+
+	PaintSolid   = fontcache.PaintSolid   // 纯色
+	PaintLinear  = fontcache.PaintLinear  // 线性渐变
+	PaintRadial  = fontcache.PaintRadial  // 径向渐变
+	PaintPattern = fontcache.PaintPattern // 图片图案
+)
+
+// LoadFont 加载字体，path为空时加载系统默认字体，文件不存在时按字体名称查找系统字体
+// 加载结果缓存在fontcache.Default中
 func LoadFont(path string) (*canvas.Font, error) {
 	if path == "" {
-		// 加载系统默认字体
-		if runtime.GOOS == "windows" {
-			font, err := LoadFontFamily("Microsoft YaHei")
-			if err != nil {
-				return nil, fmt.Errorf("加载字体失败: %s", err)
-			}
-			return font, nil
-		}
-		font, err := LoadFontFamily("Arial")
-		if err != nil {
-			return nil, fmt.Errorf("加载字体失败: %s", err)
-		}
-		return font, nil
+		return loadDefaultFont()
 	}
 	if !isExist(path) {
 		font, err := LoadFontFamily(path)
@@ -32,17 +58,167 @@ func LoadFont(path string) (*canvas.Font, error) {
 		}
 		return font, nil
 	}
-	return canvas.LoadFontFile(path, canvas.FontBlack)
+	return fontcache.Default.Load(path, canvas.FontBlack)
+}
+
+// defaultFontFamilies 默认字体的候选字体族，按顺序查找
+func defaultFontFamilies() []string {
+	if runtime.GOOS == "windows" {
+		return []string{"Microsoft YaHei", "Arial", "Segoe UI"}
+	}
+	return []string{"Arial", "Helvetica", "Liberation Sans", "DejaVu Sans", "Noto Sans"}
+}
+
+// loadDefaultFont 从系统字体索引中加载默认字体
+func loadDefaultFont() (*canvas.Font, error) {
+	families := defaultFontFamilies()
+	if info, ok := fontcache.SystemFonts().Match(400, false, families...); ok {
+		return fontcache.Default.LoadInfo(info, canvas.FontBlack)
+	}
+	font, err := LoadFontFamily(families[0])
+	if err != nil {
+		return nil, fmt.Errorf("加载字体失败: %s", err)
+	}
+	return font, nil
+}
+
+// systemFallbackFonts 为fonts中都缺少的字符从系统字体索引中挑选回退字体
+func systemFallbackFonts(text string, fonts []*canvas.Font) []*canvas.Font {
+	var missing []rune
+	for _, r := range text {
+		if fontcache.NeedsGlyph(r) && !fontcache.HasGlyph(fonts, r) {
+			missing = append(missing, r)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	var fallbacks []*canvas.Font
+	for _, info := range fontcache.SystemFonts().Fallbacks(string(missing)) {
+		font, err := fontcache.Default.LoadInfo(info, canvas.FontBlack)
+		if err != nil {
+			continue
+		}
+		fallbacks = append(fallbacks, font)
+	}
+	return fallbacks
+}
+
+// checkGlyphs 检查所有字体都无法渲染的字符，严格模式下返回MissingGlyphError，否则通过OnMissingGlyphs回调
+func checkGlyphs(option TextOption, fonts []*canvas.Font) error {
+	return reportMissing(option, fontcache.MissingGlyphs(option.Text, fonts))
+}
+
+// reportMissing 严格模式下为缺少的字形返回MissingGlyphError，否则通过OnMissingGlyphs回调
+func reportMissing(option TextOption, missing []MissingGlyph) error {
+	if len(missing) == 0 {
+		return nil
+	}
+	if option.Strict {
+		return &MissingGlyphError{Glyphs: missing}
+	}
+	if option.OnMissingGlyphs != nil {
+		option.OnMissingGlyphs(missing)
+	}
+	return nil
 }
 
+// LoadFontFamily 按名称加载注册的内存字体或系统字体，名称带扩展名时也会去掉扩展名再查找
 func LoadFontFamily(path string) (*canvas.Font, error) {
-	font, err := canvas.LoadSystemFont(file.Name(path), canvas.FontStyle(canvas.FontNormal))
+	font, err := fontcache.Default.Load(path, canvas.FontStyle(canvas.FontNormal))
 	if err != nil {
 		return nil, err
 	}
 	return font, nil
 }
 
+// LoadFontData 从内存中的字体数据加载字体，相同内容的数据只解析一次
+func LoadFontData(data []byte) (*canvas.Font, error) {
+	return fontcache.Default.LoadBytes(data, canvas.FontBlack)
+}
+
+// LoadFontReader 读取reader中的全部字体数据后加载
+func LoadFontReader(reader io.Reader) (*canvas.Font, error) {
+	return fontcache.Default.LoadReader(reader, canvas.FontBlack)
+}
+
+// LoadFontFS 从fsys中读取字体文件后加载，可用于embed.FS
+func LoadFontFS(fsys fs.FS, path string) (*canvas.Font, error) {
+	return fontcache.Default.LoadFS(fsys, path, canvas.FontBlack)
+}
+
+// loadOptionFont 按FontData、FontFS、FontPath的优先级加载文本选项的字体
+// 设置了Weight、Italic、Variations或OpenTypeFeatures时，按字体名称查找与字重和斜体最接近的字体
+func loadOptionFont(option TextOption) (*canvas.Font, error) {
+	if option.Weight == 0 && !option.Italic && len(option.Variations) == 0 && len(option.OpenTypeFeatures) == 0 {
+		if len(option.FontData) > 0 {
+			return LoadFontData(option.FontData)
+		}
+		if option.FontFS != nil {
+			return LoadFontFS(option.FontFS, option.FontPath)
+		}
+		return LoadFont(option.FontPath)
+	}
+
+	src := fontcache.Source{Path: option.FontPath, Data: option.FontData, FS: option.FontFS}
+	if len(src.Data) == 0 && src.FS == nil && src.Path == "" {
+		weight := option.Weight
+		if weight == 0 {
+			weight = 400
+		}
+		info, ok := fontcache.SystemFonts().Match(weight, option.Italic, defaultFontFamilies()...)
+		if !ok {
+			return loadDefaultFont()
+		}
+		src.Path, src.Index = info.Path, info.Index
+	}
+	font, err := fontcache.Default.LoadSource(src, fontcache.Style(option.Weight, option.Italic), option.Variations, option.OpenTypeFeatures)
+	if err != nil {
+		return nil, fmt.Errorf("加载字体失败: %s", err)
+	}
+	return font, nil
+}
+
+// newFontFace 创建字体Face，字体本身的字重或斜体不满足选项时使用伪粗体和伪斜体
+func newFontFace(font *canvas.Font, option TextOption) *canvas.FontFace {
+	weight := option.Weight
+	if _, ok := option.Variations["wght"]; ok {
+		weight = 0 // 字重由可变字体的wght轴决定
+	}
+	switch option.FontColor.(type) {
+	case Paint, []Paint:
+		return fontcache.Face(font, option.FontSize, weight, option.Italic) // 颜料在绘制路径时设置
+	}
+	return fontcache.Face(font, option.FontSize, weight, option.Italic, option.FontColor)
+}
+
+// optionFonts 加载文本选项的主字体、FontPathList中的字体和系统回退字体，返回字体及对应的Face
+func optionFonts(option TextOption) ([]*canvas.Font, []*canvas.FontFace, error) {
+	font, err := loadOptionFont(option)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	fontList := []*canvas.Font{}
+	for _, fontPath := range option.FontPathList {
+		face, err := LoadFont(fontPath)
+		if err != nil {
+			continue
+		}
+		fontList = append(fontList, face)
+	}
+	// 列表中的字体仍缺少的字符，按文字覆盖范围从系统字体中挑选回退字体
+	fontList = append(fontList, systemFallbackFonts(option.Text, append([]*canvas.Font{font}, fontList...))...)
+	fonts := append([]*canvas.Font{font}, fontList...)
+
+	faces := make([]*canvas.FontFace, 0, len(fonts))
+	for _, font := range fonts {
+		faces = append(faces, newFontFace(font, option))
+	}
+	return fonts, faces, nil
+}
+
 func LoadFontLocal(path string) (*canvas.Font, error) {
 	return canvas.LoadLocalFont(path, canvas.FontBlack)
 }
@@ -0,0 +1,195 @@
+package text2svgV2
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/ibryang/go-utils/fontcache"
+	"github.com/tdewolff/canvas"
+	"github.com/tdewolff/canvas/text"
+)
+
+// glyphCluster 排版后的字形簇
+type glyphCluster struct {
+	fontcache.Cluster
+	index int // 字形簇第一个字符在原文本中的位置，按字符计数
+}
+
+// scriptRun 属于同一文字（script）的一段文本
+type scriptRun struct {
+	text   string
+	script text.Script
+}
+
+// shapeItem 字体、文字和方向都相同，可以整体整形的一段文本
+type shapeItem struct {
+	font   int    // 字体在列表中的序号
+	text   string // 文本
+	offset int    // 在所属双向文本段中的字节位置
+	script text.Script
+}
+
+// layoutText 对文本进行双向排版（UAX #9），再按字体和文字拆分后整体整形，
+// 保留阿拉伯文连写、天城文和泰文的字形组合、字距调整和连字
+// 返回按视觉顺序（从左到右）排列的字形簇，X为相对文本起点的位置
+func layoutText(s string, fonts []*canvas.Font, faces []*canvas.FontFace) ([]glyphCluster, error) {
+	var clusters []glyphCluster
+	var x float64
+	for _, run := range visualRuns(s) {
+		var items []shapeItem
+		offset := 0
+		for _, fontRun := range fontcache.SplitRuns(fonts, run.text) {
+			for _, sr := range splitScripts(fontRun.Text) {
+				items = append(items, shapeItem{font: fontRun.Font, text: sr.text, offset: offset, script: sr.script})
+				offset += len(sr.text)
+			}
+		}
+
+		direction := text.LeftToRight
+		if run.rtl() {
+			direction = text.RightToLeft
+			for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+				items[i], items[j] = items[j], items[i]
+			}
+		}
+
+		for _, item := range items {
+			face := *faces[item.font]
+			face.Direction, face.Script = direction, item.script
+			itemClusters, err := fontcache.ShapeClusters(&face, item.text)
+			if err != nil {
+				return nil, err
+			}
+			itemX := x
+			for _, cluster := range itemClusters {
+				index := run.start + utf8.RuneCountInString(run.text[:item.offset+cluster.Start])
+				cluster.X += itemX
+				clusters = append(clusters, glyphCluster{Cluster: cluster, index: index})
+				x += cluster.Advance
+			}
+		}
+	}
+	return clusters, nil
+}
+
+// layoutVertical 竖排文本，字符从上到下排列，列中线为x=0，X为字形簇到列顶端的距离
+func layoutVertical(s string, faces []*canvas.FontFace, option TextOption) ([]glyphCluster, error) {
+	clusters, err := fontcache.VerticalClusters(faces, s, fontcache.VerticalOptions{
+		Upright:     option.VerticalUpright,
+		TateChuYoko: option.TateChuYoko,
+	})
+	if err != nil {
+		return nil, err
+	}
+	result := make([]glyphCluster, 0, len(clusters))
+	for _, cluster := range clusters {
+		result = append(result, glyphCluster{Cluster: cluster, index: utf8.RuneCountInString(s[:cluster.Start])})
+	}
+	return result, nil
+}
+
+// applySpacing 为字形簇增加字符间距和单词间距，并应用逐字符偏移
+// 竖排时随后将字形簇的路径移动到所在位置，X和Advance为0
+func applySpacing(clusters []glyphCluster, option TextOption) {
+	var shift float64
+	for i := range clusters {
+		cluster := &clusters[i]
+		cluster.X += shift
+		spacing := fontcache.Spacing(cluster.Text, option.LetterSpacing, option.WordSpacing)
+		cluster.Advance += spacing
+		shift += spacing
+
+		if cluster.index < len(option.CharOffsets) {
+			cluster.Path = option.CharOffsets[cluster.index].Apply(cluster.Path)
+		}
+		if option.Direction == DirectionVertical {
+			cluster.Path = cluster.Path.Translate(0, -cluster.X)
+			cluster.X, cluster.Advance = 0, 0
+		}
+	}
+}
+
+// layoutPath 将字形簇沿路径排列，路径已移动到所在位置，X和Advance为0
+func layoutPath(clusters []glyphCluster, tp TextPath) error {
+	plain := make([]fontcache.Cluster, len(clusters))
+	for i, cluster := range clusters {
+		plain[i] = cluster.Cluster
+	}
+	placed, err := fontcache.AlongPath(plain, tp)
+	if err != nil {
+		return err
+	}
+	for i := range clusters {
+		clusters[i].Cluster = placed[i]
+		clusters[i].Advance = 0
+	}
+	return nil
+}
+
+// textMeasurer 返回按option的字体、字号和间距测量一行文本宽度的函数，用于自动换行
+func textMeasurer(option TextOption) (func(string) float64, error) {
+	fonts, faces, err := optionFonts(option)
+	if err != nil {
+		return nil, err
+	}
+	option.CharOffsets = nil
+	return func(s string) float64 {
+		clusters, err := layoutText(s, fonts, faces)
+		if err != nil {
+			return 0
+		}
+		applySpacing(clusters, option)
+		var width float64
+		for _, cluster := range clusters {
+			width = math.Max(width, cluster.X+cluster.Advance)
+		}
+		return width
+	}, nil
+}
+
+// clusterColors 按阅读顺序为字形簇分配颜色序号，空白字符为-1
+// 从右到左的文本也从第一个阅读到的字符开始使用第一个颜色
+func clusterColors(clusters []glyphCluster, colorCount int) []int {
+	order := make([]int, len(clusters))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return clusters[order[a]].index < clusters[order[b]].index })
+
+	colors := make([]int, len(clusters))
+	n := 0
+	for _, i := range order {
+		if strings.TrimSpace(clusters[i].Text) == "" {
+			colors[i] = -1
+			continue
+		}
+		colors[i] = n % colorCount
+		n++
+	}
+	return colors
+}
+
+// splitScripts 按文字（script）拆分文本，标点、数字等通用字符和组合符号归入前一段文字
+func splitScripts(s string) []scriptRun {
+	var runs []scriptRun
+	var current text.Script
+	start := 0
+	for pos, r := range s {
+		if unicode.In(r, unicode.Common, unicode.Inherited) {
+			continue
+		}
+		script := text.LookupScript(r)
+		if pos > start && current != 0 && script != current {
+			runs = append(runs, scriptRun{text: s[start:pos], script: current})
+			start = pos
+		}
+		current = script
+	}
+	if start < len(s) {
+		runs = append(runs, scriptRun{text: s[start:], script: current})
+	}
+	return runs
+}
@@ -0,0 +1,138 @@
+package text2svgV2
+
+import (
+	"image"
+	"image/color"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/ibryang/go-utils/fontcache"
+	"github.com/tdewolff/canvas"
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+// goRegularFaces 返回只包含Go Regular的字体列表，不使用系统回退字体
+func goRegularFaces(t *testing.T) ([]*canvas.Font, []*canvas.FontFace) {
+	font, err := fontcache.New(0).LoadBytes(goregular.TTF, canvas.FontRegular)
+	if err != nil {
+		t.Fatalf("加载字体失败: %v", err)
+	}
+	return []*canvas.Font{font}, []*canvas.FontFace{newFontFace(font, TextOption{FontSize: 12})}
+}
+
+func TestLayoutTextBidi(t *testing.T) {
+	fonts, faces := goRegularFaces(t)
+	cases := []struct {
+		text string
+		want []int // 按视觉顺序（从左到右）排列的字形簇对应的字符位置
+	}{
+		{"abc", []int{0, 1, 2}},
+		// 阿拉伯文后的数字按阿拉伯数字处理，整体仍从左到右
+		{"سلام 123", []int{5, 6, 7, 4, 3, 2, 1, 0}},
+		{"abc سلام 123 def", []int{0, 1, 2, 3, 9, 10, 11, 8, 7, 6, 5, 4, 12, 13, 14, 15}},
+		// 同一从右到左段中的希伯来文和阿拉伯文分别整形，阿拉伯文的字符位置需加上希伯来文的长度
+		{"שלום سلام", []int{8, 7, 6, 5, 4, 3, 2, 1, 0}},
+	}
+	for _, c := range cases {
+		clusters, err := layoutText(c.text, fonts, faces)
+		if err != nil {
+			t.Fatalf("%q排版失败: %v", c.text, err)
+		}
+		runes := []rune(c.text)
+		var got []int
+		x := -1.0
+		for _, cluster := range clusters {
+			got = append(got, cluster.index)
+			if []rune(cluster.Text)[0] != runes[cluster.index] {
+				t.Errorf("%q: 字形簇%q的位置%d不正确", c.text, cluster.Text, cluster.index)
+			}
+			if cluster.X <= x {
+				t.Errorf("%q: 字形簇%q不在前一个字形簇右侧", c.text, cluster.Text)
+			}
+			x = cluster.X
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%q的视觉顺序不正确: %v, 期望: %v", c.text, got, c.want)
+		}
+	}
+}
+
+func TestClusterColors(t *testing.T) {
+	fonts, faces := goRegularFaces(t)
+	cases := []struct {
+		text   string
+		colors int
+		want   []int // 按字符位置排列的颜色序号，空白为-1
+	}{
+		{"ab c", 2, []int{0, 1, -1, 0}},
+		// 从右到左的文本从第一个阅读到的字符开始使用第一个颜色
+		{"سلام 123", 3, []int{0, 1, 2, 0, -1, 1, 2, 0}},
+	}
+	for _, c := range cases {
+		clusters, err := layoutText(c.text, fonts, faces)
+		if err != nil {
+			t.Fatalf("%q排版失败: %v", c.text, err)
+		}
+		colors := clusterColors(clusters, c.colors)
+		for i, cluster := range clusters {
+			if colors[i] != c.want[cluster.index] {
+				t.Errorf("%q: 字形簇%q的颜色为%d，期望: %d", c.text, cluster.Text, colors[i], c.want[cluster.index])
+			}
+		}
+	}
+}
+
+// pathRecorder 记录画布中绘制的路径及其填充颜色
+type pathRecorder struct {
+	paths []recordedPath
+}
+
+type recordedPath struct {
+	bounds canvas.Rect
+	fill   color.RGBA
+}
+
+func (r *pathRecorder) Size() (float64, float64) { return 0, 0 }
+
+func (r *pathRecorder) RenderPath(path *canvas.Path, style canvas.Style, m canvas.Matrix) {
+	if path.Empty() || style.Fill.Color.A == 0 {
+		return
+	}
+	r.paths = append(r.paths, recordedPath{bounds: path.Transform(m).Bounds(), fill: style.Fill.Color})
+}
+
+func (r *pathRecorder) RenderText(text *canvas.Text, m canvas.Matrix) {}
+
+func (r *pathRecorder) RenderImage(img image.Image, m canvas.Matrix) {}
+
+func TestGenerateBaseTextBidiColors(t *testing.T) {
+	// 每个非空白字符使用不同的颜色，按颜色找出字符的视觉位置
+	colors := []string{"#FF0000", "#00FF00", "#0000FF", "#FFFF00", "#00FFFF", "#FF00FF", "#808080"}
+	c, err := GenerateBaseText(TextOption{
+		Text:       "سلام 123",
+		FontData:   goregular.TTF,
+		FontSize:   12,
+		FontColor:  colors,
+		RenderMode: RenderChar,
+	})
+	if err != nil {
+		t.Fatalf("生成文本失败: %v", err)
+	}
+
+	recorder := &pathRecorder{}
+	c.RenderTo(recorder)
+	sort.SliceStable(recorder.paths, func(i, j int) bool { return recorder.paths[i].bounds.X0 < recorder.paths[j].bounds.X0 })
+	var got []int
+	for _, path := range recorder.paths {
+		for i, s := range colors {
+			if canvas.Hex(s) == path.fill {
+				got = append(got, i)
+			}
+		}
+	}
+	// 视觉顺序为"123"在左、阿拉伯文在右且从右向左阅读
+	if want := []int{4, 5, 6, 3, 2, 1, 0}; !reflect.DeepEqual(got, want) {
+		t.Errorf("字符颜色的视觉顺序不正确: %v, 期望: %v", got, want)
+	}
+}
@@ -0,0 +1,72 @@
+package text2svgV2
+
+import (
+	"fmt"
+
+	"github.com/ibryang/go-utils/fontcache"
+)
+
+// ParsePaint 解析颜色字符串，支持颜色名称、十六进制颜色、线性渐变、径向渐变和图片图案，
+// 例如"red"、"#FF0000"、"linear-gradient(90deg, red, blue)"、"radial-gradient(white, black)"、"url(wood.png)"
+func ParsePaint(s string) (Paint, error) {
+	return fontcache.ParsePaint(s, GetColor)
+}
+
+// paintOf 解析颜色字符串，格式无效时按颜色名称或十六进制纯色处理
+func paintOf(s string) Paint {
+	paint, err := ParsePaint(s)
+	if err != nil {
+		return fontcache.SolidPaint(GetColor(s))
+	}
+	return paint
+}
+
+// toPaints 将颜色选项转换为颜料列表，支持string、[]string、Paint和[]Paint，其他类型返回nil
+func toPaints(v any) ([]Paint, error) {
+	switch v := v.(type) {
+	case string:
+		paint, err := ParsePaint(v)
+		if err != nil {
+			return nil, fmt.Errorf("解析颜色失败: %s", err)
+		}
+		return []Paint{paint}, nil
+	case []string:
+		paints := make([]Paint, 0, len(v))
+		for _, s := range v {
+			paint, err := ParsePaint(s)
+			if err != nil {
+				return nil, fmt.Errorf("解析颜色失败: %s", err)
+			}
+			paints = append(paints, paint)
+		}
+		return paints, nil
+	case Paint:
+		return []Paint{v}, nil
+	case []Paint:
+		return v, nil
+	}
+	return nil, nil
+}
+
+// checkStrokes 检查描边颜色不是图案，空字符串跳过
+func checkStrokes(colors ...string) error {
+	for _, color := range colors {
+		if color == "" {
+			continue
+		}
+		if err := fontcache.CheckStroke(paintOf(color)); err != nil {
+			return fmt.Errorf("描边颜色%q无效: %s", color, err)
+		}
+	}
+	return nil
+}
+
+// checkRectStrokes 检查矩形的描边颜色不是图案
+func checkRectStrokes(rects []RectOption) error {
+	for _, rect := range rects {
+		if err := checkStrokes(rect.StrokeColor); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -5,6 +5,7 @@ import (
 	"image"
 	"os"
 
+	"github.com/ibryang/go-utils/fontcache"
 	"github.com/tdewolff/canvas"
 )
 
@@ -54,17 +55,12 @@ func DrawRect(ctx *canvas.Context, rectOption RectOption) {
 		rectOption.Height = ctx.Height()
 	}
 
-	// 设置背景色
-	bgColor := canvas.Transparent
+	// 设置背景，支持纯色、渐变和图案
+	fill := fontcache.SolidPaint(canvas.Transparent)
 	if rectOption.BgColor != "" {
-		if color, ok := ColorMap[rectOption.BgColor]; ok {
-			bgColor = color
-		} else {
-			bgColor = canvas.Hex(rectOption.BgColor)
-		}
+		fill = paintOf(rectOption.BgColor)
 	}
 
-	ctx.SetFillColor(bgColor)
 	// 绘制矩形路径
 	var path *canvas.Path
 	if rectOption.Radius > 0 {
@@ -72,24 +68,14 @@ func DrawRect(ctx *canvas.Context, rectOption RectOption) {
 	} else {
 		path = canvas.Rectangle(rectOption.Width, rectOption.Height)
 	}
+	path = path.Translate(rectOption.X, rectOption.Y)
 
 	// 处理描边
-	if rectOption.StrokeWidth > 0 {
-		var strokeColor = canvas.Black
-		if rectOption.StrokeColor != "" {
-			if color, ok := ColorMap[rectOption.StrokeColor]; ok {
-				strokeColor = color
-			} else {
-				strokeColor = canvas.Hex(rectOption.StrokeColor)
-			}
-		}
-		ctx.SetStrokeColor(strokeColor)
-		ctx.SetStrokeWidth(rectOption.StrokeWidth)
-		ctx.Stroke()
+	stroke := fontcache.SolidPaint(canvas.Black)
+	if rectOption.StrokeColor != "" {
+		stroke = paintOf(rectOption.StrokeColor)
 	}
-	ctx.DrawPath(rectOption.X, rectOption.Y, path)
-
-	ctx.Fill()
+	fontcache.DrawPath(ctx, path, path.Bounds(), fill, stroke, rectOption.StrokeWidth)
 
 	if rectOption.BgFile != "" {
 		// 判断 BgFile 是否为一个存在的文件
@@ -0,0 +1,115 @@
+package text2svgV2
+
+import (
+	"math"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ibryang/go-utils/fontcache"
+	"github.com/tdewolff/canvas"
+)
+
+// spanStyle 富文本一段的填充和描边
+type spanStyle struct {
+	fill        Paint
+	stroke      Paint
+	strokeWidth float64
+}
+
+// spansText 返回富文本各段文本的拼接
+func spansText(spans []TextSpan) string {
+	var sb strings.Builder
+	for _, span := range spans {
+		sb.WriteString(span.Text)
+	}
+	return sb.String()
+}
+
+// spanOption 返回富文本一段使用的文本选项，未设置的字段沿用option
+func spanOption(span TextSpan, option TextOption) TextOption {
+	spanOpt := option
+	spanOpt.Text = span.Text
+	spanOpt.Spans = nil
+	spanOpt.Direction = DirectionHorizontal
+	spanOpt.TextPath = nil
+	if span.FontData != nil {
+		spanOpt.FontData, spanOpt.FontPath = span.FontData, ""
+	} else if span.FontPath != "" {
+		spanOpt.FontData, spanOpt.FontPath = nil, span.FontPath
+	}
+	if span.FontSize > 0 {
+		spanOpt.FontSize = span.FontSize
+	}
+	if span.Weight > 0 {
+		spanOpt.Weight = span.Weight
+	}
+	spanOpt.Italic = option.Italic || span.Italic
+	return spanOpt
+}
+
+// spanStyles 返回富文本各段的颜色和描边，fontColor和strokeColor为option解析后的颜料
+func spanStyles(option TextOption, fontColor []Paint, strokeColor Paint) []spanStyle {
+	styles := make([]spanStyle, len(option.Spans))
+	for i, span := range option.Spans {
+		style := spanStyle{fill: fontcache.SolidPaint(canvas.Black), stroke: strokeColor, strokeWidth: option.StrokeWidth}
+		if span.FontColor != "" {
+			style.fill = paintOf(span.FontColor)
+		} else if len(fontColor) > 0 {
+			style.fill = fontColor[i%len(fontColor)]
+		}
+		if span.StrokeColor != "" {
+			style.stroke = paintOf(span.StrokeColor)
+		}
+		if span.StrokeWidth > 0 {
+			style.strokeWidth = span.StrokeWidth
+		}
+		styles[i] = style
+	}
+	return styles
+}
+
+// layoutSpans 排版富文本，各段依次排列在同一基线上，BaselineShift将该段上移或下移
+// 返回的字形簇路径已移动到所在位置，X和Advance为0，同时返回每个字形簇所在段的序号
+func layoutSpans(option TextOption) ([]glyphCluster, []int, error) {
+	var clusters []glyphCluster
+	var spanIndices []int
+	var missing []MissingGlyph
+	var x float64
+	index := 0 // 当前段第一个字符在Text中的位置
+	for i, span := range option.Spans {
+		spanOpt := spanOption(span, option)
+		spanOpt.CharOffsets = nil
+		if index < len(option.CharOffsets) {
+			spanOpt.CharOffsets = option.CharOffsets[index:]
+		}
+		fonts, faces, err := optionFonts(spanOpt)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, glyph := range fontcache.MissingGlyphs(span.Text, fonts) {
+			glyph.Index += index
+			missing = append(missing, glyph)
+		}
+
+		spanClusters, err := layoutText(span.Text, fonts, faces)
+		if err != nil {
+			return nil, nil, err
+		}
+		applySpacing(spanClusters, spanOpt)
+		var width float64
+		for _, cluster := range spanClusters {
+			width = math.Max(width, cluster.X+cluster.Advance)
+			cluster.Path = cluster.Path.Translate(x+cluster.X, span.BaselineShift)
+			cluster.X, cluster.Advance = 0, 0
+			cluster.index += index
+			clusters = append(clusters, cluster)
+			spanIndices = append(spanIndices, i)
+		}
+		x += width
+		index += utf8.RuneCountInString(span.Text)
+	}
+	if err := reportMissing(option, missing); err != nil {
+		return nil, nil, err
+	}
+	return clusters, spanIndices, nil
+}
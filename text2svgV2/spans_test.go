@@ -0,0 +1,44 @@
+package text2svgV2
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+func TestLayoutSpansBaselineShift(t *testing.T) {
+	clusters, spanIndices, err := layoutSpans(TextOption{
+		FontData: goregular.TTF,
+		FontSize: 12,
+		Spans: []TextSpan{
+			{Text: "xx"},
+			{Text: "x", BaselineShift: 5},
+			{Text: "x", BaselineShift: -3},
+		},
+	})
+	if err != nil {
+		t.Fatalf("排版失败: %v", err)
+	}
+	if want := []int{0, 0, 1, 2}; !reflect.DeepEqual(spanIndices, want) {
+		t.Fatalf("字形簇所在段: %v, 期望: %v", spanIndices, want)
+	}
+
+	base := clusters[0].Path.Bounds()
+	x := base.X1
+	for i, shift := range []float64{0, 0, 5, -3} {
+		if clusters[i].index != i {
+			t.Errorf("第%d个字形簇的位置为%d", i, clusters[i].index)
+		}
+		bounds := clusters[i].Path.Bounds()
+		if math.Abs(bounds.Y0-base.Y0-shift) > 1e-6 || math.Abs(bounds.Y1-base.Y1-shift) > 1e-6 {
+			t.Errorf("第%d个字形簇的纵向范围为%v-%v，期望偏移: %v", i, bounds.Y0, bounds.Y1, shift)
+		}
+		// 各段依次排列，不与前一段重叠
+		if i > 0 && bounds.X0 < x-1e-6 {
+			t.Errorf("第%d个字形簇与前一个字形簇重叠", i)
+		}
+		x = bounds.X1
+	}
+}
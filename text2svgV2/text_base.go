@@ -3,34 +3,20 @@ package text2svgV2
 import (
 	"errors"
 	"fmt"
-	"image/color"
 	"math"
-	"runtime"
 	"strings"
 
+	"github.com/ibryang/go-utils/fontcache"
 	"github.com/tdewolff/canvas"
 	"github.com/tdewolff/canvas/text"
 	"github.com/tdewolff/font"
 )
 
-func getFontBaseList() []string {
-	if runtime.GOOS == "windows" {
-		return []string{
-			`C:\Windows\Fonts\segoeui.ttf`,
-			`C:\Windows\Fonts\segoeui_0.ttf`,
-			`C:\Windows\Fonts\arial.ttf`,
-			`C:\Windows\Fonts\arial_0.ttf`,
-			`C:\Windows\Fonts\msyh.ttc`,
-		}
-	}
-	return []string{
-		`/System/Library/Fonts/Supplemental/Arial.ttf`,
-		`/System/Library/Fonts/Supplemental/Songti.ttc`,
-	}
-}
-
 // GenerateBaseText 生成基础文本
 func GenerateBaseText(option TextOption) (*canvas.Canvas, error) {
+	if len(option.Spans) > 0 {
+		option.Text = spansText(option.Spans)
+	}
 	if option.Text == "" {
 		return nil, errors.New("text is required")
 	}
@@ -39,59 +25,65 @@ func GenerateBaseText(option TextOption) (*canvas.Canvas, error) {
 		textEmpty = true
 		option.Text = "H"
 	}
-	// 如果检测到为RTL文字（如阿拉伯/希伯来等），反向排列文字
-	if !textEmpty && isRTLText(option.Text) {
-		option.RenderMode = RenderString
-	}
-	// 判断fontColor类型
-	var fontColor []color.RGBA
-	var strokeColor color.RGBA = canvas.Black
+	// 解析字体颜色和描边颜色，支持纯色、渐变和图案
+	var fontColor []Paint
+	strokeColor := fontcache.SolidPaint(canvas.Black)
 	var strokeWidth float64 = option.StrokeWidth
 	if option.RenderMode == 0 {
 		option.RenderMode = RenderString
 	}
 	if option.FontColor != nil {
-		if color, ok := option.FontColor.(string); ok {
-			if c, ok := ColorMap[color]; ok {
-				fontColor = append(fontColor, c)
-			} else {
-				fontColor = append(fontColor, canvas.Hex(color))
-			}
-		}
-		if color, ok := option.FontColor.([]string); ok {
-			for _, c := range color {
-				if v, ok := ColorMap[c]; ok {
-					fontColor = append(fontColor, v)
-				} else {
-					fontColor = append(fontColor, canvas.Hex(c))
-				}
-			}
+		paints, err := toPaints(option.FontColor)
+		if err != nil {
+			return nil, err
 		}
+		fontColor = paints
 	}
 	if textEmpty {
-		fontColor = []color.RGBA{canvas.Hex("#FFFFFF00")}
+		fontColor = []Paint{fontcache.SolidPaint(canvas.Hex("#FFFFFF00"))}
 	}
 	if option.StrokeColor != nil {
-		if color, ok := option.StrokeColor.(string); ok {
-			if c, ok := ColorMap[color]; ok {
-				strokeColor = c
-			} else {
-				strokeColor = canvas.Hex(color)
-			}
+		paints, err := toPaints(option.StrokeColor)
+		if err != nil {
+			return nil, err
+		}
+		if len(paints) > 0 {
+			strokeColor = paints[0]
+		}
+		if err := fontcache.CheckStroke(strokeColor); err != nil {
+			return nil, fmt.Errorf("描边颜色无效: %s", err)
 		}
 	}
-
-	if len(option.FontPathList) == 0 {
-		option.FontPathList = getFontBaseList()
-	} else {
-		option.FontPathList = append(option.FontPathList, getFontBaseList()...)
+	for _, span := range option.Spans {
+		if err := checkStrokes(span.StrokeColor); err != nil {
+			return nil, err
+		}
+	}
+	if option.RectOption != nil {
+		if err := checkStrokes(option.RectOption.StrokeColor); err != nil {
+			return nil, err
+		}
 	}
 
-	font, err := LoadFont(option.FontPath)
-	if err != nil {
-		return nil, err
+	// 富文本各段分别加载字体和排版，按单字符模式绘制
+	spans := len(option.Spans) > 0 && !textEmpty
+	if spans {
+		option.RenderMode = RenderChar
+	}
+	var fonts []*canvas.Font
+	var faces []*canvas.FontFace
+	var err error
+	if !spans {
+		fonts, faces, err = optionFonts(option)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !textEmpty && !spans {
+		if err := checkGlyphs(option, fonts); err != nil {
+			return nil, err
+		}
 	}
-	fontface := font.Face(option.FontSize, option.FontColor)
 
 	// 首先计算所有字符的确切边界，以确定整个字符串的实际可视范围
 	minX, minY := math.Inf(1), math.Inf(1)
@@ -103,102 +95,53 @@ func GenerateBaseText(option TextOption) (*canvas.Canvas, error) {
 	var exactWidth float64
 	var exactHeight float64
 
-	fontList := []*canvas.Font{}
-	for _, fontPath := range option.FontPathList {
-		face, err := LoadFont(fontPath)
-		if err != nil {
-			continue
+	// 双向排版后按字体和文字整体整形，得到按视觉顺序排列的字形簇
+	if option.TextPath != nil {
+		option.Direction = DirectionHorizontal // 沿路径排列时按横排整形
+	}
+	var clusters []glyphCluster
+	var spanIndices []int
+	var styles []spanStyle
+	switch {
+	case spans:
+		clusters, spanIndices, err = layoutSpans(option)
+		styles = spanStyles(option, fontColor, strokeColor)
+	case option.Direction == DirectionVertical:
+		clusters, err = layoutVertical(option.Text, faces, option)
+	default:
+		clusters, err = layoutText(option.Text, fonts, faces)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !spans {
+		applySpacing(clusters, option)
+	}
+	if option.TextPath != nil && !spans {
+		if err := layoutPath(clusters, *option.TextPath); err != nil {
+			return nil, err
 		}
-		fontList = append(fontList, face)
 	}
 
 	// 计算整个字符串的确切边界框
 	var xPos float64
 	var colorIndices []int
 	if option.RenderMode == RenderChar {
-		colorCount := 0
-		for _, char := range option.Text {
-			glyphs := fontface.Glyphs(string(char))
-			if glyphs[0].ID == 0 {
-				for _, font := range fontList {
-					fontface := font.Face(option.FontSize, option.FontColor)
-					glyphs := fontface.Glyphs(string(char))
-					if glyphs[0].ID == 0 {
-						continue
-					} else {
-						path, advance, err := fontface.ToPath(string(char))
-						if err != nil {
-							return nil, err
-						}
-						bounds := path.Bounds()
-						minX = math.Min(minX, bounds.X0+xPos)
-						minY = math.Min(minY, bounds.Y0)
-						maxX = math.Max(maxX, bounds.X1+xPos)
-						maxY = math.Max(maxY, bounds.Y1)
-
-						charPaths = append(charPaths, *path)
-						advances = append(advances, advance)
-						xPos += advance
-						if char == ' ' {
-							colorIndices = append(colorIndices, -1)
-							continue
-						}
-						colorIndices = append(colorIndices, colorCount%len(fontColor))
-						colorCount++
-						break
-					}
-				}
-			} else {
-				path, advance, err := fontface.ToPath(string(char))
-				if err != nil {
-					return nil, err
-				}
-				if len(path.String()) == 0 && string(char) != " " {
-					for _, font := range fontList {
-						fontface := font.Face(option.FontSize, option.FontColor)
-						glyphs := fontface.Glyphs(string(char))
-						if glyphs[0].ID == 0 {
-							continue
-						} else {
-							path, advance, err := fontface.ToPath(string(char))
-							if err != nil {
-								return nil, err
-							}
-							bounds := path.Bounds()
-							minX = math.Min(minX, bounds.X0+xPos)
-							minY = math.Min(minY, bounds.Y0)
-							maxX = math.Max(maxX, bounds.X1+xPos)
-							maxY = math.Max(maxY, bounds.Y1)
-							charPaths = append(charPaths, *path)
-							advances = append(advances, advance)
-							xPos += advance
-							if char == ' ' {
-								colorIndices = append(colorIndices, -1)
-								continue
-							}
-							colorIndices = append(colorIndices, colorCount%len(fontColor))
-							colorCount++
-							break
-						}
-					}
-				} else {
-					bounds := path.Bounds()
-					minX = math.Min(minX, bounds.X0+xPos)
-					minY = math.Min(minY, bounds.Y0)
-					maxX = math.Max(maxX, bounds.X1+xPos)
-					maxY = math.Max(maxY, bounds.Y1)
-
-					charPaths = append(charPaths, *path)
-					advances = append(advances, advance)
-					xPos += advance
-					if char == ' ' {
-						colorIndices = append(colorIndices, -1)
-						continue
-					}
-					colorIndices = append(colorIndices, colorCount%len(fontColor))
-					colorCount++
-				}
+		// 颜色按阅读顺序分配，从右到左的文本同样逐字符上色
+		if !spans {
+			colorIndices = clusterColors(clusters, len(fontColor))
+		}
+		for _, cluster := range clusters {
+			if !cluster.Path.Empty() {
+				bounds := cluster.Path.Bounds()
+				minX = math.Min(minX, bounds.X0+xPos)
+				minY = math.Min(minY, bounds.Y0)
+				maxX = math.Max(maxX, bounds.X1+xPos)
+				maxY = math.Max(maxY, bounds.Y1)
 			}
+			charPaths = append(charPaths, *cluster.Path)
+			advances = append(advances, cluster.Advance)
+			xPos += cluster.Advance
 		}
 
 		// 计算精确的宽度和高度
@@ -207,12 +150,9 @@ func GenerateBaseText(option TextOption) (*canvas.Canvas, error) {
 	}
 	var path *canvas.Path
 	if option.RenderMode == RenderString {
-		// p, _, err := fontface.ToPath(option.Text)
-
-		p, _, err := ToPath(fontface, fontList, option.Text, option.FontSize)
-		// p, _, err := ToPath(fontface, fontList, option.Text, option.FontSize)
-		if err != nil {
-			return nil, err
+		p := &canvas.Path{}
+		for _, cluster := range clusters {
+			p = p.Append(cluster.Path.Translate(cluster.X, 0))
 		}
 		p = p.Transform(canvas.Matrix{
 			{1, 0, -p.Bounds().X0},
@@ -236,34 +176,32 @@ func GenerateBaseText(option TextOption) (*canvas.Canvas, error) {
 	xPos = -minX // 调整起始位置，确保所有内容都可见
 	yPos := -minY
 	if option.RenderMode == RenderChar {
+		// 渐变和图案默认按整段文本的边界框定位，PaintPerChar时按每个字符定位
+		contentRect := canvas.Rect{X1: exactWidth, Y1: exactHeight}
 		for i, path := range charPaths {
-			// 将路径绘制到画布上
-			if colorIndices[i] == -1 {
-				textCtx.SetFillColor(canvas.Transparent)
-			} else {
-				textCtx.SetFillColor(fontColor[colorIndices[i]])
+			// 富文本使用所在段的颜色和描边
+			style := spanStyle{fill: fontcache.SolidPaint(canvas.Transparent), stroke: strokeColor, strokeWidth: strokeWidth}
+			if spans {
+				style = styles[spanIndices[i]]
+			} else if colorIndices[i] != -1 {
+				style.fill = fontColor[colorIndices[i]]
 			}
-			if strokeWidth > 0 {
-				textCtx.SetStrokeColor(strokeColor)
-				textCtx.SetStrokeWidth(strokeWidth)
-				textCtx.Stroke()
+
+			// 将路径绘制到画布上
+			charPath := path.Translate(xPos, yPos)
+			rect := contentRect
+			if option.PaintPerChar {
+				rect = charPath.Bounds()
 			}
-			textCtx.DrawPath(xPos, yPos, &path)
-			textCtx.Fill()
+			fontcache.DrawPath(textCtx, charPath, rect, style.fill, style.stroke, style.strokeWidth)
 
 			// 更新x位置
 			xPos += advances[i]
 		}
 	}
 	if option.RenderMode == RenderString {
-		textCtx.SetFillColor(fontColor[0])
-		if strokeWidth > 0 {
-			textCtx.SetStrokeColor(strokeColor)
-			textCtx.SetStrokeWidth(strokeWidth)
-			textCtx.Stroke()
-		}
-		textCtx.DrawPath(0, -minY, path)
-		textCtx.Fill()
+		path = path.Translate(0, -minY)
+		fontcache.DrawPath(textCtx, path, path.Bounds(), fontColor[0], strokeColor, strokeWidth)
 	}
 	if len(option.ExtraText) > 0 {
 		for _, extOption := range option.ExtraText {
@@ -388,61 +326,6 @@ func DrawExtraText(c *canvas.Context, extOption ExtraTextOption) {
 	})
 }
 
-// isRTLText 粗略判断文本是否包含从右到左的文字（例如阿拉伯、希伯来等）
-func isRTLText(s string) bool {
-	for _, r := range s {
-		if isRTRune(r) {
-			return true
-		}
-	}
-	return false
-}
-
-// isRTRune 判断单个rune是否属于常见RTL Unicode区段
-func isRTRune(r rune) bool {
-	switch {
-	// Hebrew
-	case r >= 0x0590 && r <= 0x05FF:
-		return true
-	// Arabic + Arabic Supplement + Arabic Extended-A
-	case r >= 0x0600 && r <= 0x06FF:
-		return true
-	case r >= 0x0750 && r <= 0x077F:
-		return true
-	case r >= 0x08A0 && r <= 0x08FF:
-		return true
-	// Syriac
-	case r >= 0x0700 && r <= 0x074F:
-		return true
-	// Thaana
-	case r >= 0x0780 && r <= 0x07BF:
-		return true
-	// NKo
-	case r >= 0x07C0 && r <= 0x07FF:
-		return true
-	// Arabic Presentation Forms-A
-	case r >= 0xFB50 && r <= 0xFDFF:
-		return true
-	// Arabic Presentation Forms-B
-	case r >= 0xFE70 && r <= 0xFEFF:
-		return true
-	// Right-to-left marks and formatting characters
-	case r == 0x202B || r == 0x202E || r == 0x200F:
-		return true
-	default:
-		return false
-	}
-}
-
-// reverseRunes 以rune为单位反转字符串
-func reverseRunes(s string) string {
-	runes := []rune(s)
-	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
-		runes[i], runes[j] = runes[j], runes[i]
-	}
-	return string(runes)
-}
-
 // ToPath converts a string to its glyph paths.
 func ToPath(face *canvas.FontFace, fontFaceList []*canvas.Font, s string, fontSize float64) (*canvas.Path, float64, error) {
 	ppem := face.PPEM(96 * 1.0 / 25.4)
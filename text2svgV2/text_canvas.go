@@ -8,6 +8,9 @@ import (
 
 // GenerateCanvasText 生成画布
 func GenerateCanvasText(option CanvasOption) (*canvas.Canvas, error) {
+	if err := checkRectStrokes(option.RectOption); err != nil {
+		return nil, err
+	}
 	c := canvas.New(option.Width, option.Height)
 	ctx := canvas.NewContext(c)
 	for _, rectOption := range option.RectOption {
@@ -6,17 +6,32 @@ import (
 	"math"
 	"os"
 	"strings"
+	"unicode/utf8"
 
+	"github.com/ibryang/go-utils/fontcache"
 	"github.com/tdewolff/canvas"
-	"github.com/tdewolff/canvas/renderers"
 )
 
 // GenerateMultipleLinesText 生成多行文本
 func GenerateMultipleLinesText(option TextLineOption) (*canvas.Canvas, error) {
+	if err := checkRectStrokes(option.RectOption); err != nil {
+		return nil, err
+	}
 	if len(option.TextList) == 0 {
 		return nil, errors.New("text list is required")
 	}
 
+	// 自动换行，每行作为单独的文本；竖排时不按宽度换行，只在换行符处分为多列
+	wrapOption := option
+	if option.Direction == DirectionVertical {
+		wrapOption.WrapWidth = 0
+	}
+	wrapped, err := wrapTextList(wrapOption)
+	if err != nil {
+		return nil, err
+	}
+	option.TextList = wrapped
+
 	// 列表反转
 	textList := []TextOption{}
 	for i := len(option.TextList) - 1; i >= 0; i-- {
@@ -30,6 +45,9 @@ func GenerateMultipleLinesText(option TextLineOption) (*canvas.Canvas, error) {
 	totalHeight := 0.0
 
 	for _, textOption := range option.TextList {
+		if option.Direction == DirectionVertical {
+			textOption.Direction = DirectionVertical
+		}
 		textCanvas, err := GenerateBaseText(textOption)
 		if err != nil {
 			return nil, err
@@ -48,28 +66,35 @@ func GenerateMultipleLinesText(option TextLineOption) (*canvas.Canvas, error) {
 	// 创建内容画布
 	contentWidth := maxWidth
 	contentHeight := totalHeight
+	if option.Direction == DirectionVertical {
+		contentWidth, contentHeight = columnsSize(textCanvases, option.LineGap)
+	}
 	c := canvas.New(contentWidth, contentHeight)
 
-	// 布局文本行
-	yPos := 0.0
-	for _, textCanvas := range textCanvases {
-		// 根据对齐方式计算x位置
-		xPos := 0.0 // 默认左对齐
+	if option.Direction == DirectionVertical {
+		renderColumns(c, textCanvases, option.LineGap, option.VAlign)
+	} else {
+		// 布局文本行
+		yPos := 0.0
+		for _, textCanvas := range textCanvases {
+			// 根据对齐方式计算x位置
+			xPos := 0.0 // 默认左对齐
 
-		if option.Align == TextAlignCenter {
-			xPos = (contentWidth - textCanvas.W) / 2
-		} else if option.Align == TextAlignRight {
-			xPos = contentWidth - textCanvas.W
-		}
+			if option.Align == TextAlignCenter {
+				xPos = (contentWidth - textCanvas.W) / 2
+			} else if option.Align == TextAlignRight {
+				xPos = contentWidth - textCanvas.W
+			}
 
-		// 渲染到画布
-		textCanvas.RenderViewTo(c, canvas.Matrix{
-			{1, 0, xPos},
-			{0, 1, yPos},
-		})
+			// 渲染到画布
+			textCanvas.RenderViewTo(c, canvas.Matrix{
+				{1, 0, xPos},
+				{0, 1, yPos},
+			})
 
-		// 更新位置
-		yPos += textCanvas.H + option.LineGap
+			// 更新位置
+			yPos += textCanvas.H + option.LineGap
+		}
 	}
 
 	// 应用缩放
@@ -203,9 +228,75 @@ func GenerateMultipleLinesText(option TextLineOption) (*canvas.Canvas, error) {
 	return finalCanvas, nil
 }
 
+// wrapTextList 按WrapWidth、MaxLines和Ellipsis将每个文本拆分为多行，文本中的换行符处强制换行，富文本不换行
+func wrapTextList(option TextLineOption) ([]TextOption, error) {
+	var list []TextOption
+	for _, textOption := range option.TextList {
+		if len(textOption.Spans) > 0 || option.WrapWidth <= 0 && !strings.ContainsAny(textOption.Text, "\n\r") {
+			list = append(list, textOption)
+			continue
+		}
+		measure, err := textMeasurer(textOption)
+		if err != nil {
+			return nil, err
+		}
+		lines := fontcache.Wrap(textOption.Text, fontcache.WrapOptions{
+			Width:    option.WrapWidth,
+			MaxLines: option.MaxLines,
+			Ellipsis: option.Ellipsis,
+		}, measure)
+		for _, line := range lines {
+			lineOption := textOption
+			lineOption.Text = line.Text
+			if lineOption.Text == "" {
+				lineOption.Text = " " // 空行保留一行的高度
+			}
+			// 逐字符偏移按字符在原文本中的位置对应
+			lineOption.CharOffsets = nil
+			if index := utf8.RuneCountInString(textOption.Text[:line.Start]); index < len(textOption.CharOffsets) {
+				lineOption.CharOffsets = textOption.CharOffsets[index:]
+			}
+			list = append(list, lineOption)
+		}
+	}
+	return list, nil
+}
+
+// columnsSize 计算竖排多列的总宽度和最大高度
+func columnsSize(columns []*canvas.Canvas, gap float64) (float64, float64) {
+	var width, height float64
+	for _, column := range columns {
+		width += column.W
+		height = math.Max(height, column.H)
+	}
+	if len(columns) > 1 {
+		width += gap * float64(len(columns)-1)
+	}
+	return width, height
+}
+
+// renderColumns 从左到右绘制竖排的各列，列表已反转，因此第一个文本位于最右侧
+// 各列在竖直方向按valign对齐，默认顶端对齐
+func renderColumns(c *canvas.Canvas, columns []*canvas.Canvas, gap float64, valign TextAlign) {
+	xPos := 0.0
+	for _, column := range columns {
+		yPos := c.H - column.H
+		if valign == TextVAlignCenter {
+			yPos = (c.H - column.H) / 2
+		} else if valign == TextVAlignBottom {
+			yPos = 0
+		}
+		column.RenderViewTo(c, canvas.Matrix{
+			{1, 0, xPos},
+			{0, 1, yPos},
+		})
+		xPos += column.W + gap
+	}
+}
+
 func GroupSvg(c *canvas.Canvas, output string) *canvas.Canvas {
 	var stringWriter bytes.Buffer
-	c.Write(&stringWriter, renderers.SVG())
+	c.Write(&stringWriter, fontcache.SVG())
 	svg := stringWriter.String()
 	svg = strings.Replace(svg, `xlink">`, `xlink"><g>`, -1)
 	svg = strings.Replace(svg, `</svg>`, `</g></svg>`, -1)
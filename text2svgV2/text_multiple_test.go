@@ -0,0 +1,103 @@
+package text2svgV2
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+// wrapLines 返回wrapTextList拆分后各行的文本
+func wrapLines(t *testing.T, option TextLineOption) []string {
+	list, err := wrapTextList(option)
+	if err != nil {
+		t.Fatalf("换行失败: %v", err)
+	}
+	var lines []string
+	for _, textOption := range list {
+		lines = append(lines, textOption.Text)
+	}
+	return lines
+}
+
+func TestWrapTextList(t *testing.T) {
+	textOption := TextOption{Text: "aaa bbb ccc", FontData: goregular.TTF, FontSize: 12}
+	measure, err := textMeasurer(textOption)
+	if err != nil {
+		t.Fatalf("创建测量函数失败: %v", err)
+	}
+	width := measure("aaa bbb")
+
+	cases := []struct {
+		name   string
+		option TextLineOption
+		want   []string
+	}{
+		{"不换行", TextLineOption{}, []string{"aaa bbb ccc"}},
+		{"按宽度换行", TextLineOption{WrapWidth: width}, []string{"aaa bbb", "ccc"}},
+		{"最大行数", TextLineOption{WrapWidth: width, MaxLines: 1}, []string{"aaa bbb"}},
+	}
+	for _, c := range cases {
+		c.option.TextList = []TextOption{textOption}
+		if got := wrapLines(t, c.option); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: %q, 期望: %q", c.name, got, c.want)
+		}
+	}
+
+	// 加上省略号后超出行宽时从行尾去掉字符，直到省略号能放下
+	lines := wrapLines(t, TextLineOption{TextList: []TextOption{textOption}, WrapWidth: width, MaxLines: 1, Ellipsis: "…"})
+	if len(lines) != 1 || !strings.HasSuffix(lines[0], "…") || !strings.HasPrefix("aaa bbb", strings.TrimSuffix(lines[0], "…")) {
+		t.Fatalf("省略号: %q", lines)
+	}
+	if measure(lines[0]) > width || lines[0] == "aaa bbb…" {
+		t.Errorf("省略号: %q超出行宽", lines[0])
+	}
+}
+
+func TestWrapTextListCharOffsets(t *testing.T) {
+	offsets := []CharOffset{{X: 1}, {X: 2}, {X: 3}, {X: 4}, {X: 5}}
+	list, err := wrapTextList(TextLineOption{TextList: []TextOption{{
+		Text:        "ab\ncd",
+		FontData:    goregular.TTF,
+		FontSize:    12,
+		CharOffsets: offsets,
+	}}})
+	if err != nil {
+		t.Fatalf("换行失败: %v", err)
+	}
+	if len(list) != 2 {
+		t.Fatalf("行数为%d，期望: 2", len(list))
+	}
+	// 第二行从原文本的第4个字符开始，换行符的偏移被跳过
+	if !reflect.DeepEqual(list[0].CharOffsets, offsets) || !reflect.DeepEqual(list[1].CharOffsets, offsets[3:]) {
+		t.Errorf("逐字符偏移不正确: %v, %v", list[0].CharOffsets, list[1].CharOffsets)
+	}
+}
+
+func TestVerticalNewline(t *testing.T) {
+	text := func(s string) TextOption {
+		return TextOption{Text: s, FontData: goregular.TTF, FontSize: 12, FontColor: "#000000"}
+	}
+	// 竖排时换行符处另起一列，与分别作为两个文本的结果相同
+	split, err := GenerateMultipleLinesText(TextLineOption{
+		TextList:  []TextOption{text("ab\ncd")},
+		Direction: DirectionVertical,
+		LineGap:   2,
+		WrapWidth: 1, // 竖排时不按宽度换行
+	})
+	if err != nil {
+		t.Fatalf("生成文本失败: %v", err)
+	}
+	columns, err := GenerateMultipleLinesText(TextLineOption{
+		TextList:  []TextOption{text("ab"), text("cd")},
+		Direction: DirectionVertical,
+		LineGap:   2,
+	})
+	if err != nil {
+		t.Fatalf("生成文本失败: %v", err)
+	}
+	if split.W != columns.W || split.H != columns.H {
+		t.Errorf("画布尺寸为%vx%v，期望: %vx%v", split.W, split.H, columns.W, columns.H)
+	}
+}
@@ -11,7 +11,7 @@ func GenerateOriginalText(option TextOption) (*canvas.Canvas, error) {
 		return nil, errors.New("text is required")
 	}
 
-	font, err := LoadFont(option.FontPath)
+	font, err := loadOptionFont(option)
 	if err != nil {
 		return nil, err
 	}